@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prefix of the environment variables that configure the server (e.g. `HTTP_SERVER_DIRECTORY`)
+const envPrefix = "HTTP_SERVER_"
+
+// Config holds the settings of the server. They are read once at startup from, in increasing order of precedence,
+// the defaults, a JSON config file, environment variables and command line flags.
+//
+// Every setting has a flag (e.g. `--read-timeout 30s`), an environment variable named after it
+// (e.g. `HTTP_SERVER_READ_TIMEOUT=30s`) and a key in the config file (e.g. `"read-timeout": "30s"`).
+type Config struct {
+	ConfigFile string // The JSON file to read the settings from, if any
+
+	Addr              string            // TCP address to listen on
+	Directory         string            // The directory served by /files/ and /static/
+	CreateDirectories bool              // Whether uploads create missing parent directories
+	MIMETypes         map[string]string // Media types of files by extension, on top of the built-in ones
+	FilesContentType  string            // The media type of /files/ without a known extension, or "" to sniff it from the content
+
+	TLSAddr           string        // TCP address to listen on for HTTPS, when certificates are configured
+	TLSCertFiles      []string      // The certificate files, picked from by the server name the client asks for (SNI)
+	TLSKeyFiles       []string      // The private key files, in the same order as the certificate files
+	TLSReloadInterval time.Duration // How often to check the certificate files for changes, or 0 to never reload them
+	RedirectHTTP      bool          // Whether to redirect plain HTTP requests to HTTPS instead of serving them
+	HTTP2             bool          // Whether to speak HTTP/2 with clients that ask for it
+
+	ReadHeaderTimeout time.Duration // Maximum duration for reading the request-line and header section
+	ReadTimeout       time.Duration // Maximum duration for reading an entire request, including the body
+	WriteTimeout      time.Duration // Maximum duration for writing a response
+	IdleTimeout       time.Duration // Maximum duration to wait for the next request on a persistent connection
+	ShutdownTimeout   time.Duration // Maximum duration to wait for in-flight requests when shutting down
+
+	MaxHeaderBytes int   // Maximum size of the request-line and header section
+	MaxBodySize    int64 // Maximum size of a request body once decompressed
+
+	LogRequests bool // Whether to print every request and response
+}
+
+// The settings used when nothing else is configured
+func defaultConfig() *Config {
+	return &Config{
+		Addr:              "0.0.0.0:4221",
+		CreateDirectories: true,
+		MIMETypes:         map[string]string{},
+		FilesContentType:  "application/octet-stream",
+		TLSAddr:           "0.0.0.0:4443",
+		TLSReloadInterval: 10 * time.Second,
+		HTTP2:             true,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       0, // Uploads and downloads of large files may take arbitrarily long
+		WriteTimeout:      0,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   10 * time.Second,
+		MaxHeaderBytes:    1 << 20,   // 1 MB
+		MaxBodySize:       100 << 20, // 100 MB
+		LogRequests:       true,
+	}
+}
+
+// Load the configuration from the command line arguments (without the program name),
+// the environment and the config file they point to, and validate it.
+// Returns flag.ErrHelp if the usage was asked for with `-h` or `--help`.
+func loadConfig(args []string, output io.Writer) (*Config, error) {
+	// The flags are parsed once up front to find the config file, and to report bad flags or print the usage
+	// before anything else. They are parsed again at the end, so they win over the file and the environment.
+	probe := defaultConfig()
+	if err := newFlagSet(probe, output).Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := defaultConfig()
+	flags := newFlagSet(config, io.Discard)
+
+	configFile := probe.ConfigFile
+	if configFile == "" {
+		configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+	if configFile != "" {
+		if err := loadConfigFile(flags, configFile); err != nil {
+			return nil, err
+		}
+	}
+	// A repeatable flag given by a source replaces the values of the sources before it, instead of adding to them
+	replaceRepeatable(flags)
+	if err := loadEnv(flags); err != nil {
+		return nil, err
+	}
+	replaceRepeatable(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	config.ConfigFile = configFile
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Define the flags of the configuration, storing their values in the config
+func newFlagSet(config *Config, output io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet("your_server", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	flags.StringVar(&config.ConfigFile, "config", config.ConfigFile, "JSON file to read the settings from")
+
+	flags.StringVar(&config.Addr, "addr", config.Addr, "TCP address to listen on")
+	flags.StringVar(&config.Directory, "directory", config.Directory, "directory served by /files/ and /static/")
+	flags.BoolVar(&config.CreateDirectories, "create-dirs", config.CreateDirectories, "let uploads create missing parent directories")
+	flags.BoolFunc("no-create-dirs", "shorthand for --create-dirs=false", func(value string) error {
+		noCreate, err := strconv.ParseBool(value)
+		config.CreateDirectories = !noCreate
+		return err
+	})
+	flags.Var(&mimeTypesFlag{types: config.MIMETypes}, "mime-type", "media type of files by extension, as `.ext=type` (repeatable)")
+	flags.StringVar(&config.FilesContentType, "files-content-type", config.FilesContentType, "media `type` of /files/ with an unknown extension (empty to sniff the content)")
+
+	flags.StringVar(&config.TLSAddr, "tls-addr", config.TLSAddr, "TCP address to listen on for HTTPS")
+	flags.Var(&stringsFlag{values: &config.TLSCertFiles}, "tls-cert", "PEM certificate `file` to serve HTTPS with (repeatable, one per --tls-key)")
+	flags.Var(&stringsFlag{values: &config.TLSKeyFiles}, "tls-key", "PEM private key `file` of the --tls-cert in the same position (repeatable)")
+	flags.DurationVar(&config.TLSReloadInterval, "tls-reload-interval", config.TLSReloadInterval, "how often to reload changed certificates (0 for never)")
+	flags.BoolVar(&config.RedirectHTTP, "redirect-http", config.RedirectHTTP, "redirect plain HTTP requests to HTTPS")
+	flags.BoolVar(&config.HTTP2, "http2", config.HTTP2, "speak HTTP/2 over TLS (ALPN) and cleartext (h2c)")
+
+	flags.DurationVar(&config.ReadHeaderTimeout, "read-header-timeout", config.ReadHeaderTimeout, "maximum duration for reading the request headers")
+	flags.DurationVar(&config.ReadTimeout, "read-timeout", config.ReadTimeout, "maximum duration for reading an entire request (0 for none)")
+	flags.DurationVar(&config.WriteTimeout, "write-timeout", config.WriteTimeout, "maximum duration for writing a response (0 for none)")
+	flags.DurationVar(&config.IdleTimeout, "idle-timeout", config.IdleTimeout, "maximum duration to keep an idle connection open")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "maximum duration to wait for in-flight requests on shutdown")
+
+	flags.IntVar(&config.MaxHeaderBytes, "max-header-bytes", config.MaxHeaderBytes, "maximum size of the request headers in bytes")
+	flags.Int64Var(&config.MaxBodySize, "max-body-size", config.MaxBodySize, "maximum size of a decompressed request body in bytes")
+
+	flags.BoolVar(&config.LogRequests, "log-requests", config.LogRequests, "print every request and response")
+
+	return flags
+}
+
+// Set the flags from the environment variables named after them (e.g. `HTTP_SERVER_MAX_BODY_SIZE` for `--max-body-size`)
+func loadEnv(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		name := envVarName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		// A repeatable flag takes a comma-separated list of values
+		values := []string{value}
+		if isRepeatable(f) {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if setErr := flags.Set(f.Name, strings.TrimSpace(v)); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", value, name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// The name of the environment variable of a flag (e.g. `read-timeout` -> `HTTP_SERVER_READ_TIMEOUT`)
+func envVarName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Set the flags from a JSON config file, whose keys are the names of the flags. For example:
+//
+//	{
+//		"addr": "127.0.0.1:8080",
+//		"directory": "/srv/files",
+//		"read-timeout": "30s",
+//		"mime-type": {".md": "text/plain; charset=utf-8"}
+//	}
+func loadConfigFile(flags *flag.FlagSet, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var settings map[string]json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&settings); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", name, err)
+	}
+
+	// Apply the settings in a stable order, so errors are reported consistently
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "config" || flags.Lookup(key) == nil {
+			return fmt.Errorf("invalid config file %s: unknown setting %q", name, key)
+		}
+		values, err := configFileValues(key, settings[key])
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %q: %w", name, key, err)
+		}
+		for _, value := range values {
+			if err := flags.Set(key, value); err != nil {
+				return fmt.Errorf("invalid config file %s: %q: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Convert a JSON value of the config file to the values of its flag.
+// Strings, numbers and booleans are taken as is, arrays of strings as one value per element,
+// and the `mime-type` object as one `.ext=type` value per entry.
+func configFileValues(key string, raw json.RawMessage) ([]string, error) {
+	if key == "mime-type" {
+		var mimeTypes map[string]string
+		if err := json.Unmarshal(raw, &mimeTypes); err != nil {
+			return nil, errors.New("must be an object of extensions to media types")
+		}
+		values := make([]string, 0, len(mimeTypes))
+		for ext, contentType := range mimeTypes {
+			values = append(values, ext+"="+contentType)
+		}
+		sort.Strings(values)
+		return values, nil
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []any:
+		values := make([]string, len(v))
+		for i, element := range v {
+			s, ok := element.(string)
+			if !ok {
+				return nil, errors.New("must be an array of strings")
+			}
+			values[i] = s
+		}
+		return values, nil
+	default:
+		return nil, errors.New("must be a string, number, boolean or array of strings")
+	}
+}
+
+// Check that the settings make sense together, so that mistakes are caught at startup instead of on the first request
+func (c *Config) validate() error {
+	// Plain HTTP may only be turned off when HTTPS is served instead
+	if c.Addr != "" || !c.TLSEnabled() {
+		if err := validateAddr("addr", c.Addr); err != nil {
+			return err
+		}
+	}
+
+	if c.Directory != "" {
+		info, err := os.Stat(c.Directory)
+		if err != nil {
+			return fmt.Errorf("invalid directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("invalid directory %q: not a directory", c.Directory)
+		}
+	}
+
+	timeouts := map[string]time.Duration{
+		"read-header-timeout": c.ReadHeaderTimeout,
+		"read-timeout":        c.ReadTimeout,
+		"write-timeout":       c.WriteTimeout,
+		"idle-timeout":        c.IdleTimeout,
+		"shutdown-timeout":    c.ShutdownTimeout,
+		"tls-reload-interval": c.TLSReloadInterval,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			return fmt.Errorf("invalid %s %s: must not be negative", name, timeout)
+		}
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("invalid max-header-bytes %d: must be positive", c.MaxHeaderBytes)
+	}
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("invalid max-body-size %d: must be positive", c.MaxBodySize)
+	}
+	return nil
+}
+
+// Check the TLS settings, if HTTPS is served
+func (c *Config) validateTLS() error {
+	if len(c.TLSCertFiles) != len(c.TLSKeyFiles) {
+		return fmt.Errorf("got %d --tls-cert but %d --tls-key: each certificate needs its private key", len(c.TLSCertFiles), len(c.TLSKeyFiles))
+	}
+	if !c.TLSEnabled() {
+		if c.RedirectHTTP {
+			return errors.New("invalid redirect-http: there is no HTTPS to redirect to without --tls-cert")
+		}
+		return nil
+	}
+
+	if err := validateAddr("tls-addr", c.TLSAddr); err != nil {
+		return err
+	}
+	for _, name := range append(append([]string{}, c.TLSCertFiles...), c.TLSKeyFiles...) {
+		if _, err := os.Stat(name); err != nil {
+			return fmt.Errorf("invalid TLS file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Whether HTTPS is served, which it is as soon as a certificate is configured
+func (c *Config) TLSEnabled() bool {
+	return len(c.TLSCertFiles) > 0
+}
+
+// Check that the address is a valid host and port to listen on (e.g. `0.0.0.0:4221` or `:4221`)
+func validateAddr(name, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid %s %q: port must be a number between 0 and 65535", name, addr)
+	}
+	return nil
+}
+
+// Whether the flag may be given more than once, and so takes a comma-separated list in an environment variable
+func isRepeatable(f *flag.Flag) bool {
+	_, ok := f.Value.(repeatableFlag)
+	return ok
+}
+
+// Make the next value of every repeatable flag replace its current values, as it comes from a source of higher precedence
+func replaceRepeatable(flags *flag.FlagSet) {
+	flags.VisitAll(func(f *flag.Flag) {
+		if repeatable, ok := f.Value.(repeatableFlag); ok {
+			repeatable.replaceOnNextSet()
+		}
+	})
+}
+
+// repeatableFlag is a flag that collects all of its values, instead of keeping the last one
+type repeatableFlag interface {
+	flag.Value
+	replaceOnNextSet() // Clear the collected values on the next call to Set
+}
+
+// stringsFlag collects the values of a repeatable flag (e.g. `--tls-cert a.pem --tls-cert b.pem`)
+type stringsFlag struct {
+	values  *[]string
+	replace bool // Whether the next value replaces the collected ones
+}
+
+func (s *stringsFlag) String() string {
+	if s == nil || s.values == nil {
+		return ""
+	}
+	return strings.Join(*s.values, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	if value == "" {
+		return errors.New("must not be empty")
+	}
+	if s.replace {
+		*s.values = nil
+		s.replace = false
+	}
+	*s.values = append(*s.values, value)
+	return nil
+}
+
+func (s *stringsFlag) replaceOnNextSet() {
+	s.replace = true
+}
+
+// mimeTypesFlag collects the repeatable `--mime-type .ext=type` flag into a map
+type mimeTypesFlag struct {
+	types   map[string]string
+	replace bool // Whether the next value replaces the collected ones
+}
+
+func (m *mimeTypesFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	values := make([]string, 0, len(m.types))
+	for ext, contentType := range m.types {
+		values = append(values, ext+"="+contentType)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (m *mimeTypesFlag) Set(value string) error {
+	ext, contentType, found := strings.Cut(value, "=")
+	if !found || ext == "" || contentType == "" {
+		return errors.New("must be of the form .ext=type")
+	}
+	if m.replace {
+		clear(m.types)
+		m.replace = false
+	}
+	m.types[ext] = contentType
+	return nil
+}
+
+func (m *mimeTypesFlag) replaceOnNextSet() {
+	m.replace = true
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write the config file to a temporary directory and return its path
+func writeTestConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// Create empty files to stand in for certificates and keys, and return their paths
+func writeTestFiles(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[i], nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	config, err := loadConfig(nil, io.Discard)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if !reflect.DeepEqual(config, defaultConfig()) {
+		t.Errorf("Expected the defaults %+v, but got %+v", defaultConfig(), config)
+	}
+	// Transfers of large files may take arbitrarily long
+	if config.ReadTimeout != 0 || config.WriteTimeout != 0 {
+		t.Errorf("Expected no read and write timeouts, but got %s and %s", config.ReadTimeout, config.WriteTimeout)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	configFile := writeTestConfigFile(t, `{
+		"addr": "127.0.0.1:8080",
+		"read-timeout": "10s",
+		"idle-timeout": "20s",
+		"max-header-bytes": 2048,
+		"log-requests": false
+	}`)
+	t.Setenv("HTTP_SERVER_CONFIG", configFile)
+	t.Setenv("HTTP_SERVER_READ_TIMEOUT", "30s")
+	t.Setenv("HTTP_SERVER_IDLE_TIMEOUT", "40s")
+
+	config, err := loadConfig([]string{"--idle-timeout", "50s"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		actual   any
+		expected any
+	}{
+		{name: "config", actual: config.ConfigFile, expected: configFile},
+		{name: "addr", actual: config.Addr, expected: "127.0.0.1:8080"},
+		{name: "max-header-bytes", actual: config.MaxHeaderBytes, expected: 2048},
+		{name: "log-requests", actual: config.LogRequests, expected: false},
+		{name: "read-timeout", actual: config.ReadTimeout, expected: 30 * time.Second},
+		{name: "idle-timeout", actual: config.IdleTimeout, expected: 50 * time.Second},
+		{name: "shutdown-timeout", actual: config.ShutdownTimeout, expected: defaultConfig().ShutdownTimeout},
+	}
+	for _, tc := range testCases {
+		if tc.actual != tc.expected {
+			t.Errorf("Expected %s to be %v, but got %v", tc.name, tc.expected, tc.actual)
+		}
+	}
+}
+
+func TestLoadConfigRepeatable(t *testing.T) {
+	files := writeTestFiles(t, "a.pem", "a.key", "b.pem", "b.key", "c.pem", "c.key")
+	configFile := writeTestConfigFile(t, `{
+		"tls-cert": ["`+files[0]+`", "`+files[2]+`"],
+		"tls-key": ["`+files[1]+`", "`+files[3]+`"],
+		"mime-type": {".md": "text/markdown", ".log": "text/plain"}
+	}`)
+
+	testCases := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		certFiles []string
+		keyFiles  []string
+		mimeTypes map[string]string
+	}{
+		{
+			name:      "File only",
+			certFiles: []string{files[0], files[2]},
+			keyFiles:  []string{files[1], files[3]},
+			mimeTypes: map[string]string{".md": "text/markdown", ".log": "text/plain"},
+		},
+		{
+			name:      "Environment replaces the file",
+			env:       map[string]string{"HTTP_SERVER_TLS_CERT": files[4], "HTTP_SERVER_TLS_KEY": files[5], "HTTP_SERVER_MIME_TYPE": ".txt=text/plain, .csv=text/csv"},
+			certFiles: []string{files[4]},
+			keyFiles:  []string{files[5]},
+			mimeTypes: map[string]string{".txt": "text/plain", ".csv": "text/csv"},
+		},
+		{
+			name:      "Flags replace the environment",
+			env:       map[string]string{"HTTP_SERVER_TLS_CERT": files[4], "HTTP_SERVER_TLS_KEY": files[5], "HTTP_SERVER_MIME_TYPE": ".txt=text/plain"},
+			args:      []string{"--tls-cert", files[0], "--tls-key", files[1], "--mime-type", ".md=text/plain"},
+			certFiles: []string{files[0]},
+			keyFiles:  []string{files[1]},
+			mimeTypes: map[string]string{".md": "text/plain"},
+		},
+		{
+			name:      "Unset flags keep the file",
+			env:       map[string]string{"HTTP_SERVER_MIME_TYPE": ".txt=text/plain"},
+			certFiles: []string{files[0], files[2]},
+			keyFiles:  []string{files[1], files[3]},
+			mimeTypes: map[string]string{".txt": "text/plain"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			config, err := loadConfig(append([]string{"--config", configFile}, tc.args...), io.Discard)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if !reflect.DeepEqual(config.TLSCertFiles, tc.certFiles) {
+				t.Errorf("Expected the certificates %v, but got %v", tc.certFiles, config.TLSCertFiles)
+			}
+			if !reflect.DeepEqual(config.TLSKeyFiles, tc.keyFiles) {
+				t.Errorf("Expected the keys %v, but got %v", tc.keyFiles, config.TLSKeyFiles)
+			}
+			if !reflect.DeepEqual(config.MIMETypes, tc.mimeTypes) {
+				t.Errorf("Expected the media types %v, but got %v", tc.mimeTypes, config.MIMETypes)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	files := writeTestFiles(t, "cert.pem")
+
+	testCases := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		expected string
+	}{
+		{name: "Unknown flag", args: []string{"--unknown"}, expected: "not defined"},
+		{name: "Unknown setting", file: `{"unknown": true}`, expected: `unknown setting "unknown"`},
+		{name: "Config in config file", file: `{"config": "other.json"}`, expected: `unknown setting "config"`},
+		{name: "Malformed config file", file: `{"addr":`, expected: "invalid config file"},
+		{name: "Wrong type", file: `{"mime-type": [".md"]}`, expected: "must be an object"},
+		{name: "Invalid environment variable", env: map[string]string{"HTTP_SERVER_READ_TIMEOUT": "soon"}, expected: "HTTP_SERVER_READ_TIMEOUT"},
+		{name: "Negative timeout", args: []string{"--idle-timeout", "-1s"}, expected: "must not be negative"},
+		{name: "Invalid address", args: []string{"--addr", "localhost"}, expected: "invalid addr"},
+		{name: "Missing directory", args: []string{"--directory", "/does/not/exist"}, expected: "invalid directory"},
+		{name: "Certificate without key", args: []string{"--tls-cert", files[0]}, expected: "each certificate needs its private key"},
+		{name: "Redirect without HTTPS", args: []string{"--redirect-http"}, expected: "no HTTPS to redirect to"},
+		{name: "Invalid max-body-size", args: []string{"--max-body-size", "0"}, expected: "must be positive"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"--config", writeTestConfigFile(t, tc.file)}, args...)
+			}
+
+			_, err := loadConfig(args, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected an error containing %q, but got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHelp(t *testing.T) {
+	var sb strings.Builder
+	if _, err := loadConfig([]string{"--help"}, &sb); err != flag.ErrHelp {
+		t.Fatalf("Expected flag.ErrHelp, but got %v", err)
+	}
+	if !strings.Contains(sb.String(), "-read-timeout") {
+		t.Errorf("Expected the usage to list the flags, but got %s", sb.String())
+	}
+}
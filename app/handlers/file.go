@@ -1,118 +1,342 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"io"
 	"net/http"
 	"os"
 	"path"
-	"strings"
+	"syscall"
+	"time"
 
 	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
 )
 
-// Handles the `/files/{name}` endpoint
+// Whether uploads create the missing parent directories of the file (e.g. `project/build` for `project/build/app.zip`).
+// Otherwise, uploading into a directory that doesn't exist fails with 409 Conflict.
+var CreateDirectories = true
+
+// The media type of files without a known extension, served as downloads by default.
+// If empty, the media type is sniffed from the content of the file instead.
+var FilesContentType = "application/octet-stream"
+
+// The --directory whose files are served by /files/ and /static/, opened once at startup
+var Directory *httpMessage.Root
+
+// Returned by openRoot when the server was started without a --directory
+var errNoDirectory = errors.New("no directory configured")
+
+// -------
+// METHODS
+// -------
+
+// Handles the GET method for the /files/{name...} endpoint.
 // Reads the file content from the --directory and returns it as the response body.
-func Files(req *httpMessage.Request, res *httpMessage.Response) {
+func GetFile(req *httpMessage.Request, res *httpMessage.Response) {
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return
+	}
 
-	// Get the --directory from the arguments
-	directory := GetDirectoryFromArguments()
+	// Respond with the file content. The file is streamed to the connection and closed afterwards.
+	// Files with a known extension are served with their media type, so browsers can display them.
+	// Anything else gets the configured media type, or is sniffed from its content if there is none.
+	httpMessage.ServeFileWithFallbackType(req, res, root, req.Param("name"), FilesContentType)
+}
 
-	// Cut the prefix "/files/" from the request path (e.g. "/files/hello.txt" -> "hello.txt")
-	fileName, found := strings.CutPrefix(req.Path, "/files/")
-	if !found {
-		res.WithStatus(http.StatusNotFound)
+// Handles the POST method for the /files/{name...} endpoint.
+// Writes the request body to the file in the --directory.
+func PostFile(req *httpMessage.Request, res *httpMessage.Response) {
+	if _, ok := uploadFile(req, res); !ok {
 		return
 	}
 
-	// Construct the full file path
-	filePath := path.Join(directory, fileName)
+	// Respond with a success message
+	res.WithStatus(http.StatusCreated).WithBody("File created successfully")
+}
 
-	// Route the request based on the HTTP method
-	switch req.Method {
-	case "GET":
-		GetFile(req, res, filePath)
-	case "POST":
-		PostFile(req, res, filePath)
-	default:
-		res.WithStatus(405) // Method Not Allowed
+// Handles the PUT method for the /files/{name...} endpoint.
+// Creates or replaces the file in the --directory with the request body.
+// Responds with 201 Created if the file is new, and 204 No Content if it was replaced.
+func PutFile(req *httpMessage.Request, res *httpMessage.Response) {
+	existed, ok := uploadFile(req, res)
+	if !ok {
+		return
 	}
+
+	if existed {
+		res.WithStatus(http.StatusNoContent)
+		return
+	}
+	res.WithStatus(http.StatusCreated).WithBody("File created successfully")
 }
 
-// -------
-// METHODS
-// -------
+// Handles the PATCH method for the /files/{name...} endpoint.
+// Appends the request body to the end of the existing file in the --directory.
+func PatchFile(req *httpMessage.Request, res *httpMessage.Response) {
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return
+	}
+
+	// Unlike PUT, PATCH never creates the file. Fail fast, before the client sends a body that would be thrown away
+	name := req.Param("name")
+	existed, ok := checkFilePreconditions(req, res, root, name)
+	if !ok {
+		return
+	}
+	if !existed {
+		res.WithStatus(http.StatusNotFound)
+		return
+	}
 
-// Handles the GET method for the /files/{name} endpoint
-func GetFile(req *httpMessage.Request, res *httpMessage.Response, filePath string) {
+	// Stream the request body into a temporary file first, without holding the lock, as it may take a while.
+	// It is never committed, only copied into the file below
+	body, err := root.CreateAtomic(name)
+	if err != nil {
+		respondWithFileError(res, err, "Could not create file")
+		return
+	}
+	defer body.Abort()
+
+	if _, err := io.Copy(body, req.BodyReader()); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return
+	}
 
-	// Check if the file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Appending reads the current file, so nobody else may change it in the meantime.
+	// It may also have changed while the body was uploading, so check again
+	unlock := fileLocks.lock(name)
+	defer unlock()
+	existed, ok = checkFilePreconditions(req, res, root, name)
+	if !ok {
+		return
+	}
+	if !existed {
 		res.WithStatus(http.StatusNotFound)
 		return
 	}
 
-	// Read the file content
-	content, err := os.ReadFile(filePath)
+	// Copy the file and append the body to the copy, which then replaces the file.
+	// That way a failed append leaves the file as it was
+	current, err := root.Open(name)
 	if err != nil {
-		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not read file")
+		respondWithFileError(res, err, "Could not open file")
 		return
 	}
+	defer current.Close()
 
-	// Respond with the file content
-	res.WithStatus(http.StatusOK).WithHeaders(map[string]string{
-		"Content-Type":   "application/octet-stream",
-		"Content-Length": fmt.Sprintf("%d", len(content)),
-	}).WithBody(string(content))
+	file, err := root.CreateAtomic(name)
+	if err != nil {
+		respondWithFileError(res, err, "Could not create file")
+		return
+	}
+	defer file.Abort()
+
+	if _, err := io.Copy(file, io.MultiReader(current, body)); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return
+	}
+	if err := file.Commit(); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return
+	}
 
+	setETag(res, root, name)
+	res.WithStatus(http.StatusNoContent)
 }
 
-// Handles the POST method for the /files/{name} endpoint
-func PostFile(req *httpMessage.Request, res *httpMessage.Response, filePath string) {
-	// Check if the file already exists, and create it if it doesn't
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		_, err := os.Create(filePath)
-		if err != nil {
-			res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not create file")
-			return
-		}
+// Handles the DELETE method for the /files/{name...} endpoint.
+// Removes the file from the --directory.
+func DeleteFile(req *httpMessage.Request, res *httpMessage.Response) {
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return
 	}
 
-	// Read the request body
-	fileContents := req.Body
+	name := req.Param("name")
+	unlock := fileLocks.lock(name)
+	defer unlock()
 
-	// Write the file content
-	err := os.WriteFile(filePath, []byte(fileContents), 0644)
-	if err != nil {
-		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+	existed, ok := checkFilePreconditions(req, res, root, name)
+	if !ok {
+		return
+	}
+	if !existed {
+		res.WithStatus(http.StatusNotFound)
 		return
 	}
 
-	// Respond with a success message
-	res.WithStatus(http.StatusCreated).WithBody("File created successfully")
+	if err := root.Remove(name); err != nil {
+		respondWithFileError(res, err, "Could not delete file")
+		return
+	}
+
+	res.WithStatus(http.StatusNoContent)
 }
 
 // ----------------
 // HELPER FUNCTIONS
 // ----------------
 
-// Extracts the directory from the command line arguments
-func GetDirectoryFromArguments() string {
-	// Get Command Line Arguments
-	args := os.Args[1:]
+// Streams the request body into the named file in the --directory, replacing it atomically once complete.
+// The body is uploaded to a temporary file first, so concurrent uploads never interleave, and readers
+// never see a partially written file. The preconditions of the request (e.g. `If-Match`) are checked
+// before the upload starts, and again right before the file is replaced.
+// Returns whether the file existed before. On failure, an error response is set and ok is false.
+func uploadFile(req *httpMessage.Request, res *httpMessage.Response) (existed bool, ok bool) {
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return false, false
+	}
 
-	// Extract --directory flag
-	directory := ""
+	// Fail fast, before the client sends a body that would be thrown away
+	name := req.Param("name")
+	if _, ok := checkFilePreconditions(req, res, root, name); !ok {
+		return false, false
+	}
 
-	i := 0
-	for i < len(args) {
-		if args[i] == "--directory" {
-			if i+1 < len(args) {
-				directory = args[i+1]
-				i++ // Skip the next argument as we just used it as the value
+	// Create the directories the file goes into, and remove them again if the upload fails (e.g. the client gives up),
+	// so that aborted uploads leave no empty directories behind
+	if CreateDirectories {
+		removeDirs, err := createParentDirs(root, name)
+		if err != nil {
+			respondWithUploadError(res, err)
+			return false, false
+		}
+		defer func() {
+			if !ok {
+				removeDirs()
 			}
+		}()
+	}
+
+	file, err := root.CreateAtomic(name)
+	if err != nil {
+		respondWithUploadError(res, err)
+		return false, false
+	}
+	defer file.Abort() // Don't leave the temporary file behind if anything fails
+
+	// Stream the request body into the temporary file, without holding the lock, as it may take a while
+	if _, err := io.Copy(file, req.BodyReader()); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return false, false
+	}
+
+	// The file may have changed while the body was uploading, so check again before replacing it
+	unlock := fileLocks.lock(name)
+	defer unlock()
+	existed, ok = checkFilePreconditions(req, res, root, name)
+	if !ok {
+		return false, false
+	}
+
+	if err := file.Commit(); err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not write file")
+		return false, false
+	}
+
+	setETag(res, root, name)
+	return existed, true
+}
+
+// Create the missing parent directories of the named file.
+// Returns a function that removes the directories that were created, unless something was put in them meanwhile.
+func createParentDirs(root *httpMessage.Root, name string) (func(), error) {
+	// The missing directories, from the deepest one up
+	var missing []string
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, err := root.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, dir)
+	}
+
+	removeDirs := func() {
+		for _, dir := range missing {
+			// Fails if the directory isn't empty (e.g. another upload is writing into it), which is fine
+			root.Remove(dir)
 		}
-		i++
 	}
+	if err := root.MkdirAll(path.Dir(name), 0755); err != nil {
+		removeDirs()
+		return nil, err
+	}
+	return removeDirs, nil
+}
 
-	return directory
+// Evaluates the conditional headers of the request (e.g. `If-Match: "..."` or `If-None-Match: *`)
+// against the current state of the named file, so that clients can't silently overwrite each other's changes.
+// Returns whether the file exists. On failure, an error response is set and ok is false.
+func checkFilePreconditions(req *httpMessage.Request, res *httpMessage.Response, root *httpMessage.Root, name string) (exists bool, ok bool) {
+	info, err := root.Stat(name)
+	missing := errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+	if err != nil && !missing {
+		respondWithFileError(res, err, "Could not read file")
+		return false, false
+	}
+
+	// A missing file has no entity-tag, so `If-Match` fails and `If-None-Match: *` succeeds
+	etag, modTime := "", time.Time{}
+	if err == nil {
+		if info.IsDir() {
+			res.WithStatus(http.StatusConflict).WithBody("Conflict: Is a directory")
+			return false, false
+		}
+		etag, modTime = httpMessage.ETag(info), info.ModTime()
+	}
+
+	if status := httpMessage.CheckPreconditions(req, etag, modTime); status != 0 {
+		res.WithStatus(status)
+		return false, false
+	}
+	return err == nil, true
+}
+
+// Sets the `ETag` of the file that was just written, so the client can make its next change conditional on it
+func setETag(res *httpMessage.Response, root *httpMessage.Root, name string) {
+	if info, err := root.Stat(name); err == nil {
+		res.Headers.Set("ETag", httpMessage.ETag(info))
+	}
+}
+
+// Responds with the status matching the reason a file in the --directory could not be accessed
+func respondWithFileError(res *httpMessage.Response, err error, message string) {
+	switch {
+	case errors.Is(err, httpMessage.ErrInvalidPath):
+		res.WithStatus(http.StatusBadRequest)
+	case errors.Is(err, httpMessage.ErrPathEscapesRoot), errors.Is(err, os.ErrPermission):
+		res.WithStatus(http.StatusForbidden)
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		res.WithStatus(http.StatusNotFound)
+	default:
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: " + message)
+	}
+}
+
+// Responds with the status matching the reason a file in the --directory could not be created.
+// A parent directory that is missing, or is a file, conflicts with the upload rather than being not found.
+func respondWithUploadError(res *httpMessage.Response, err error) {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		res.WithStatus(http.StatusConflict).WithBody("Conflict: Parent directory does not exist")
+		return
+	}
+	respondWithFileError(res, err, "Could not create file")
+}
+
+// Returns the --directory as a Root, so that requests can't reach files outside of it
+func openRoot() (*httpMessage.Root, error) {
+	if Directory == nil {
+		return nil, errNoDirectory
+	}
+	return Directory, nil
 }
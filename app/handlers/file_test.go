@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
+)
+
+// Route the raw request to the /files/ handlers. Reading past the request fails, like a connection that broke
+func serveFileRequest(t *testing.T, request string) *httpMessage.Response {
+	t.Helper()
+	reader := io.MultiReader(strings.NewReader(request), iotest.ErrReader(errors.New("connection reset")))
+	req, err := httpMessage.ParseRequest(bufio.NewReader(reader))
+	if err != nil {
+		t.Fatalf("Failed to parse the request: %v", err)
+	}
+
+	router := httpMessage.NewRouter()
+	router.HandleFunc("PUT /files/{name...}", PutFile)
+	res := httpMessage.CreateResponse()
+	router.ServeHTTP(req, res)
+	return res
+}
+
+func TestUploadFileDirectories(t *testing.T) {
+	root, err := httpMessage.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open the directory: %v", err)
+	}
+	previous := Directory
+	Directory = root
+	t.Cleanup(func() { Directory = previous })
+	if err := os.Mkdir(filepath.Join(root.Name(), "existing"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The body breaks off before its Content-Length, as if the client went away
+	res := serveFileRequest(t, "PUT /files/existing/new/deeper/app.zip HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort")
+	if res.StartLine != "HTTP/1.1 500 Internal Server Error" {
+		t.Errorf("Expected 500 Internal Server Error, but got %q", res.StartLine)
+	}
+	if _, err := os.Stat(filepath.Join(root.Name(), "existing", "new")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the directories created for the aborted upload to be removed, but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root.Name(), "existing")); err != nil {
+		t.Errorf("Expected the directory that existed before to remain, but got %v", err)
+	}
+
+	// A complete upload keeps them
+	res = serveFileRequest(t, "PUT /files/existing/new/deeper/app.zip HTTP/1.1\r\nContent-Length: 5\r\n\r\nwhole")
+	if res.StartLine != "HTTP/1.1 201 Created" {
+		t.Errorf("Expected 201 Created, but got %q", res.StartLine)
+	}
+	if content, err := os.ReadFile(filepath.Join(root.Name(), "existing", "new", "deeper", "app.zip")); string(content) != "whole" {
+		t.Errorf("Expected the file to be written, but got %q and %v", content, err)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"path"
+	"sync"
+)
+
+// Serializes changes to the files in the --directory, so that checking a precondition (e.g. `If-Match`)
+// and writing the file happen as one step. Different files can still be changed concurrently.
+var fileLocks = &pathLocks{locks: map[string]*pathLock{}}
+
+// pathLocks hands out a mutex per path, and forgets it once nobody holds or waits for it
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// A mutex for a single path, along with the number of requests holding or waiting for it
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock the named file, and return the function that unlocks it
+func (p *pathLocks) lock(name string) func() {
+	key := path.Clean("/" + name) // `a.txt` and `./a.txt` are the same file
+
+	p.mu.Lock()
+	l, ok := p.locks[key]
+	if !ok {
+		l = &pathLock{}
+		p.locks[key] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, key)
+		}
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
+)
+
+// Handles the /static/ endpoint.
+// Serves the --directory as a static website, with index.html files and directory listings.
+func Static(req *httpMessage.Request, res *httpMessage.Response) {
+	// The mount point is the root directory, so `/static` is redirected to `/static/` like any other directory.
+	// The location is relative, as the file server's own redirects are.
+	if rawPath, query, _ := strings.Cut(req.Path, "?"); rawPath == "/static" {
+		location := "static/"
+		if query != "" {
+			location += "?" + query
+		}
+		res.WithStatus(http.StatusMovedPermanently).WithHeaders(map[string]string{
+			"Location": location,
+		})
+		return
+	}
+
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return
+	}
+
+	fileServer := httpMessage.NewFileServer(root)
+	fileServer.Listings = true
+
+	// The file server sees the path below /static (e.g. `/static/css/main.css` -> `/css/main.css`)
+	httpMessage.StripPrefix("/static", fileServer).ServeHTTP(req, res)
+}
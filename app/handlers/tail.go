@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
+)
+
+// How often /tail/ checks the file for new lines
+const tailPollInterval = 250 * time.Millisecond
+
+// How far back from the end of the file /tail/ looks for the last lines
+const tailLookback = 64 << 10 // 64 KB
+
+// Lines longer than this are sent in pieces, instead of being held until they end
+const tailMaxLineLength = 64 << 10 // 64 KB
+
+// How often /tail/ pings the client, and how long the client has to answer before it is assumed gone.
+// Variables, so that tests can shorten them
+var (
+	tailPingInterval = 30 * time.Second
+	tailPongTimeout  = 10 * time.Second
+)
+
+// Tail handles the /tail/{name...} endpoint.
+// Streams the lines appended to a file in the --directory (e.g. a log) over a WebSocket, one text message per line, like `tail -F`.
+// Starts with the last 10 lines of the file, or as many as the `lines` query parameter asks for.
+//
+// Clients are pinged regularly, and the stream ends if they stop answering.
+// The server doesn't wait for WebSockets when shutting down, so Shutdown must be registered with
+// Server.RegisterOnShutdown for the streams to say goodbye to their clients.
+type Tail struct {
+	shuttingDown chan struct{} // Closed by Shutdown
+	shutdownOnce sync.Once     // Shutdown may be registered with several servers
+	streams      atomic.Int64  // The number of requests that haven't returned yet
+}
+
+// Instantiate the /tail/ handler
+func NewTail() *Tail {
+	return &Tail{shuttingDown: make(chan struct{})}
+}
+
+// Tell every open stream to close, and refuse new ones with 503 Service Unavailable
+func (t *Tail) Shutdown() {
+	t.shutdownOnce.Do(func() {
+		close(t.shuttingDown)
+	})
+}
+
+// Wait until every stream has closed after Shutdown, or the context is done.
+// Streams close once the client answers the close frame, or after a timeout if it doesn't.
+func (t *Tail) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for t.streams.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Stream the file of the request
+func (t *Tail) ServeHTTP(req *httpMessage.Request, res *httpMessage.Response) {
+	t.streams.Add(1)
+	defer t.streams.Add(-1)
+
+	select {
+	case <-t.shuttingDown:
+		res.WithStatus(http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	root, err := openRoot()
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError).WithBody("Internal Server Error: Could not open directory")
+		return
+	}
+
+	// The number of lines to start with
+	lines := 10
+	_, rawQuery, _ := strings.Cut(req.Path, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	if value := query.Get("lines"); value != "" {
+		lines, err = strconv.Atoi(value)
+		if err != nil || lines < 0 {
+			res.WithStatus(http.StatusBadRequest).WithBody("Bad Request: Invalid number of lines")
+			return
+		}
+	}
+
+	// Check that the file exists before switching protocols, so that clients get a proper 404
+	name := req.Param("name")
+	file, err := root.Open(name)
+	if err != nil {
+		respondWithFileError(res, err, "Could not read file")
+		return
+	}
+	tail := &tailer{root: root, name: name, file: file}
+	defer tail.close()
+	info, err := file.Stat()
+	if err != nil {
+		respondWithFileError(res, err, "Could not read file")
+		return
+	}
+	if info.IsDir() {
+		res.WithStatus(http.StatusConflict).WithBody("Conflict: Is a directory")
+		return
+	}
+	if err := tail.start(info, lines); err != nil {
+		respondWithFileError(res, err, "Could not read file")
+		return
+	}
+
+	ws, err := httpMessage.Upgrade(req, res)
+	if err != nil {
+		return
+	}
+
+	// The client must answer the pings (or send anything) in time, or it is assumed gone.
+	// Otherwise a peer that vanished without closing the connection would hold the stream and its file forever
+	alive := func() {
+		ws.SetReadDeadline(time.Now().Add(tailPingInterval + tailPongTimeout))
+	}
+	alive()
+	ws.OnPong = func([]byte) { alive() }
+
+	// Read in the background, which answers pings and notices when the client goes away.
+	// Messages from the client mean nothing to this endpoint.
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+			alive()
+		}
+	}()
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	pinger := time.NewTicker(tailPingInterval)
+	defer pinger.Stop()
+	for {
+		// Writes to a client that stopped reading fail instead of blocking forever
+		ws.SetWriteDeadline(time.Now().Add(tailPingInterval + tailPongTimeout))
+
+		// Send whatever was appended since the last time
+		if err := tail.follow(ws); err != nil {
+			ws.Close(httpMessage.CloseInternalError, "could not read file")
+			<-clientDone
+			return
+		}
+
+		select {
+		case <-clientDone:
+			return
+		case <-t.shuttingDown:
+			ws.Close(httpMessage.CloseGoingAway, "server shutting down")
+			<-clientDone
+			return
+		case <-pinger.C:
+			if err := ws.Ping(nil); err != nil {
+				ws.SetReadDeadline(time.Now()) // The connection is broken, so stop reading too
+				<-clientDone
+				return
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// How many of the last bytes read /tail/ remembers, to notice a file truncated and written again past where it was read
+const tailFingerprintLength = 64
+
+// tailer follows the lines appended to a file, even when it is truncated or replaced
+type tailer struct {
+	root        *httpMessage.Root
+	name        string
+	file        *os.File    // The file being followed, which may no longer be the one at the path
+	info        os.FileInfo // The identity of the file, to notice when it gets replaced (e.g. by an upload or log rotation)
+	modTime     time.Time   // When the file was last modified, as of the last check
+	offset      int64       // How far the file has been read
+	fingerprint []byte      // The bytes right before the offset, as they were read
+	partial     []byte      // The start of a line whose end hasn't been written yet
+}
+
+// Start reading at the last lines of the file
+func (t *tailer) start(info os.FileInfo, lines int) error {
+	var err error
+	t.info, t.modTime = info, info.ModTime()
+	t.offset, err = lastLinesOffset(t.file, info.Size(), lines)
+	if err != nil {
+		return err
+	}
+	t.fingerprint = make([]byte, min(t.offset, tailFingerprintLength))
+	_, err = t.file.ReadAt(t.fingerprint, t.offset-int64(len(t.fingerprint)))
+	return err
+}
+
+// Checks if the file was truncated since it was read, which means starting over.
+// A file that shrank is caught by its size. One that was truncated and written again past the offset
+// in between two checks is caught by the bytes before the offset no longer being the ones read there.
+// This is a heuristic: a file rewritten with the very same bytes at that spot is taken as unchanged.
+func (t *tailer) truncated(info os.FileInfo) bool {
+	if info.Size() < t.offset {
+		return true
+	}
+	if info.ModTime().Equal(t.modTime) || len(t.fingerprint) == 0 {
+		return false
+	}
+	t.modTime = info.ModTime()
+	current := make([]byte, len(t.fingerprint))
+	if _, err := t.file.ReadAt(current, t.offset-int64(len(current))); err != nil {
+		return true
+	}
+	return !bytes.Equal(current, t.fingerprint)
+}
+
+// Send the complete lines appended to the file since the last call
+func (t *tailer) follow(ws *httpMessage.WebSocket) error {
+	// Switch to the new file when it was replaced, and start over when it was truncated.
+	// While the path doesn't exist (e.g. in the middle of a rotation), keep reading the old file.
+	if info, err := t.root.Stat(t.name); err == nil && !os.SameFile(info, t.info) {
+		if file, err := t.root.Open(t.name); err == nil {
+			t.close()
+			t.file, t.info, t.modTime, t.offset, t.fingerprint, t.partial = file, info, info.ModTime(), 0, nil, nil
+		}
+	}
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if t.truncated(info) {
+		t.modTime, t.offset, t.fingerprint, t.partial = info.ModTime(), 0, nil, nil
+	}
+
+	buf := make([]byte, 32<<10)
+	for t.offset < info.Size() {
+		n, err := t.file.ReadAt(buf[:min(int64(len(buf)), info.Size()-t.offset)], t.offset)
+		t.offset += int64(n)
+		t.fingerprint = append(t.fingerprint, buf[:n]...)
+		t.fingerprint = t.fingerprint[max(0, len(t.fingerprint)-tailFingerprintLength):]
+		if err := t.send(ws, buf[:n]); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			break // Truncated in the meantime
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send every complete line of the data, keeping the last one if it isn't
+func (t *tailer) send(ws *httpMessage.WebSocket, data []byte) error {
+	t.partial = append(t.partial, data...)
+	for {
+		line, rest, found := bytes.Cut(t.partial, []byte("\n"))
+		if !found {
+			if len(t.partial) < tailMaxLineLength {
+				return nil
+			}
+			line, rest = t.partial, nil
+		}
+
+		// Text messages must be UTF-8, whatever the file holds
+		text := strings.ToValidUTF8(string(bytes.TrimSuffix(line, []byte("\r"))), "\uFFFD")
+		if err := ws.WriteMessage(httpMessage.TextMessage, []byte(text)); err != nil {
+			return err
+		}
+		t.partial = rest
+	}
+}
+
+// Close the file being followed
+func (t *tailer) close() {
+	t.file.Close()
+}
+
+// Find where the last lines of the file start, looking at most tailLookback bytes back
+func lastLinesOffset(file *os.File, size int64, lines int) (int64, error) {
+	if lines == 0 {
+		return size, nil
+	}
+	start := max(0, size-tailLookback)
+	buf := make([]byte, size-start)
+	if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	// The newline ending the last line doesn't start another one
+	end := len(buf)
+	if end > 0 && buf[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if buf[i] == '\n' {
+			lines--
+			if lines == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+	}
+
+	// The file has fewer lines than asked for, or they are too long to all be sent.
+	// Skip the line cut in half by the lookback.
+	if start > 0 {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+	}
+	return start, nil
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
+)
+
+// Serve the Tail handler on /tail/ from a temporary --directory, returning the server and its address
+func startTailServer(t *testing.T, tail *Tail) (*httpMessage.Server, string) {
+	t.Helper()
+
+	root, err := httpMessage.OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open the directory: %v", err)
+	}
+	previous := Directory
+	Directory = root
+	t.Cleanup(func() { Directory = previous })
+
+	router := httpMessage.NewRouter()
+	router.Handle("GET /tail/{name...}", tail)
+	server := &httpMessage.Server{Handler: router}
+	server.RegisterOnShutdown(tail.Shutdown)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return server, l.Addr().String()
+}
+
+// Write a file to the --directory of the test server
+func writeTailFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(Directory.Name(), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Append to a file in the --directory of the test server
+func appendTailFile(t *testing.T, name, content string) {
+	t.Helper()
+	file, err := os.OpenFile(filepath.Join(Directory.Name(), name), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := io.WriteString(file, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Send a WebSocket handshake for the path, returning the status line of the response
+func dialTail(t *testing.T, addr, path string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+	// Skip the headers, so the reader is positioned at the first frame
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read the response: %v", err)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "\r\n" {
+			break
+		}
+	}
+	return conn, reader, strings.TrimSpace(status)
+}
+
+// Read an unmasked frame from the server, returning its opcode and payload
+func readTailFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("Failed to read a frame: %v", err)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read a frame: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// Read the next lines sent by the server
+func expectTailLines(t *testing.T, reader *bufio.Reader, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		opcode, payload := readTailFrame(t, reader)
+		if opcode != 0x1 || string(payload) != line {
+			t.Fatalf("Expected a text message %q, but got %q with opcode %d", line, payload, opcode)
+		}
+	}
+}
+
+func TestTailErrors(t *testing.T) {
+	_, addr := startTailServer(t, NewTail())
+	writeTailFile(t, "app.log", "one\n")
+	if err := os.Mkdir(filepath.Join(Directory.Name(), "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/tail/missing.log", expected: "HTTP/1.1 404 Not Found"},
+		{path: "/tail/logs", expected: "HTTP/1.1 409 Conflict"},
+		{path: "/tail/../secret.log", expected: "HTTP/1.1 403 Forbidden"},
+		{path: "/tail/app.log?lines=-1", expected: "HTTP/1.1 400 Bad Request"},
+		{path: "/tail/app.log?lines=x", expected: "HTTP/1.1 400 Bad Request"},
+		{path: "/tail/app.log", expected: "HTTP/1.1 101 Switching Protocols"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			_, _, status := dialTail(t, addr, tc.path)
+			if status != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, status)
+			}
+		})
+	}
+}
+
+func TestTailFollow(t *testing.T) {
+	tail := NewTail()
+	server, addr := startTailServer(t, tail)
+	writeTailFile(t, "app.log", "one\ntwo\nthree\n")
+
+	conn, reader, status := dialTail(t, addr, "/tail/app.log?lines=2")
+	if status != "HTTP/1.1 101 Switching Protocols" {
+		t.Fatalf("Expected 101 Switching Protocols, but got %q", status)
+	}
+	expectTailLines(t, reader, "two", "three")
+
+	// Lines are only sent once they are complete
+	appendTailFile(t, "app.log", "four\npart")
+	expectTailLines(t, reader, "four")
+	appendTailFile(t, "app.log", "ial\r\n")
+	expectTailLines(t, reader, "partial")
+
+	// A file truncated and written again past where it was read is followed from its start
+	writeTailFile(t, "app.log", "truncated and written again\nlonger than before\n")
+	expectTailLines(t, reader, "truncated and written again", "longer than before")
+
+	// A replaced file is followed from its start
+	writeTailFile(t, "app.log.new", "rotated\n")
+	if err := os.Rename(filepath.Join(Directory.Name(), "app.log.new"), filepath.Join(Directory.Name(), "app.log")); err != nil {
+		t.Fatal(err)
+	}
+	expectTailLines(t, reader, "rotated")
+
+	// Shutdown doesn't wait for the stream, but tells it to say goodbye
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected Shutdown to return without waiting for the stream, but got %v", err)
+	}
+	opcode, payload := readTailFrame(t, reader)
+	if opcode != 0x8 || binary.BigEndian.Uint16(payload) != httpMessage.CloseGoingAway {
+		t.Fatalf("Expected a close frame with status %d, but got %x with opcode %d", httpMessage.CloseGoingAway, payload, opcode)
+	}
+
+	// The stream ends once the client answers the close frame, with a masked frame
+	frame := append([]byte{0x88, 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...)
+	conn.Write(frame)
+	if err := tail.Wait(ctx); err != nil {
+		t.Errorf("Expected the stream to end, but got %v", err)
+	}
+}
+
+func TestTailPings(t *testing.T) {
+	previousInterval, previousTimeout := tailPingInterval, tailPongTimeout
+	tailPingInterval, tailPongTimeout = 50*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() { tailPingInterval, tailPongTimeout = previousInterval, previousTimeout })
+
+	tail := NewTail()
+	_, addr := startTailServer(t, tail)
+	writeTailFile(t, "app.log", "one\n")
+
+	// A client that answers the pings keeps the stream open, for longer than it would last without them
+	conn, reader, _ := dialTail(t, addr, "/tail/app.log")
+	expectTailLines(t, reader, "one")
+	for i := 0; i < 5; i++ {
+		opcode, payload := readTailFrame(t, reader)
+		if opcode != 0x9 {
+			t.Fatalf("Expected a ping, but got opcode %d", opcode)
+		}
+		conn.Write(append([]byte{0x8a, 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...))
+	}
+	if streams := tail.streams.Load(); streams != 1 {
+		t.Fatalf("Expected the stream to stay open, but got %d streams", streams)
+	}
+	conn.Close()
+
+	// One that stops answering is assumed gone, and its stream ends
+	_, reader, _ = dialTail(t, addr, "/tail/app.log")
+	expectTailLines(t, reader, "one")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tail.Wait(ctx); err != nil {
+		t.Errorf("Expected the stream to end, but got %v", err)
+	}
+}
+
+func TestTailAfterShutdown(t *testing.T) {
+	tail := NewTail()
+	tail.Shutdown()
+	tail.Shutdown() // Shutdown may be registered with several servers
+
+	_, addr := startTailServer(t, tail)
+	writeTailFile(t, "app.log", "one\n")
+
+	if _, _, status := dialTail(t, addr, "/tail/app.log"); status != "HTTP/1.1 503 Service Unavailable" {
+		t.Errorf("Expected 503 Service Unavailable, but got %q", status)
+	}
+	if err := tail.Wait(context.Background()); err != nil {
+		t.Errorf("Expected no streams to wait for, but got %v", err)
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	long := strings.Repeat("x", tailLookback)
+
+	testCases := []struct {
+		name     string
+		content  string
+		lines    int
+		expected int64
+	}{
+		{name: "Last lines", content: "one\ntwo\nthree\n", lines: 2, expected: 4},
+		{name: "Without trailing newline", content: "one\ntwo\nthree", lines: 1, expected: 8},
+		{name: "Fewer lines than asked for", content: "one\ntwo\n", lines: 10, expected: 0},
+		{name: "No lines", content: "one\ntwo\n", lines: 0, expected: 8},
+		{name: "Empty file", content: "", lines: 10, expected: 0},
+		{name: "Line cut by the lookback", content: long + "\nlast\n", lines: 10, expected: int64(len(long)) + 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "file.log")
+			if err := os.WriteFile(name, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			offset, err := lastLinesOffset(file, int64(len(tc.content)), tc.lines)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if offset != tc.expected {
+				t.Errorf("Expected offset %d, but got %d", tc.expected, offset)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 
 	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
@@ -22,12 +21,11 @@ func UserAgent(req *httpMessage.Request, res *httpMessage.Response) {
 	}
 
 	// Set the response status to 200, content type to "text/plain",
-	// content length to the length of the user agent, and body to the user agent
+	// and body to the user agent. The Content-Length is set when the response is written
 	res.
 		WithStatus(http.StatusOK).
 		WithHeaders(map[string]string{
-			"Content-Type":   "text/plain",
-			"Content-Length": fmt.Sprintf("%d", len(userAgent)),
+			"Content-Type": "text/plain",
 		}).
 		WithBody(userAgent)
 
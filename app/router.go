@@ -2,35 +2,52 @@ package main
 
 import (
 	"net/http"
-	"strings"
 
 	handle "github.com/codecrafters-io/http-server-starter-go/app/handlers"
 	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
 )
 
-// Route the request to the correct handler
-func route(req *httpMessage.Request, res *httpMessage.Response) {
-	switch {
+// Register the routes of the server. The /tail/ handler is shared, so that it can be shut down with the servers
+func newRouter(config *Config, tail *handle.Tail) *httpMessage.Router {
+	router := httpMessage.NewRouter()
 
-	// /files/{name}
-	case strings.HasPrefix(req.Path, "/files/"):
-		handle.Files(req, res)
+	// Log every request, unless told otherwise
+	if config.LogRequests {
+		router.Use(httpMessage.Logger)
+	}
+
+	// Recover from panics in the handlers, decompress the request bodies and compress the responses
+	// that are large enough to be worth it
+	router.Use(
+		httpMessage.Recoverer,
+		httpMessage.Decompress(config.MaxBodySize),
+		httpMessage.Compress(httpMessage.DefaultMinCompressSize),
+	)
+
+	// /files/{name...}, where the name may include directories (e.g. `/files/project/build/app.zip`)
+	router.HandleFunc("GET /files/{name...}", handle.GetFile)
+	router.HandleFunc("POST /files/{name...}", handle.PostFile)
+	router.HandleFunc("PUT /files/{name...}", handle.PutFile)
+	router.HandleFunc("PATCH /files/{name...}", handle.PatchFile)
+	router.HandleFunc("DELETE /files/{name...}", handle.DeleteFile)
+
+	// /tail/{name...}, following a file in the --directory over a WebSocket
+	router.Handle("GET /tail/{name...}", tail)
+
+	// /static/{path...}, and /static which redirects to /static/
+	router.HandleFunc("GET /static", handle.Static)
+	router.HandleFunc("GET /static/{path...}", handle.Static)
 
 	// /user-agent
-	case req.Path == "/user-agent":
-		handle.UserAgent(req, res)
+	router.HandleFunc("GET /user-agent", handle.UserAgent)
 
-	// /echo/{str}
-	case strings.HasPrefix(req.Path, "/echo/"):
-		handle.Echo(req, res)
+	// /echo/{str}. Every non-empty body is compressed, however small, as clients of /echo expect it
+	router.Handle("GET /echo/{str...}", httpMessage.Compress(0)(httpMessage.HandlerFunc(handle.Echo)))
 
 	// /
-	case req.Path == "/":
+	router.HandleFunc("GET /", func(req *httpMessage.Request, res *httpMessage.Response) {
 		res.WithStatus(http.StatusOK)
+	})
 
-	// Default
-	default:
-		res.WithStatus(http.StatusNotFound)
-	}
-
+	return router
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	handle "github.com/codecrafters-io/http-server-starter-go/app/handlers"
+	httpMessage "github.com/codecrafters-io/http-server-starter-go/pkg/http"
+)
+
+// Parse the raw request and let the router of the default config answer it
+func serveTestRoute(t *testing.T, request string) *httpMessage.Response {
+	t.Helper()
+	req, err := httpMessage.ParseRequest(bufio.NewReader(strings.NewReader(request)))
+	if err != nil {
+		t.Fatalf("Failed to parse the request: %v", err)
+	}
+	config := defaultConfig()
+	config.LogRequests = false
+
+	res := httpMessage.CreateResponse()
+	newRouter(config, handle.NewTail()).ServeHTTP(req, res)
+	return res
+}
+
+func TestEchoCompressedOnce(t *testing.T) {
+	long := strings.Repeat("a", 2*httpMessage.DefaultMinCompressSize)
+
+	testCases := []struct {
+		name           string
+		str            string
+		acceptEncoding string
+		encoding       string
+	}{
+		{name: "Short string", str: "abc", acceptEncoding: "gzip", encoding: "gzip"},
+		{name: "Long string", str: long, acceptEncoding: "gzip", encoding: "gzip"},
+		{name: "Long string without accepted encoding", str: long, acceptEncoding: "identity", encoding: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serveTestRoute(t, "GET /echo/"+tc.str+" HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: "+tc.acceptEncoding+"\r\n\r\n")
+
+			if encoding, _ := res.Headers.Get("Content-Encoding"); encoding != tc.encoding {
+				t.Errorf("Expected Content-Encoding %q, but got %q", tc.encoding, encoding)
+			}
+			if vary := res.Headers.Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+				t.Errorf("Expected a single Vary: Accept-Encoding, but got %v", vary)
+			}
+		})
+	}
+}
@@ -1,84 +1,160 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	handle "github.com/codecrafters-io/http-server-starter-go/app/handlers"
 	"github.com/codecrafters-io/http-server-starter-go/pkg/http"
 )
 
 func main() {
-	// Bind to port 4221
-	l, err := net.Listen("tcp", "0.0.0.0:4221")
+	// Read the settings from the command line, the environment and the config file
+	config, err := loadConfig(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Println("Failed to bind to port 4221")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Invalid configuration: ", err.Error())
+		os.Exit(2)
 	}
-	defer l.Close()
 
-	// Accept connections
-	for {
-		conn, err := l.Accept()
+	// Open the directory served by /files/ and /static/ once, instead of on every request
+	if config.Directory != "" {
+		root, err := http.OpenRoot(config.Directory)
 		if err != nil {
-			fmt.Println("Error accepting connection: ", err.Error())
-			continue
+			fmt.Fprintln(os.Stderr, "Failed to open directory: ", err.Error())
+			os.Exit(1)
 		}
-
-		// Handle the connection in a new goroutine
-		// The loop then returns to accepting, so that
-		// multiple connections may be served concurrently
-		go handleConnection(conn)
+		handle.Directory = root
 	}
 
-}
+	// Let uploads create missing directories, unless told otherwise
+	handle.CreateDirectories = config.CreateDirectories
+
+	// Serve /files/ with an unknown extension as the configured media type, or sniff it if there is none
+	handle.FilesContentType = config.FilesContentType
 
-// handleConnection handles an incoming connection.
-// It parses the HTTP request, creates an HTTP response, routes the request,
-// and responds to the connection.
-func handleConnection(conn net.Conn) {
-	// Close the connection when the function returns
-	defer conn.Close()
-
-	// Setup a persistent connection until we get a "Connection: close" header or error
-	// This is a simple implementation of HTTP/1.1 persistent connections
-	for {
-		// Parse the HTTP Request from the connection
-		request := http.ParseRequest(conn)
-		if request == nil {
-			break // Break out of the persistent connection if request is nil
+	// Serve files with the configured media types
+	for ext, contentType := range config.MIMETypes {
+		if err := http.RegisterMIMEType(ext, contentType); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid --mime-type: ", err.Error())
+			os.Exit(2)
 		}
+	}
 
-		// Whether to close the connection or not
-		var shouldClose bool
-		// Close the connection if the `Connection: close` header was passed in
-		if val, ok := request.Headers.Get("Connection"); ok && val == "close" {
-			shouldClose = true
+	tail := handle.NewTail()
+	router := newRouter(config, tail)
+	var servers []*http.Server
+
+	// Serve HTTPS with the certificates, reloading them whenever they are renewed
+	if config.TLSEnabled() {
+		certificates := http.NewCertificates()
+		for i, certFile := range config.TLSCertFiles {
+			if err := certificates.Add(certFile, config.TLSKeyFiles[i]); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to load certificate: ", err.Error())
+				os.Exit(1)
+			}
+		}
+		if config.TLSReloadInterval > 0 {
+			go certificates.Watch(context.Background(), config.TLSReloadInterval)
 		}
 
-		// Print the request
-		fmt.Printf("Request:\n%+v\n", request)
+		server := newServer(config, config.TLSAddr, router)
+		server.TLSConfig = &tls.Config{GetCertificate: certificates.GetCertificate}
+		servers = append(servers, server)
+	}
 
-		// Create the HTTP Response
-		response := http.CreateResponse()
+	// Serve plain HTTP, or redirect it to HTTPS
+	if config.Addr != "" {
+		var handler http.Handler = router
+		if config.RedirectHTTP {
+			_, port, _ := net.SplitHostPort(config.TLSAddr)
+			handler = http.RedirectToHTTPS(port)
+		}
+		servers = append(servers, newServer(config, config.Addr, handler))
+	}
 
-		// Route the request based on the requested path
-		route(request, response)
+	// Streams of /tail/ are WebSockets, which the servers don't wait for, so they are told to close separately
+	for _, server := range servers {
+		server.RegisterOnShutdown(tail.Shutdown)
+	}
 
-		// Set the `Connection: close` header if the connection should be closed
-		if shouldClose {
-			response.Headers.Set("Connection", "close")
+	// Gracefully shut down the servers on SIGINT or SIGTERM,
+	// giving in-flight requests some time to finish
+	shutdownComplete := make(chan struct{})
+	go func() {
+		defer close(shutdownComplete)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		fmt.Println("Received", sig, "- shutting down")
+
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, server := range servers {
+			wg.Add(1)
+			go func(server *http.Server) {
+				defer wg.Done()
+				if err := server.Shutdown(ctx); err != nil {
+					fmt.Println("Failed to shut down gracefully: ", err.Error())
+				}
+			}(server)
 		}
+		wg.Wait()
 
-		// Print the response
-		fmt.Println("Response:\n", response.String())
+		// Give the streams of /tail/ the rest of the time to say goodbye to their clients
+		if err := tail.Wait(ctx); err != nil {
+			fmt.Println("Failed to close the /tail/ streams: ", err.Error())
+		}
+	}()
+
+	// Accept connections until the servers are shut down
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				err = fmt.Errorf("failed to serve on %s: %w", server.Addr, err)
+			}
+			errs <- err
+		}(server)
+	}
+	for range servers {
+		if err := <-errs; err != http.ErrServerClosed {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
 
-		// Respond to the connection
-		conn.Write(response.Bytes())
+	// Wait for the in-flight requests to finish
+	<-shutdownComplete
+}
 
-		// Close the connection if the `Connection: close` header was set
-		if shouldClose {
-			break
-		}
+// Configure a server to listen on the address and hand requests to the handler
+func newServer(config *Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		DisableHTTP2:      !config.HTTP2,
 	}
 }
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9112#section-7.1
+// --------------------------------------------------------------------------
+
+// The chunked transfer coding wraps the content in a series of chunks,
+// each prefixed by its size in hexadecimal, and terminates with a zero-sized chunk
+// that may be followed by trailer fields:
+//
+//	4\r\n
+//	Wiki\r\n
+//	5;name=value\r\n
+//	pedia\r\n
+//	0\r\n
+//	Expires: Wed, 21 Oct 2015 07:28:00 GMT\r\n
+//	\r\n
+
+// Returned when the chunk-size line of a chunked body cannot be parsed
+var errInvalidChunkSize = fmt.Errorf("%w: invalid chunk size", ErrMalformedChunkedBody)
+
+// Returned when the chunk-data is not followed by a CRLF
+var errMissingChunkCRLF = fmt.Errorf("%w: chunk data not terminated by CRLF", ErrMalformedChunkedBody)
+
+// Returned when a chunk-size line, including its extensions, is longer than maxChunkLineBytes
+var errChunkLineTooLong = fmt.Errorf("%w: chunk-size line too long", ErrMalformedChunkedBody)
+
+// The longest chunk-size line we accept. The size itself takes at most 16 hex digits,
+// so this leaves plenty of room for chunk extensions
+const maxChunkLineBytes = 4096
+
+// Checks if the given Headers declare the chunked transfer coding.
+// Chunked must always be the final transfer coding applied to a message.
+func isChunked(headers *Headers) bool {
+	transferEncoding, ok := headers.Get("Transfer-Encoding")
+	if !ok {
+		return false
+	}
+	codings := strings.Split(transferEncoding, ",")
+	last := strings.TrimSpace(codings[len(codings)-1])
+	return strings.EqualFold(last, "chunked")
+}
+
+// ------
+// READER
+// ------
+
+// chunkedReader decodes a body sent with the chunked transfer coding
+type chunkedReader struct {
+	reader       *bufio.Reader // The underlying reader positioned at the first chunk-size line
+	trailers     *Headers      // Trailer fields are added here once the last-chunk has been read, apart from the header section
+	trailerBytes int           // The number of bytes the trailer section may still take
+	remaining    int64         // Number of bytes left to read in the current chunk
+	err          error         // Sticky error. Set to io.EOF once the body is fully consumed
+}
+
+// Create a new chunkedReader that reads chunks from the given reader
+// and stores any trailer fields in the given headers, reading at most maxTrailerBytes of them
+func newChunkedReader(reader *bufio.Reader, trailers *Headers, maxTrailerBytes int) *chunkedReader {
+	return &chunkedReader{
+		reader:       reader,
+		trailers:     trailers,
+		trailerBytes: maxTrailerBytes,
+	}
+}
+
+// Read the decoded chunk-data into p
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	// Start a new chunk if the previous one has been fully consumed
+	if c.remaining == 0 {
+		size, err := c.readChunkSize()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+
+		// The last-chunk is followed by the (optional) trailer section
+		if size == 0 {
+			if err := c.readTrailers(); err != nil {
+				c.err = err
+				return 0, err
+			}
+			c.err = io.EOF
+			return 0, io.EOF
+		}
+
+		c.remaining = size
+	}
+
+	// Never read past the end of the current chunk
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+
+	// Consume the CRLF that terminates the chunk-data
+	if c.remaining == 0 && err == nil {
+		err = c.readCRLF()
+	}
+
+	// The body ended before the last-chunk was seen
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		c.err = err
+	}
+
+	return n, err
+}
+
+// Read a chunk-size line, discarding any chunk extensions.
+// See https://datatracker.ietf.org/doc/html/rfc9112#section-7.1.1
+func (c *chunkedReader) readChunkSize() (int64, error) {
+	remaining := maxChunkLineBytes
+	line, err := c.readLine(&remaining)
+	if err == ErrHeaderTooLarge {
+		return 0, errChunkLineTooLong
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Chunk extensions follow the size and are separated by a semicolon.
+	// We don't understand any extensions, so they are ignored.
+	sizeStr, _, _ := strings.Cut(line, ";")
+	sizeStr = strings.TrimSpace(sizeStr)
+
+	// The size is 1*HEXDIG, which ParseInt alone doesn't enforce (e.g. it accepts a sign or underscores)
+	if sizeStr == "" || strings.TrimLeft(sizeStr, "0123456789abcdefABCDEF") != "" {
+		return 0, errInvalidChunkSize
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil {
+		return 0, errInvalidChunkSize // Too large
+	}
+
+	return size, nil
+}
+
+// Read the trailer section until the empty line, adding each field to the trailers.
+// The whole section is limited like the header section, failing with ErrHeaderTooLarge.
+// See https://datatracker.ietf.org/doc/html/rfc9112#section-7.1.2
+func (c *chunkedReader) readTrailers() error {
+	for {
+		line, err := c.readLine(&c.trailerBytes)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil // Empty line terminates the trailer section
+		}
+		name, value, err := parseFieldLine(line)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedChunkedBody, err)
+		}
+		c.trailers.Add(name, value)
+	}
+}
+
+// Read the CRLF that follows the chunk-data
+func (c *chunkedReader) readCRLF() error {
+	remaining := len(CRLF)
+	line, err := c.readLine(&remaining)
+	if err == ErrHeaderTooLarge || err == nil && line != "" {
+		return errMissingChunkCRLF
+	}
+	return err
+}
+
+// Read a single line with the line terminator removed, failing with ErrHeaderTooLarge
+// once more than the remaining number of bytes have been read
+func (c *chunkedReader) readLine(remaining *int) (string, error) {
+	line, err := readLimitedLine(c.reader, remaining)
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, CRLF), nil
+}
+
+// ------
+// WRITER
+// ------
+
+// chunkedWriter encodes everything written to it using the chunked transfer coding.
+// Close must be called to write the last-chunk that terminates the body.
+type chunkedWriter struct {
+	writer io.Writer // The underlying writer that receives the encoded chunks
+}
+
+// Create a new chunkedWriter that writes chunks to the given writer
+func newChunkedWriter(w io.Writer) *chunkedWriter {
+	return &chunkedWriter{writer: w}
+}
+
+// Write p as a single chunk
+func (c *chunkedWriter) Write(p []byte) (int, error) {
+	// A zero-sized chunk would terminate the body, so skip empty writes
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.writer, "%x%s", len(p), CRLF); err != nil {
+		return 0, err
+	}
+	n, err := c.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if _, err := io.WriteString(c.writer, CRLF); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Write the last-chunk and the empty trailer section
+func (c *chunkedWriter) Close() error {
+	_, err := io.WriteString(c.writer, "0"+CRLF+CRLF)
+	return err
+}
+
+// Encode the body using the chunked transfer coding
+func encodeChunked(body string) string {
+	var sb strings.Builder
+	cw := newChunkedWriter(&sb)
+	cw.Write([]byte(body))
+	cw.Close()
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// ------
+// READER
+// ------
+
+func TestChunkedReader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		encoded  string
+		expected string
+	}{
+		{
+			name:     "Single chunk",
+			encoded:  "5\r\nHello\r\n0\r\n\r\n",
+			expected: "Hello",
+		},
+		{
+			name:     "Multiple chunks",
+			encoded:  "4\r\nWiki\r\n5\r\npedia\r\nE\r\n in\r\n\r\nchunks.\r\n0\r\n\r\n",
+			expected: "Wikipedia in\r\n\r\nchunks.",
+		},
+		{
+			name:     "Chunk extensions",
+			encoded:  "5;name=value\r\nHello\r\n7 ; ext\r\n, World\r\n0;last\r\n\r\n",
+			expected: "Hello, World",
+		},
+		{
+			name:     "Empty body",
+			encoded:  "0\r\n\r\n",
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newChunkedReader(bufio.NewReader(strings.NewReader(tc.encoded)), NewHeaders(), DefaultMaxHeaderBytes)
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if string(body) != tc.expected {
+				t.Errorf("Expected body %q, but got %q", tc.expected, string(body))
+			}
+		})
+	}
+}
+
+func TestChunkedReaderTrailers(t *testing.T) {
+	encoded := "5\r\nHello\r\n0\r\nExpires: Wed, 21 Oct 2015 07:28:00 GMT\r\nX-Checksum: abc123\r\n\r\n"
+
+	headers := NewHeaders()
+	reader := newChunkedReader(bufio.NewReader(strings.NewReader(encoded)), headers, DefaultMaxHeaderBytes)
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// Check if the trailer fields were added to the headers
+	expires, _ := headers.Get("Expires")
+	if expires != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Errorf("Expected trailer Expires: Wed, 21 Oct 2015 07:28:00 GMT, but got %s", expires)
+	}
+	checksum, _ := headers.Get("X-Checksum")
+	if checksum != "abc123" {
+		t.Errorf("Expected trailer X-Checksum: abc123, but got %s", checksum)
+	}
+}
+
+func TestChunkedReaderMalformed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		encoded string
+	}{
+		{
+			name:    "Invalid chunk size",
+			encoded: "xyz\r\nHello\r\n0\r\n\r\n",
+		},
+		{
+			name:    "Signed chunk size",
+			encoded: "+5\r\nHello\r\n0\r\n\r\n",
+		},
+		{
+			name:    "Negative chunk size",
+			encoded: "-0\r\n\r\n",
+		},
+		{
+			name:    "Empty chunk size",
+			encoded: "\r\nHello\r\n0\r\n\r\n",
+		},
+		{
+			name:    "Missing CRLF after chunk data",
+			encoded: "3\r\nHello\r\n0\r\n\r\n",
+		},
+		{
+			name:    "Missing last-chunk",
+			encoded: "5\r\nHello\r\n",
+		},
+		{
+			name:    "Truncated chunk data",
+			encoded: "A\r\nHello",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newChunkedReader(bufio.NewReader(strings.NewReader(tc.encoded)), NewHeaders(), DefaultMaxHeaderBytes)
+			if _, err := io.ReadAll(reader); err == nil {
+				t.Errorf("Expected an error, but got nil")
+			}
+		})
+	}
+}
+
+func TestChunkedReaderLimits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		encoded string
+		err     error
+	}{
+		{
+			name:    "Chunk-size line too long",
+			encoded: "5;" + strings.Repeat("x", 50000) + "\r\nHello\r\n0\r\n\r\n",
+			err:     ErrMalformedChunkedBody,
+		},
+		{
+			name:    "Chunk data longer than its size",
+			encoded: "5\r\nHello" + strings.Repeat("x", 50000) + "\r\n0\r\n\r\n",
+			err:     ErrMalformedChunkedBody,
+		},
+		{
+			name:    "Trailer section too large",
+			encoded: "5\r\nHello\r\n0\r\nX-One: " + strings.Repeat("a", 600) + "\r\nX-Two: " + strings.Repeat("b", 600) + "\r\n\r\n",
+			err:     ErrHeaderTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newChunkedReader(bufio.NewReader(strings.NewReader(tc.encoded)), NewHeaders(), 1024)
+			if _, err := io.ReadAll(reader); !errors.Is(err, tc.err) {
+				t.Errorf("Expected %v, but got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// ------
+// WRITER
+// ------
+
+func TestChunkedWriter(t *testing.T) {
+	var sb strings.Builder
+	writer := newChunkedWriter(&sb)
+
+	writer.Write([]byte("Wiki"))
+	writer.Write([]byte("")) // Empty writes must not terminate the body
+	writer.Write([]byte("pedia in chunks."))
+	writer.Close()
+
+	expected := "4\r\nWiki\r\n10\r\npedia in chunks.\r\n0\r\n\r\n"
+	if sb.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, sb.String())
+	}
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	body := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+
+	encoded := encodeChunked(body)
+	reader := newChunkedReader(bufio.NewReader(strings.NewReader(encoded)), NewHeaders(), DefaultMaxHeaderBytes)
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if string(decoded) != body {
+		t.Errorf("Expected the decoded body to match the original body")
+	}
+}
+
+// -------
+// MESSAGE
+// -------
+
+func TestParseMessageChunked(t *testing.T) {
+	message := strings.Join([]string{
+		"POST /files/hello.txt HTTP/1.1",
+		"Transfer-Encoding: chunked",
+		"",
+		"5",
+		"Hello",
+		"7",
+		", World",
+		"0",
+		"",
+		"",
+	}, CRLF)
+
+	http := createHTTPMessage().ParseMessage(message)
+
+	// Check if the body is decoded correctly
+	if http.content != "Hello, World" {
+		t.Errorf("Expected body Hello, World, but got %s", http.content)
+	}
+}
+
+func TestResponseChunkedEncoding(t *testing.T) {
+	response := CreateResponse().WithStatus(200)
+	response.WithBody("Hello, World")
+	response.WithChunkedEncoding()
+
+	expected := strings.Join([]string{
+		"HTTP/1.1 200 OK",
+		"Transfer-Encoding: chunked",
+		"",
+		"c",
+		"Hello, World",
+		"0",
+		"",
+		"",
+	}, CRLF)
+
+	if response.String() != expected {
+		t.Errorf("Expected string\n%q\n\nbut got\n%q", expected, response.String())
+	}
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9110#section-12.5.3
+// --------------------------------------------------------------------------
+
+// An Encoder wraps a writer so that everything written to it is compressed using a content-coding.
+// Closing the returned writer must flush any remaining compressed data, but not close the underlying writer.
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+// The registered content-codings, in order of preference
+var encoders = struct {
+	sync.RWMutex
+	names []string           // The names of the content-codings, in the order they were registered
+	funcs map[string]Encoder // The encoders by content-coding name
+}{
+	funcs: make(map[string]Encoder),
+}
+
+// Register the built-in content-codings
+func init() {
+	RegisterEncoder("gzip", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+	// The `deflate` content-coding is the zlib format, not raw deflate.
+	// See https://datatracker.ietf.org/doc/html/rfc9110#section-8.4.1.2
+	RegisterEncoder("deflate", func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	})
+}
+
+// Register an encoder for the content-coding with the given name (e.g. `br` or `zstd`), replacing any existing one.
+// When a client accepts several content-codings equally, the ones registered first are preferred.
+func RegisterEncoder(name string, encoder Encoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	name = strings.ToLower(name)
+	if _, exists := encoders.funcs[name]; !exists {
+		encoders.names = append(encoders.names, name)
+	}
+	encoders.funcs[name] = encoder
+}
+
+// ----------
+// MIDDLEWARE
+// ----------
+
+// A reasonable minSize for Compress. Smaller bodies barely shrink, and may even grow with the header of the coding
+const DefaultMinCompressSize = 1024
+
+// Compress returns a Middleware that compresses response bodies using the content-coding preferred by the client,
+// as negotiated from the `Accept-Encoding` header. Bodies smaller than minSize bytes are sent as is,
+// since compressing them would save little or nothing. Bodies that are already compressed are left alone.
+// When Compress is nested (e.g. around a route and around the whole router), only the innermost one applies.
+func Compress(minSize int64) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request, res *Response) {
+			next.ServeHTTP(req, res)
+
+			// The innermost Compress decides, so that a route can use another minSize than the whole router
+			if res.compressDecided {
+				return
+			}
+			res.compressDecided = true
+
+			if !isCompressible(res, minSize) {
+				return
+			}
+
+			// The response now depends on the Accept-Encoding of the request, so caches must take it into account
+			if vary, _ := res.Headers.Get("Vary"); !headerHasToken(vary, "Accept-Encoding") {
+				res.Headers.Add("Vary", "Accept-Encoding")
+			}
+
+			acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+			name, encoder := negotiateEncoding(acceptEncoding)
+			if encoder == nil {
+				return // The client doesn't accept any content-coding we support
+			}
+
+			if err := res.encodeBody(encoder); err != nil {
+				res.reset()
+				res.WithStatus(http.StatusInternalServerError)
+				return
+			}
+			res.Headers.Set("Content-Encoding", name)
+
+			// The encoded body is a different representation, with different bytes, than the one the entity-tag
+			// and byte ranges of the handler describe. A weak entity-tag still lets If-None-Match revalidate it,
+			// while If-Range and If-Match never take it for the identity representation.
+			// See https://datatracker.ietf.org/doc/html/rfc9110#section-8.8.3.3
+			if etag, ok := res.Headers.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+				res.Headers.Set("ETag", "W/"+etag)
+			}
+			res.Headers.Delete("Accept-Ranges")
+		})
+	}
+}
+
+// Checks if the body of the response is worth compressing
+func isCompressible(res *Response, minSize int64) bool {
+	// Only successful responses with a full body (e.g. not 204, 206 or 304)
+	if res.statusCode < 200 || res.statusCode == http.StatusNoContent ||
+		res.statusCode == http.StatusPartialContent || res.statusCode >= 300 && res.statusCode < 400 {
+		return false
+	}
+
+	// The body was already encoded by the handler
+	if res.Headers.Contains("Content-Encoding") {
+		return false
+	}
+
+	// Empty or tiny bodies. A streamed body of unknown size is assumed to be large
+	size := int64(len(res.content))
+	if res.bodyReader != nil {
+		size = res.contentLength
+	}
+	if size == 0 || (size > 0 && size < minSize) {
+		return false
+	}
+
+	// Formats that are compressed already gain nothing from another round
+	contentType, _ := res.Headers.Get("Content-Type")
+	return !isCompressedType(contentType)
+}
+
+// Checks if the media type is already compressed (e.g. images, video, archives)
+func isCompressedType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "image/svg+xml":
+		return false // SVG is text
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-bzip2", "application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed":
+		return true
+	}
+	return false
+}
+
+// Compress the body of the response with the encoder.
+// An in-memory body is compressed right away, so its length is still known.
+// A streamed body is compressed as it is written, and sent using the chunked transfer coding.
+func (r *Response) encodeBody(encoder Encoder) error {
+	if r.bodyReader != nil {
+		r.encoder = encoder
+		r.WithChunkedEncoding()
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w, err := encoder(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, r.content); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	r.content = buf.String()
+	r.Headers.Delete("Content-Length") // The length is recomputed when the response is written
+	return nil
+}
+
+// -----------
+// NEGOTIATION
+// -----------
+
+// Pick the registered content-coding the client prefers according to the `Accept-Encoding` header.
+// Returns a nil encoder if none is acceptable. See https://datatracker.ietf.org/doc/html/rfc9110#section-12.5.3
+func negotiateEncoding(acceptEncoding string) (string, Encoder) {
+	preferences := parseAcceptEncoding(acceptEncoding)
+
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	bestName, bestQ := "", 0.0
+	for _, name := range encoders.names {
+		q, listed := preferences[name]
+		if !listed {
+			q, listed = preferences["*"] // The wildcard covers every coding not listed explicitly
+		}
+		// Ties are won by the coding registered first
+		if listed && q > bestQ {
+			bestName, bestQ = name, q
+		}
+	}
+
+	if bestName == "" {
+		return "", nil
+	}
+	return bestName, encoders.funcs[bestName]
+}
+
+// Parse the `Accept-Encoding` header into the quality value of each content-coding (e.g. `gzip;q=0.8, br` -> {gzip: 0.8, br: 1})
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	preferences := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		// The quality value defaults to 1, and invalid ones are treated as 0 (not acceptable)
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		preferences[coding] = q
+	}
+	return preferences
+}
@@ -0,0 +1,291 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	preferences := parseAcceptEncoding("gzip;q=0.8, deflate, br ; q=0.5, identity;q=0, *;q=0.1, invalid;q=2")
+
+	expected := map[string]float64{
+		"gzip":     0.8,
+		"deflate":  1,
+		"br":       0.5,
+		"identity": 0,
+		"*":        0.1,
+		"invalid":  0,
+	}
+	for coding, q := range expected {
+		if preferences[coding] != q {
+			t.Errorf("Expected %s to have q=%v, but got %v", coding, q, preferences[coding])
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "gzip", expected: "gzip"},
+		{acceptEncoding: "deflate", expected: "deflate"},
+		{acceptEncoding: "GZIP", expected: "gzip"},
+		{acceptEncoding: "gzip, deflate", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0.5, deflate", expected: "deflate"},
+		{acceptEncoding: "invalid-encoding-1, gzip, invalid-encoding-2", expected: "gzip"},
+		{acceptEncoding: "*", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0, *", expected: "deflate"},
+		{acceptEncoding: "gzip;q=0", expected: ""},
+		{acceptEncoding: "br", expected: ""},
+		{acceptEncoding: "", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			name, encoder := negotiateEncoding(tc.acceptEncoding)
+			if name != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, name)
+			}
+			if (encoder == nil) != (tc.expected == "") {
+				t.Errorf("Expected an encoder only when a coding was chosen")
+			}
+		})
+	}
+}
+
+// Run the Compress middleware on a handler and return the response
+func compressTestResponse(minSize int64, acceptEncoding string, handler HandlerFunc) *Response {
+	req := createTestRequest("GET", "/")
+	if acceptEncoding != "" {
+		req.Headers.Set("Accept-Encoding", acceptEncoding)
+	}
+	res := CreateResponse()
+	Compress(minSize)(handler).ServeHTTP(req, res)
+	return res
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("Hello, World! ", 100)
+	res := compressTestResponse(256, "gzip", func(req *Request, res *Response) {
+		res.WithStatus(200).WithHeaders(map[string]string{"Content-Type": "text/plain"}).WithBody(body)
+	})
+
+	if encoding, _ := res.Headers.Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("Expected Content-Encoding: gzip, but got %s", encoding)
+	}
+	if vary, _ := res.Headers.Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, but got %s", vary)
+	}
+
+	// Check if the body decompresses to the original
+	reader, err := gzip.NewReader(strings.NewReader(res.content))
+	if err != nil {
+		t.Fatalf("Expected a gzip body, but got %v", err)
+	}
+	decompressed, _ := io.ReadAll(reader)
+	if string(decompressed) != body {
+		t.Errorf("Expected the decompressed body to match the original body")
+	}
+}
+
+func TestCompressValidators(t *testing.T) {
+	body := strings.Repeat("Hello, World! ", 100)
+	handler := func(req *Request, res *Response) {
+		res.WithStatus(200).WithHeaders(map[string]string{
+			"Content-Type":  "text/plain",
+			"ETag":          `"abc123"`,
+			"Accept-Ranges": "bytes",
+		}).WithBody(body)
+	}
+
+	testCases := []struct {
+		acceptEncoding string
+		etag           string
+		acceptRanges   bool
+	}{
+		{"", `"abc123"`, true},
+		{"gzip", `W/"abc123"`, false},
+	}
+
+	for _, tc := range testCases {
+		res := compressTestResponse(256, tc.acceptEncoding, handler)
+		// The entity-tag of the encoded body must differ from the identity one, so ranges and validators don't mix
+		if etag, _ := res.Headers.Get("ETag"); etag != tc.etag {
+			t.Errorf("Expected ETag %s with Accept-Encoding %q, but got %s", tc.etag, tc.acceptEncoding, etag)
+		}
+		if res.Headers.Contains("Accept-Ranges") != tc.acceptRanges {
+			t.Errorf("Expected Accept-Ranges to be set with Accept-Encoding %q: %v", tc.acceptEncoding, tc.acceptRanges)
+		}
+	}
+}
+
+func TestCompressNested(t *testing.T) {
+	handler := func(body string) HandlerFunc {
+		return func(req *Request, res *Response) {
+			res.WithStatus(200).WithHeaders(map[string]string{"Content-Type": "text/plain", "ETag": `"abc123"`}).WithBody(body)
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		body           string
+		acceptEncoding string
+		encoding       string
+		etag           string
+	}{
+		{name: "Small body compressed by the inner Compress", body: "hello", acceptEncoding: "gzip", encoding: "gzip", etag: `W/"abc123"`},
+		{name: "Large body compressed by the inner Compress", body: strings.Repeat("hello", 1000), acceptEncoding: "gzip", encoding: "gzip", etag: `W/"abc123"`},
+		{name: "Large body without accepted encoding", body: strings.Repeat("hello", 1000), etag: `"abc123"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestRequest("GET", "/")
+			if tc.acceptEncoding != "" {
+				req.Headers.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			res := CreateResponse()
+			Compress(DefaultMinCompressSize)(Compress(0)(handler(tc.body))).ServeHTTP(req, res)
+
+			// Only the inner Compress applies, so the headers are only changed once
+			if encoding, _ := res.Headers.Get("Content-Encoding"); encoding != tc.encoding {
+				t.Errorf("Expected Content-Encoding %q, but got %q", tc.encoding, encoding)
+			}
+			if vary := res.Headers.Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+				t.Errorf("Expected a single Vary: Accept-Encoding, but got %v", vary)
+			}
+			if etag, _ := res.Headers.Get("ETag"); etag != tc.etag {
+				t.Errorf("Expected ETag %s, but got %s", tc.etag, etag)
+			}
+		})
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	testCases := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		vary           bool
+	}{
+		{
+			name:           "Not accepted",
+			acceptEncoding: "",
+			contentType:    "text/plain",
+			body:           strings.Repeat("a", 1000),
+			vary:           true,
+		},
+		{
+			name:           "Tiny body",
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			body:           "tiny",
+			vary:           false,
+		},
+		{
+			name:           "Already compressed",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           strings.Repeat("a", 1000),
+			vary:           false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := compressTestResponse(256, tc.acceptEncoding, func(req *Request, res *Response) {
+				res.WithStatus(200).WithHeaders(map[string]string{"Content-Type": tc.contentType}).WithBody(tc.body)
+			})
+
+			if res.Headers.Contains("Content-Encoding") {
+				t.Errorf("Expected the body not to be compressed")
+			}
+			if res.content != tc.body {
+				t.Errorf("Expected the body to be unchanged")
+			}
+			if res.Headers.Contains("Vary") != tc.vary {
+				t.Errorf("Expected Vary to be set: %v", tc.vary)
+			}
+		})
+	}
+}
+
+func TestCompressStreamedBody(t *testing.T) {
+	body := strings.Repeat("Hello, World! ", 1000)
+	res := compressTestResponse(256, "deflate", func(req *Request, res *Response) {
+		res.WithStatus(200)
+		res.WithBodyReader(strings.NewReader(body), int64(len(body)))
+	})
+
+	if encoding, _ := res.Headers.Get("Content-Encoding"); encoding != "deflate" {
+		t.Fatalf("Expected Content-Encoding: deflate, but got %s", encoding)
+	}
+
+	var sb strings.Builder
+	if _, err := res.WriteTo(&sb); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// The compressed length isn't known upfront, so the body must be chunked
+	head, chunkedBody, _ := strings.Cut(sb.String(), CRLF+CRLF)
+	if strings.Contains(head, "Content-Length") {
+		t.Errorf("Expected no Content-Length, but got %s", head)
+	}
+	if !strings.Contains(head, "Transfer-Encoding: chunked") {
+		t.Errorf("Expected Transfer-Encoding: chunked, but got %s", head)
+	}
+
+	// Check if the body decompresses to the original
+	chunked := newChunkedReader(bufio.NewReader(strings.NewReader(chunkedBody)), NewHeaders(), DefaultMaxHeaderBytes)
+	zr, err := zlib.NewReader(chunked)
+	if err != nil {
+		t.Fatalf("Expected a zlib body, but got %v", err)
+	}
+	decompressed, _ := io.ReadAll(zr)
+	if string(decompressed) != body {
+		t.Errorf("Expected the decompressed body to match the original body")
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	// A fake content-coding that upper-cases the body
+	RegisterEncoder("x-upper", func(w io.Writer) (io.WriteCloser, error) {
+		return &upperWriter{w}, nil
+	})
+	t.Cleanup(func() {
+		encoders.Lock()
+		defer encoders.Unlock()
+		delete(encoders.funcs, "x-upper")
+		encoders.names = encoders.names[:len(encoders.names)-1]
+	})
+
+	res := compressTestResponse(0, "x-upper", func(req *Request, res *Response) {
+		res.WithStatus(200).WithBody("hello")
+	})
+
+	if encoding, _ := res.Headers.Get("Content-Encoding"); encoding != "x-upper" {
+		t.Errorf("Expected Content-Encoding: x-upper, but got %s", encoding)
+	}
+	if res.content != "HELLO" {
+		t.Errorf("Expected body HELLO, but got %s", res.content)
+	}
+}
+
+// upperWriter upper-cases everything written to it
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u *upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write([]byte(strings.ToUpper(string(p))))
+}
+
+func (u *upperWriter) Close() error {
+	return nil
+}
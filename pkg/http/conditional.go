@@ -0,0 +1,119 @@
+package http
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9110#section-13
+// --------------------------------------------------------------------------
+
+// Returns the entity-tag of a file, derived from its size and modification time (e.g. `"5f3a-17a0c3e2b1d"`).
+// It changes whenever the file is written, without having to hash its content on every request.
+func ETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// Set the `ETag` and `Last-Modified` headers of the response, leaving out the ones that are empty or zero
+func setValidators(res *Response, etag string, modTime time.Time) {
+	if etag != "" {
+		res.Headers.Set("ETag", etag)
+	}
+	if !modTime.IsZero() && modTime.Unix() != 0 {
+		res.Headers.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Evaluate the conditional headers of the request (`If-Match`, `If-Unmodified-Since`, `If-None-Match`
+// and `If-Modified-Since`) against the current entity-tag and modification time of the target resource.
+// Pass an empty etag if the resource doesn't exist (e.g. before it is created by a PUT).
+//
+// Returns 0 if the request should be processed, 304 Not Modified if the client's cached copy is still fresh,
+// or 412 Precondition Failed. See https://datatracker.ietf.org/doc/html/rfc9110#section-13.2.2 for the order
+// in which the headers are evaluated.
+func CheckPreconditions(req *Request, etag string, modTime time.Time) int {
+	// 1. If-Match, or else If-Unmodified-Since, protects against changing a resource someone else has modified
+	if ifMatch, ok := req.Headers.Get("If-Match"); ok {
+		if !matchesETag(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ifUnmodifiedSince, ok := req.Headers.Get("If-Unmodified-Since"); ok && etag != "" {
+		if date, err := http.ParseTime(ifUnmodifiedSince); err == nil && modTime.Truncate(time.Second).After(date) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	// 2. If-None-Match, or else If-Modified-Since, lets a client skip downloading what it already has
+	isRead := req.Method == "GET" || req.Method == "HEAD"
+	if ifNoneMatch, ok := req.Headers.Get("If-None-Match"); ok {
+		if matchesETag(ifNoneMatch, etag, false) {
+			if isRead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ifModifiedSince, ok := req.Headers.Get("If-Modified-Since"); ok && isRead && etag != "" {
+		if date, err := http.ParseTime(ifModifiedSince); err == nil && !modTime.Truncate(time.Second).After(date) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// Checks if the current entity-tag matches the list of entity-tags of a conditional header (e.g. `"a", W/"b"`).
+// The wildcard `*` matches any current representation. Strong comparison requires both tags to be strong,
+// while weak comparison ignores the `W/` prefix. See https://datatracker.ietf.org/doc/html/rfc9110#section-8.8.3.2
+func matchesETag(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false // There is no current representation
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	current, currentWeak := strings.CutPrefix(etag, "W/")
+	for _, tag := range parseETags(list) {
+		candidate, weak := strings.CutPrefix(tag, "W/")
+		if strong && (weak || currentWeak) {
+			continue
+		}
+		if candidate == current {
+			return true
+		}
+	}
+	return false
+}
+
+// Split a comma-separated list of entity-tags. Commas are allowed inside the quotes of a tag,
+// so the list can't simply be split on them. Malformed elements are skipped.
+func parseETags(list string) []string {
+	var tags []string
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return tags
+		}
+
+		// An optional weakness indicator, followed by the quoted opaque-tag
+		prefix := ""
+		if strings.HasPrefix(list, "W/") {
+			prefix, list = "W/", list[2:]
+		}
+		if !strings.HasPrefix(list, `"`) {
+			// Skip to the next element
+			_, list, _ = strings.Cut(list, ",")
+			continue
+		}
+		end := strings.IndexByte(list[1:], '"')
+		if end < 0 {
+			return tags // Unterminated tag
+		}
+		tags = append(tags, prefix+list[:end+2])
+		list = list[end+2:]
+	}
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseETags(t *testing.T) {
+	tags := parseETags(`"a", W/"b",,"c,d" , bogus, "e"`)
+	expected := []string{`"a"`, `W/"b"`, `"c,d"`, `"e"`}
+	if len(tags) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, tags)
+	}
+	for i := range tags {
+		if tags[i] != expected[i] {
+			t.Errorf("Expected %s, but got %s", expected[i], tags[i])
+		}
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	testCases := []struct {
+		list     string
+		etag     string
+		strong   bool
+		expected bool
+	}{
+		{list: `"a"`, etag: `"a"`, strong: true, expected: true},
+		{list: `"b", "a"`, etag: `"a"`, strong: true, expected: true},
+		{list: `"b"`, etag: `"a"`, strong: true, expected: false},
+		{list: `W/"a"`, etag: `"a"`, strong: true, expected: false},
+		{list: `W/"a"`, etag: `"a"`, strong: false, expected: true},
+		{list: `"a"`, etag: `W/"a"`, strong: false, expected: true},
+		{list: `*`, etag: `"a"`, strong: true, expected: true},
+		{list: `*`, etag: ``, strong: true, expected: false},
+		{list: `"a"`, etag: ``, strong: false, expected: false},
+	}
+
+	for _, tc := range testCases {
+		if matched := matchesETag(tc.list, tc.etag, tc.strong); matched != tc.expected {
+			t.Errorf("Expected %s to match %s (strong: %v): %v, but got %v", tc.list, tc.etag, tc.strong, tc.expected, matched)
+		}
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	etag := `"abc"`
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 500, time.UTC)
+	before := modTime.Add(-time.Hour).Format(http.TimeFormat)
+	at := modTime.Format(http.TimeFormat)
+
+	testCases := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		etag     string
+		expected int
+	}{
+		{name: "No conditions", method: "GET", headers: map[string]string{}, etag: etag, expected: 0},
+		{name: "If-None-Match matches", method: "GET", headers: map[string]string{"If-None-Match": `"abc"`}, etag: etag, expected: 304},
+		{name: "If-None-Match weak match", method: "HEAD", headers: map[string]string{"If-None-Match": `W/"abc"`}, etag: etag, expected: 304},
+		{name: "If-None-Match differs", method: "GET", headers: map[string]string{"If-None-Match": `"xyz"`}, etag: etag, expected: 0},
+		{name: "If-None-Match on a write", method: "PUT", headers: map[string]string{"If-None-Match": `*`}, etag: etag, expected: 412},
+		{name: "If-None-Match on a new resource", method: "PUT", headers: map[string]string{"If-None-Match": `*`}, etag: "", expected: 0},
+		{name: "If-Modified-Since not modified", method: "GET", headers: map[string]string{"If-Modified-Since": at}, etag: etag, expected: 304},
+		{name: "If-Modified-Since modified", method: "GET", headers: map[string]string{"If-Modified-Since": before}, etag: etag, expected: 0},
+		{name: "If-Modified-Since invalid date", method: "GET", headers: map[string]string{"If-Modified-Since": "yesterday"}, etag: etag, expected: 0},
+		{name: "If-Modified-Since ignored on a write", method: "POST", headers: map[string]string{"If-Modified-Since": at}, etag: etag, expected: 0},
+		{
+			name:     "If-None-Match takes precedence over If-Modified-Since",
+			method:   "GET",
+			headers:  map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": at},
+			etag:     etag,
+			expected: 0,
+		},
+		{name: "If-Match matches", method: "PUT", headers: map[string]string{"If-Match": `"abc"`}, etag: etag, expected: 0},
+		{name: "If-Match differs", method: "PUT", headers: map[string]string{"If-Match": `"xyz"`}, etag: etag, expected: 412},
+		{name: "If-Match weak", method: "PUT", headers: map[string]string{"If-Match": `W/"abc"`}, etag: etag, expected: 412},
+		{name: "If-Match wildcard", method: "PUT", headers: map[string]string{"If-Match": `*`}, etag: etag, expected: 0},
+		{name: "If-Match on a missing resource", method: "PUT", headers: map[string]string{"If-Match": `*`}, etag: "", expected: 412},
+		{name: "If-Unmodified-Since unmodified", method: "PUT", headers: map[string]string{"If-Unmodified-Since": at}, etag: etag, expected: 0},
+		{name: "If-Unmodified-Since modified", method: "PUT", headers: map[string]string{"If-Unmodified-Since": before}, etag: etag, expected: 412},
+		{
+			name:     "If-Match takes precedence over If-Unmodified-Since",
+			method:   "PUT",
+			headers:  map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before},
+			etag:     etag,
+			expected: 0,
+		},
+		{
+			name:     "If-Match is evaluated before If-None-Match",
+			method:   "GET",
+			headers:  map[string]string{"If-Match": `"xyz"`, "If-None-Match": `"abc"`},
+			etag:     etag,
+			expected: 412,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestRequest(tc.method, "/")
+			for name, value := range tc.headers {
+				req.Headers.Set(name, value)
+			}
+			if status := CheckPreconditions(req, tc.etag, modTime); status != tc.expected {
+				t.Errorf("Expected status %d, but got %d", tc.expected, status)
+			}
+		})
+	}
+}
+
+func TestServeFileConditional(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	root := createRangeTestRoot(t, modTime)
+	serve := HandlerFunc(func(req *Request, res *Response) {
+		ServeFile(req, res, root, "digits.txt")
+	})
+
+	// The first response carries the validators
+	res := serveTestRequest(t, serve, createTestRequest("GET", "/digits.txt"))
+	etag, ok := res.Headers.Get("ETag")
+	if !ok {
+		t.Fatalf("Expected an ETag")
+	}
+	if lastModified, _ := res.Headers.Get("Last-Modified"); lastModified != modTime.Format(http.TimeFormat) {
+		t.Errorf("Expected Last-Modified %s, but got %s", modTime.Format(http.TimeFormat), lastModified)
+	}
+
+	// Revalidating with them avoids downloading the file again
+	req := createTestRequest("GET", "/digits.txt")
+	req.Headers.Set("If-None-Match", etag)
+	res = serveTestRequest(t, serve, req)
+	if res.statusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304, but got %d", res.statusCode)
+	}
+	if res.content != "" {
+		t.Errorf("Expected no body, but got %q", res.content)
+	}
+	if got, _ := res.Headers.Get("ETag"); got != etag {
+		t.Errorf("Expected the 304 to carry the ETag %s, but got %s", etag, got)
+	}
+
+	// A range is only sent if the file is still the same
+	req = createTestRequest("GET", "/digits.txt")
+	req.Headers.Set("Range", "bytes=0-0")
+	req.Headers.Set("If-Range", etag)
+	res = serveTestRequest(t, serve, req)
+	if res.statusCode != http.StatusPartialContent {
+		t.Errorf("Expected status 206, but got %d", res.statusCode)
+	}
+
+	// A stale If-Match fails
+	req = createTestRequest("GET", "/digits.txt")
+	req.Headers.Set("If-Match", `"stale"`)
+	res = serveTestRequest(t, serve, req)
+	if res.statusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412, but got %d", res.statusCode)
+	}
+}
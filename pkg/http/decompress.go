@@ -0,0 +1,208 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9110#section-8.4
+// --------------------------------------------------------------------------
+
+// Returned while reading a decompressed request body that grows past the limit of the Decompress middleware
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// A Decoder wraps a reader of data compressed using a content-coding, so that reading from it yields the original data.
+// Closing the returned reader must not close the underlying reader.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// The registered content-codings that request bodies can be decoded from
+var decoders = struct {
+	sync.RWMutex
+	funcs map[string]Decoder // The decoders by content-coding name
+}{
+	funcs: make(map[string]Decoder),
+}
+
+// Register the built-in content-codings
+func init() {
+	RegisterDecoder("gzip", func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	})
+	// The `deflate` content-coding is the zlib format, not raw deflate
+	RegisterDecoder("deflate", func(r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	})
+}
+
+// Register a decoder for the content-coding with the given name (e.g. `br` or `zstd`), replacing any existing one
+func RegisterDecoder(name string, decoder Decoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.funcs[strings.ToLower(name)] = decoder
+}
+
+// Find the decoder of a content-coding. Returns nil if the coding is not supported
+func lookupDecoder(name string) Decoder {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	return decoders.funcs[strings.ToLower(name)]
+}
+
+// ----------
+// MIDDLEWARE
+// ----------
+
+// Decompress returns a Middleware that decodes request bodies sent with a `Content-Encoding` (e.g. gzip),
+// so that handlers always read the original content. Reading more than maxSize decompressed bytes
+// fails with ErrBodyTooLarge and the request is answered with 413 Content Too Large, which protects against
+// decompression bombs. A maxSize of zero or less means no limit.
+// Requests using a content-coding that is not supported are answered with 415 Unsupported Media Type.
+func Decompress(maxSize int64) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(req *Request, res *Response) {
+			codings := parseContentEncoding(req.Headers)
+			if len(codings) == 0 {
+				next.ServeHTTP(req, res)
+				return
+			}
+
+			// Every coding must be supported before the handler gets to see the request
+			for _, coding := range codings {
+				if lookupDecoder(coding) == nil {
+					res.WithStatus(http.StatusUnsupportedMediaType)
+					res.Headers.Set("Accept-Encoding", supportedDecodings()) // Tell the client what we do support
+					return
+				}
+			}
+
+			// Restore the raw body afterwards, so the server can discard whatever was not read without decoding it
+			raw := req.body
+			defer func() { req.body = raw }()
+
+			decoded := &decodedBody{raw: raw, codings: codings, remaining: maxSize, limited: maxSize > 0}
+			defer decoded.Close()
+			body := &bodyErrorRecorder{reader: decoded}
+			req.body = body
+
+			// The decoded body no longer matches these headers
+			req.Headers.Delete("Content-Encoding")
+			req.Headers.Delete("Content-Length")
+
+			next.ServeHTTP(req, res)
+
+			// Errors of the connection itself (e.g. timeouts) are handled by the server
+			if body.err == nil || statusForRequestError(body.err) != 0 {
+				return
+			}
+
+			// Discard whatever the handler made of a body that could not be decoded
+			res.reset()
+			if errors.Is(body.err, ErrBodyTooLarge) {
+				res.WithStatus(http.StatusRequestEntityTooLarge)
+			} else {
+				res.WithStatus(http.StatusBadRequest) // The body is not valid data of its content-coding
+			}
+		})
+	}
+}
+
+// Parse the content-codings applied to the body of a message, in the order they were applied.
+// The `identity` coding means no coding at all, and is left out.
+func parseContentEncoding(headers *Headers) []string {
+	var codings []string
+	for _, value := range headers.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
+
+// The content-codings that can be decoded, as a comma-separated list sorted by name
+func supportedDecodings() string {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	names := make([]string, 0, len(decoders.funcs))
+	for name := range decoders.funcs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// decodedBody reads a body through the decoders of its content-codings,
+// failing with ErrBodyTooLarge once more than the limit has been decoded
+type decodedBody struct {
+	raw       io.Reader   // The body as it was sent
+	codings   []string    // The content-codings in the order they were applied
+	reader    io.Reader   // The decoded body. Nil until the first read
+	closers   []io.Closer // The decoders to close once done
+	remaining int64       // Number of decoded bytes that may still be read
+	limited   bool        // Whether the decoded size is limited at all
+}
+
+// Read the decoded body into p
+func (d *decodedBody) Read(p []byte) (int, error) {
+	// The decoders read the header of their format right away, so only create them once the body is actually read
+	if d.reader == nil {
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.limited {
+		if d.remaining <= 0 {
+			// Only fail if there is in fact more data, a body of exactly the limit is fine
+			var probe [1]byte
+			if n, _ := d.reader.Read(probe[:]); n > 0 {
+				return 0, fmt.Errorf("%w: more than the limit once decoded", ErrBodyTooLarge)
+			}
+			return 0, io.EOF
+		}
+		if int64(len(p)) > d.remaining {
+			p = p[:d.remaining]
+		}
+	}
+
+	n, err := d.reader.Read(p)
+	d.remaining -= int64(n)
+	return n, err
+}
+
+// Stack the decoders of the content-codings, undoing the last one applied first
+func (d *decodedBody) open() error {
+	reader := d.raw
+	for i := len(d.codings) - 1; i >= 0; i-- {
+		decoder, err := lookupDecoder(d.codings[i])(reader)
+		if err == io.EOF {
+			return io.EOF // An empty body stays empty
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.codings[i], err)
+		}
+		d.closers = append(d.closers, decoder)
+		reader = decoder
+	}
+	d.reader = reader
+	return nil
+}
+
+// Close the decoders
+func (d *decodedBody) Close() error {
+	for _, closer := range d.closers {
+		closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Compress the data using gzip
+func gzipData(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatalf("Failed to compress the data: %v", err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+// Compress the data using zlib (the `deflate` content-coding)
+func deflateData(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatalf("Failed to compress the data: %v", err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+// Run the Decompress middleware on a request with the given body, and return the response
+// along with the body the handler read and the error it got reading it
+func decompressTestResponse(maxSize int64, contentEncoding, body string) (*Response, string, error) {
+	req := createTestRequest("POST", "/upload")
+	req.body = strings.NewReader(body)
+	if contentEncoding != "" {
+		req.Headers.Set("Content-Encoding", contentEncoding)
+	}
+
+	var read []byte
+	var readErr error
+	res := CreateResponse()
+	Decompress(maxSize)(HandlerFunc(func(req *Request, res *Response) {
+		read, readErr = io.ReadAll(req.BodyReader())
+		if readErr != nil {
+			res.WithStatus(http.StatusInternalServerError)
+			return
+		}
+		res.WithStatus(http.StatusCreated)
+	})).ServeHTTP(req, res)
+
+	return res, string(read), readErr
+}
+
+func TestDecompress(t *testing.T) {
+	original := strings.Repeat("Hello, World! ", 100)
+
+	testCases := []struct {
+		name            string
+		contentEncoding string
+		body            string
+	}{
+		{name: "No encoding", contentEncoding: "", body: original},
+		{name: "Identity", contentEncoding: "identity", body: original},
+		{name: "Gzip", contentEncoding: "gzip", body: gzipData(t, original)},
+		{name: "Deflate", contentEncoding: "deflate", body: deflateData(t, original)},
+		{name: "Upper case", contentEncoding: "GZIP", body: gzipData(t, original)},
+		{name: "Multiple codings", contentEncoding: "deflate, gzip", body: gzipData(t, deflateData(t, original))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, read, err := decompressTestResponse(1<<20, tc.contentEncoding, tc.body)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if read != original {
+				t.Errorf("Expected the handler to read the original body")
+			}
+			if res.statusCode != http.StatusCreated {
+				t.Errorf("Expected status %d, but got %d", http.StatusCreated, res.statusCode)
+			}
+		})
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	testCases := []struct {
+		name            string
+		maxSize         int64
+		contentEncoding string
+		body            string
+		expectedStatus  int
+	}{
+		{
+			name:            "Unsupported encoding",
+			maxSize:         1 << 20,
+			contentEncoding: "br",
+			body:            "whatever",
+			expectedStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:            "Corrupt body",
+			maxSize:         1 << 20,
+			contentEncoding: "gzip",
+			body:            "not gzip at all",
+			expectedStatus:  http.StatusBadRequest,
+		},
+		{
+			name:            "Truncated body",
+			maxSize:         1 << 20,
+			contentEncoding: "gzip",
+			body:            gzipData(t, strings.Repeat("a", 1000))[:20],
+			expectedStatus:  http.StatusBadRequest,
+		},
+		{
+			name:            "Decompression bomb",
+			maxSize:         1 << 10,
+			contentEncoding: "gzip",
+			body:            gzipData(t, strings.Repeat("a", 1<<20)),
+			expectedStatus:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, _, _ := decompressTestResponse(tc.maxSize, tc.contentEncoding, tc.body)
+			if res.statusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, but got %d", tc.expectedStatus, res.statusCode)
+			}
+		})
+	}
+}
+
+func TestDecompressExactlyMaxSize(t *testing.T) {
+	original := strings.Repeat("a", 1<<10)
+	res, read, err := decompressTestResponse(1<<10, "gzip", gzipData(t, original))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if read != original {
+		t.Errorf("Expected the handler to read the original body")
+	}
+	if res.statusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, but got %d", http.StatusCreated, res.statusCode)
+	}
+}
+
+func TestDecompressUnsupportedAdvertisesEncodings(t *testing.T) {
+	res, _, _ := decompressTestResponse(0, "br", "whatever")
+	if acceptEncoding, _ := res.Headers.Get("Accept-Encoding"); acceptEncoding != "deflate, gzip" {
+		t.Errorf("Expected Accept-Encoding: deflate, gzip, but got %s", acceptEncoding)
+	}
+}
+
+func TestDecompressServer(t *testing.T) {
+	original := strings.Repeat("Hello, World! ", 100)
+	router := NewRouter()
+	router.Use(Decompress(1 << 20))
+	router.HandleFunc("POST /upload", func(req *Request, res *Response) {
+		// Only read the start of the body
+		start := make([]byte, 5)
+		io.ReadFull(req.BodyReader(), start)
+		res.WithStatus(http.StatusOK).WithBody(string(start))
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	// The unread rest of the body must be discarded, so the next request on the connection still works
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+	compressed := gzipData(t, original)
+	for i := 0; i < 2; i++ {
+		request := "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: gzip\r\n" +
+			"Content-Length: " + strconv.Itoa(len(compressed)) + "\r\n\r\n" + compressed
+		if _, err := io.WriteString(conn, request); err != nil {
+			t.Fatalf("Failed to write the request: %v", err)
+		}
+		statusLine, _, body := readTestResponse(t, reader)
+		if !strings.Contains(statusLine, "200") {
+			t.Errorf("Expected status 200, but got %q", statusLine)
+		}
+		if body != "Hello" {
+			t.Errorf("Expected body Hello, but got %q", body)
+		}
+	}
+}
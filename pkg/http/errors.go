@@ -0,0 +1,40 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors returned by ParseRequest when the request is not valid HTTP/1.1.
+// They are usually wrapped with more detail, so use errors.Is to check for them.
+var (
+	ErrMalformedRequestLine        = errors.New("malformed request line")      // The request-line is not `method SP request-target SP HTTP-version`
+	ErrUnsupportedVersion          = errors.New("unsupported HTTP version")    // The HTTP-version is well-formed, but not HTTP/1.x
+	ErrInvalidHeader               = errors.New("invalid header field")        // A field line is not `field-name: field-value`
+	ErrHeaderTooLarge              = errors.New("request header too large")    // The request-line and header section exceed the limit
+	ErrInvalidContentLength        = errors.New("invalid Content-Length")      // The Content-Length is not a non-negative integer
+	ErrUnsupportedTransferEncoding = errors.New("unsupported transfer coding") // The body uses a transfer coding other than chunked
+	ErrMalformedChunkedBody        = errors.New("malformed chunked body")      // The chunked body does not follow the chunked transfer coding
+)
+
+// The status code to respond with when a request fails to parse with the given error.
+// Returns 0 if the error is not caused by an invalid request (e.g. the connection was closed).
+func statusForRequestError(err error) int {
+	switch {
+	case isTimeout(err):
+		return http.StatusRequestTimeout
+	case errors.Is(err, ErrUnsupportedVersion):
+		return http.StatusHTTPVersionNotSupported
+	case errors.Is(err, ErrHeaderTooLarge):
+		return http.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, ErrUnsupportedTransferEncoding):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrMalformedRequestLine),
+		errors.Is(err, ErrInvalidHeader),
+		errors.Is(err, ErrInvalidContentLength),
+		errors.Is(err, ErrMalformedChunkedBody):
+		return http.StatusBadRequest
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,287 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The file served in place of a directory listing, if the directory contains one
+const indexFile = "index.html"
+
+// FileServer is a Handler that serves the files of a Root, using the request path as the name of the file.
+//
+// Requests for a directory are answered with the `index.html` file inside it, or else with a listing of
+// the directory if Listings is enabled. The listing is rendered as HTML, or as JSON if the client accepts
+// `application/json`. Directories are only served at paths ending with a slash, so that relative links
+// resolve correctly, and requests without the trailing slash are redirected to it.
+//
+// To mount a FileServer under a prefix, wrap it with StripPrefix (e.g. `GET /static/{path...}`).
+type FileServer struct {
+	root     *Root // The directory whose files are served
+	Listings bool  // Whether to list the contents of directories without an index file
+}
+
+// Instantiate a new FileServer that serves the files of the root, without directory listings
+func NewFileServer(root *Root) *FileServer {
+	return &FileServer{root: root}
+}
+
+// Serve the file or directory named by the request path
+func (f *FileServer) ServeHTTP(req *Request, res *Response) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		res.WithStatus(http.StatusMethodNotAllowed).WithHeaders(map[string]string{
+			"Allow": "GET, HEAD",
+		})
+		return
+	}
+
+	// The request path, without the query string and percent-decoded
+	rawPath, query, _ := strings.Cut(req.Path, "?")
+	name, err := url.PathUnescape(rawPath)
+	if err != nil {
+		res.WithStatus(http.StatusBadRequest)
+		return
+	}
+
+	info, err := f.root.Stat(name)
+	if err != nil {
+		res.WithStatus(statusForFileError(err))
+		return
+	}
+
+	if !info.IsDir() {
+		// A trailing slash only makes sense for a directory
+		if strings.HasSuffix(name, "/") {
+			res.WithStatus(http.StatusNotFound)
+			return
+		}
+		ServeFile(req, res, f.root, name)
+		return
+	}
+
+	// Redirect `/dir` to `/dir/`. The location is relative, so it works no matter where the server is mounted
+	if !strings.HasSuffix(name, "/") {
+		location := url.PathEscape(path.Base(name)) + "/"
+		if query != "" {
+			location += "?" + query
+		}
+		res.WithStatus(http.StatusMovedPermanently).WithHeaders(map[string]string{
+			"Location": location,
+		})
+		return
+	}
+
+	// Serve the index file of the directory, if it has one
+	if index, err := f.root.Stat(name + indexFile); err == nil && !index.IsDir() {
+		ServeFile(req, res, f.root, name+indexFile)
+		return
+	}
+
+	if !f.Listings {
+		res.WithStatus(http.StatusForbidden)
+		return
+	}
+	f.serveListing(req, res, name)
+}
+
+// Serve the named regular file of the root. Directories are answered with 404 Not Found.
+// The `Content-Type` is derived from the extension of the file or else sniffed from its content, unless it was already set.
+// The response carries the `ETag` and `Last-Modified` of the file, and conditional requests are answered
+// with 304 Not Modified or 412 Precondition Failed when appropriate.
+// Requests with a `Range` header are answered with just the requested parts of the file.
+// The file is streamed to the connection and closed afterwards.
+func ServeFile(req *Request, res *Response, root *Root, name string) {
+	ServeFileWithFallbackType(req, res, root, name, "")
+}
+
+// Serve the named file like ServeFile, but with the fallbackType as the `Content-Type` of files whose extension
+// has no known media type, instead of sniffing their content (e.g. `application/octet-stream` to have them downloaded).
+// Responses that don't serve the file (e.g. 404 Not Found) don't get it. An empty fallbackType sniffs the content.
+func ServeFileWithFallbackType(req *Request, res *Response, root *Root, name string, fallbackType string) {
+	file, err := root.Open(name)
+	if err != nil {
+		res.WithStatus(statusForFileError(err))
+		return
+	}
+
+	// Get the size of the file to set the Content-Length
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		res.WithStatus(http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		file.Close()
+		res.WithStatus(http.StatusNotFound)
+		return
+	}
+
+	if !res.Headers.Contains("Content-Type") {
+		contentType := TypeByExtension(name)
+		if contentType == "" {
+			contentType = fallbackType
+		}
+		if contentType == "" {
+			contentType, err = DetectFileType(name, file)
+			if err != nil {
+				file.Close()
+				res.WithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
+		res.Headers.Set("Content-Type", contentType)
+	}
+
+	// Let clients know they may ask for parts of the file (e.g. to resume a download)
+	res.Headers.Set("Accept-Ranges", "bytes")
+
+	// Let clients revalidate their cached copy of the file instead of downloading it again
+	etag := ETag(info)
+	setValidators(res, etag, info.ModTime())
+	if status := CheckPreconditions(req, etag, info.ModTime()); status != 0 {
+		file.Close()
+		res.WithStatus(status)
+		return
+	}
+
+	if serveRanges(req, res, file, info, etag) {
+		return
+	}
+
+	res.WithStatus(http.StatusOK)
+	res.WithBodyReader(file, info.Size())
+}
+
+// The status code to respond with when a file of a Root could not be opened
+func statusForFileError(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidPath):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPathEscapesRoot), errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// --------
+// LISTINGS
+// --------
+
+// An entry of a directory listing
+type listingEntry struct {
+	Name     string    `json:"name"`     // The name of the entry, with a trailing slash for directories
+	Size     int64     `json:"size"`     // The size of the file in bytes, or 0 for directories
+	Dir      bool      `json:"dir"`      // Whether the entry is a directory
+	Modified time.Time `json:"modified"` // The time the entry was last modified
+}
+
+// The page rendered for an HTML directory listing
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<ul>
+{{- if ne .Path "/"}}
+<li><a href="../">../</a></li>
+{{- end}}
+{{- range .Entries}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// Serve a listing of the named directory, as JSON if the client accepts it and as HTML otherwise
+func (f *FileServer) serveListing(req *Request, res *Response, name string) {
+	entries, err := f.readDir(name)
+	if err != nil {
+		res.WithStatus(statusForFileError(err))
+		return
+	}
+
+	accept, _ := req.Headers.Get("Accept")
+	if strings.Contains(accept, "application/json") {
+		body, err := json.Marshal(entries)
+		if err != nil {
+			res.WithStatus(http.StatusInternalServerError)
+			return
+		}
+		res.WithStatus(http.StatusOK).WithHeaders(map[string]string{
+			"Content-Type": "application/json",
+		}).WithBody(string(body))
+		return
+	}
+
+	// Link to each entry relative to the directory
+	type link struct {
+		Name string
+		Href string
+	}
+	links := make([]link, len(entries))
+	for i, entry := range entries {
+		links[i] = link{Name: entry.Name, Href: url.PathEscape(strings.TrimSuffix(entry.Name, "/"))}
+		if entry.Dir {
+			links[i].Href += "/"
+		}
+	}
+
+	var sb strings.Builder
+	if err := listingTemplate.Execute(&sb, map[string]any{"Path": path.Clean("/" + name), "Entries": links}); err != nil {
+		res.WithStatus(http.StatusInternalServerError)
+		return
+	}
+	res.WithStatus(http.StatusOK).WithHeaders(map[string]string{
+		"Content-Type": "text/html; charset=utf-8",
+	}).WithBody(sb.String())
+}
+
+// Read the entries of the named directory, sorted by name
+func (f *FileServer) readDir(name string) ([]listingEntry, error) {
+	dir, err := f.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	dirEntries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]listingEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		// Follow symlinks through the root, leaving out the ones that escape it or are broken
+		info, err := f.root.Stat(name + dirEntry.Name())
+		if err != nil {
+			continue
+		}
+		entry := listingEntry{Name: dirEntry.Name(), Dir: info.IsDir(), Modified: info.ModTime().UTC()}
+		if entry.Dir {
+			entry.Name += "/"
+		} else {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+	}
+
+	// Unlike os.ReadDir, File.ReadDir returns the entries in directory order
+	slices.SortFunc(entries, func(a, b listingEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return entries, nil
+}
@@ -0,0 +1,254 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create a FileServer over a temporary directory with the given files.
+// Names ending with a slash are created as directories.
+func createTestFileServer(t *testing.T, files map[string]string) *FileServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatalf("Failed to open the root: %v", err)
+	}
+	return NewFileServer(root)
+}
+
+// Serve the request and return the response, with the streamed body read into Body
+func serveTestRequest(t *testing.T, handler Handler, req *Request) *Response {
+	t.Helper()
+
+	res := CreateResponse()
+	handler.ServeHTTP(req, res)
+	if res.bodyReader != nil {
+		body, err := io.ReadAll(res.bodyReader)
+		if err != nil {
+			t.Fatalf("Failed to read the body: %v", err)
+		}
+		if closer, ok := res.bodyReader.(io.Closer); ok {
+			closer.Close()
+		}
+		res.content = string(body)
+	}
+	return res
+}
+
+func TestFileServer(t *testing.T) {
+	fileServer := createTestFileServer(t, map[string]string{
+		"hello.txt":        "Hello, World!",
+		"hello world.txt":  "Spaces",
+		"site/index.html":  "<h1>Home</h1>",
+		"site/about.html":  "<h1>About</h1>",
+		"empty/":           "",
+		"nested/a/b/c.txt": "Deep",
+	})
+
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		body        string
+		contentType string
+		location    string
+	}{
+		{name: "File", method: "GET", path: "/hello.txt", status: 200, body: "Hello, World!", contentType: "text/plain; charset=utf-8"},
+		{name: "HEAD", method: "HEAD", path: "/hello.txt", status: 200, body: "Hello, World!"},
+		{name: "Percent-encoded name", method: "GET", path: "/hello%20world.txt", status: 200, body: "Spaces"},
+		{name: "Query string is ignored", method: "GET", path: "/hello.txt?v=1", status: 200, body: "Hello, World!"},
+		{name: "Nested file", method: "GET", path: "/nested/a/b/c.txt", status: 200, body: "Deep"},
+		{name: "HTML file", method: "GET", path: "/site/about.html", status: 200, body: "<h1>About</h1>", contentType: "text/html; charset=utf-8"},
+		{name: "Index file", method: "GET", path: "/site/", status: 200, body: "<h1>Home</h1>", contentType: "text/html; charset=utf-8"},
+		{name: "Directory redirect", method: "GET", path: "/site", status: 301, location: "site/"},
+		{name: "Directory redirect keeps the query", method: "GET", path: "/site?x=1", status: 301, location: "site/?x=1"},
+		{name: "No listings", method: "GET", path: "/empty/", status: 403},
+		{name: "Missing file", method: "GET", path: "/missing.txt", status: 404},
+		{name: "File with trailing slash", method: "GET", path: "/hello.txt/", status: 404},
+		{name: "Traversal", method: "GET", path: "/..%2F..%2Fetc%2Fpasswd", status: 403},
+		{name: "NUL byte", method: "GET", path: "/hello.txt%00", status: 400},
+		{name: "Invalid percent-encoding", method: "GET", path: "/%zz", status: 400},
+		{name: "Method not allowed", method: "POST", path: "/hello.txt", status: 405},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serveTestRequest(t, fileServer, createTestRequest(tc.method, tc.path))
+
+			if res.statusCode != tc.status {
+				t.Fatalf("Expected status %d, but got %d", tc.status, res.statusCode)
+			}
+			if tc.body != "" && res.content != tc.body {
+				t.Errorf("Expected body %q, but got %q", tc.body, res.content)
+			}
+			if contentType, _ := res.Headers.Get("Content-Type"); tc.contentType != "" && contentType != tc.contentType {
+				t.Errorf("Expected Content-Type %q, but got %q", tc.contentType, contentType)
+			}
+			if location, _ := res.Headers.Get("Location"); location != tc.location {
+				t.Errorf("Expected Location %q, but got %q", tc.location, location)
+			}
+		})
+	}
+}
+
+func TestServeFileWithFallbackType(t *testing.T) {
+	fileServer := createTestFileServer(t, map[string]string{
+		"notes.txt": "text",
+		"data":      "<html>sniffed as HTML</html>",
+	})
+
+	testCases := []struct {
+		name         string
+		fallbackType string
+		status       int
+		contentType  string
+	}{
+		{name: "data", fallbackType: "application/octet-stream", status: 200, contentType: "application/octet-stream"},
+		{name: "data", fallbackType: "", status: 200, contentType: "text/html; charset=utf-8"},
+		{name: "notes.txt", fallbackType: "application/octet-stream", status: 200, contentType: "text/plain; charset=utf-8"},
+		{name: "missing", fallbackType: "application/octet-stream", status: 404, contentType: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name+" "+tc.fallbackType, func(t *testing.T) {
+			handler := HandlerFunc(func(req *Request, res *Response) {
+				ServeFileWithFallbackType(req, res, fileServer.root, tc.name, tc.fallbackType)
+			})
+			res := serveTestRequest(t, handler, createTestRequest("GET", "/"+tc.name))
+			if res.statusCode != tc.status {
+				t.Errorf("Expected status %d, but got %d", tc.status, res.statusCode)
+			}
+			if contentType, _ := res.Headers.Get("Content-Type"); contentType != tc.contentType {
+				t.Errorf("Expected Content-Type %q, but got %q", tc.contentType, contentType)
+			}
+		})
+	}
+}
+
+func TestFileServerListings(t *testing.T) {
+	fileServer := createTestFileServer(t, map[string]string{
+		"b.txt":                "bb",
+		"a <script>.txt":       "a",
+		"docs/":                "",
+		".~upload-123.partial": "b being uploaded",
+		".session.tmp":         "not an upload",
+	})
+	fileServer.Listings = true
+
+	// HTML listing
+	res := serveTestRequest(t, fileServer, createTestRequest("GET", "/"))
+	if res.statusCode != 200 {
+		t.Fatalf("Expected status 200, but got %d", res.statusCode)
+	}
+	if contentType, _ := res.Headers.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Expected an HTML listing, but got %s", contentType)
+	}
+	for _, expected := range []string{
+		`<a href="a%20%3Cscript%3E.txt">a &lt;script&gt;.txt</a>`,
+		`<a href="b.txt">b.txt</a>`,
+		`<a href="docs/">docs/</a>`,
+	} {
+		if !strings.Contains(res.content, expected) {
+			t.Errorf("Expected the listing to contain %s, but got %s", expected, res.content)
+		}
+	}
+	if strings.Contains(res.content, `href="../"`) {
+		t.Errorf("Expected no parent link at the root")
+	}
+
+	// Sub-directories link back to their parent
+	res = serveTestRequest(t, fileServer, createTestRequest("GET", "/docs/"))
+	if !strings.Contains(res.content, `href="../"`) {
+		t.Errorf("Expected a parent link, but got %s", res.content)
+	}
+
+	// JSON listing
+	req := createTestRequest("GET", "/")
+	req.Headers.Set("Accept", "application/json")
+	res = serveTestRequest(t, fileServer, req)
+	if contentType, _ := res.Headers.Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("Expected a JSON listing, but got %s", contentType)
+	}
+	var entries []listingEntry
+	if err := json.Unmarshal([]byte(res.content), &entries); err != nil {
+		t.Fatalf("Failed to parse the listing: %v", err)
+	}
+	// The temporary file of an upload in progress is left out, but not other files that look temporary
+	expected := []listingEntry{
+		{Name: ".session.tmp", Size: 13},
+		{Name: "a <script>.txt", Size: 1},
+		{Name: "b.txt", Size: 2},
+		{Name: "docs/", Dir: true},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, but got %v", len(expected), entries)
+	}
+	for i, entry := range entries {
+		if entry.Name != expected[i].Name || entry.Size != expected[i].Size || entry.Dir != expected[i].Dir {
+			t.Errorf("Expected entry %+v, but got %+v", expected[i], entry)
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	var seen string
+	handler := StripPrefix("/static/", HandlerFunc(func(req *Request, res *Response) {
+		seen = req.Path
+		res.WithStatus(200)
+	}))
+
+	testCases := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{path: "/static/css/main.css", status: 200, expected: "/css/main.css"},
+		{path: "/static/", status: 200, expected: "/"},
+		{path: "/static", status: 200, expected: "/"},
+		{path: "/static?x=1", status: 200, expected: "/?x=1"},
+		{path: "/staticfile", status: 404},
+		{path: "/other/file", status: 404},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			seen = ""
+			req := createTestRequest("GET", tc.path)
+			res := CreateResponse()
+			handler.ServeHTTP(req, res)
+
+			if res.statusCode != tc.status {
+				t.Fatalf("Expected status %d, but got %d", tc.status, res.statusCode)
+			}
+			if seen != tc.expected {
+				t.Errorf("Expected the handler to see %q, but got %q", tc.expected, seen)
+			}
+			if req.Path != tc.path {
+				t.Errorf("Expected the path to be restored to %q, but got %q", tc.path, req.Path)
+			}
+		})
+	}
+}
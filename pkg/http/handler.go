@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A Handler responds to a HTTP Request by populating the HTTP Response
+type Handler interface {
+	ServeHTTP(req *Request, res *Response)
+}
+
+// HandlerFunc is an adapter that allows ordinary functions to be used as Handlers
+type HandlerFunc func(req *Request, res *Response)
+
+// Calls the function itself
+func (f HandlerFunc) ServeHTTP(req *Request, res *Response) {
+	f(req, res)
+}
+
+// A Middleware wraps a Handler to run code before and/or after it
+// (e.g. logging, authentication, compression, recovery)
+type Middleware func(next Handler) Handler
+
+// Wrap the handler with the given middlewares.
+// The first middleware is the outermost one, so it sees the request first and the response last.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// StripPrefix returns a Handler that removes the prefix from the request path before calling the handler
+// (e.g. `/static/css/main.css` -> `/css/main.css`), and answers 404 Not Found if the path lacks the prefix
+func StripPrefix(prefix string, handler Handler) Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return HandlerFunc(func(req *Request, res *Response) {
+		rest, found := strings.CutPrefix(req.Path, prefix)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "?")) {
+			res.WithStatus(http.StatusNotFound)
+			return
+		}
+
+		// The stripped path always starts with a slash
+		if !strings.HasPrefix(rest, "/") {
+			rest = "/" + rest
+		}
+
+		original := req.Path
+		req.Path = rest
+		defer func() { req.Path = original }()
+		handler.ServeHTTP(req, res)
+	})
+}
@@ -5,65 +5,166 @@ import (
 	"strings"
 )
 
-// Headers represents the headers of a HTTP Request/Response
+// Headers represents the headers of a HTTP Request/Response.
+// A field may have multiple values (e.g. `Set-Cookie`), and fields are kept in the order they were added,
+// so that serializing the headers is deterministic.
 type Headers struct {
-	hashmap map[string]string
+	fields  []*headerField          // The header fields in insertion order, including deleted ones
+	index   map[string]*headerField // The live header fields by their lookup key, for constant time access
+	deleted int                     // The number of deleted fields still in the fields slice
 }
 
-// Instantiate a new Headers object with an empty hashmap
+// A header field with all its values
+type headerField struct {
+	name   string   // The canonical name of the field (e.g. `Content-Type`)
+	values []string // The values of the field in the order they were added. Nil once deleted
+}
+
+// A single field line, as it appears on the wire
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Instantiate a new Headers object without any fields
 func NewHeaders() *Headers {
 	return &Headers{
-		hashmap: make(map[string]string),
+		index: make(map[string]*headerField),
 	}
 }
 
-// Set a header in the Headers object
+// Set a header in the Headers object, replacing any existing values
 func (h *Headers) Set(key, value string) {
-	h.hashmap[key] = value
+	if field := h.find(key); field != nil {
+		field.values = []string{value}
+		return
+	}
+	h.insert(key, value)
 }
 
-// Get a header from the Headers object
+// Add a value to a header in the Headers object, keeping any existing values
+func (h *Headers) Add(key, value string) {
+	if field := h.find(key); field != nil {
+		field.values = append(field.values, value)
+		return
+	}
+	h.insert(key, value)
+}
+
+// Get the first value of a header from the Headers object
 func (h *Headers) Get(key string) (string, bool) {
-	for k, v := range h.hashmap {
-		if strings.EqualFold(k, key) {
-			return v, true
-		}
+	if field := h.find(key); field != nil {
+		return field.values[0], true
 	}
 	return "", false
 }
 
+// Get all values of a header from the Headers object
+func (h *Headers) Values(key string) []string {
+	if field := h.find(key); field != nil {
+		return field.values
+	}
+	return nil
+}
+
 // Check if a header is present in the Headers object
 func (h *Headers) Contains(key string) bool {
-	_, found := h.Get(key)
-	return found
+	return h.find(key) != nil
 }
 
-// Delete a header from the Headers object
+// Delete a header and all its values from the Headers object
 func (h *Headers) Delete(key string) {
-	for k := range h.hashmap {
-		if strings.EqualFold(k, key) {
-			delete(h.hashmap, k)
-			return
-		}
+	field := h.find(key)
+	if field == nil {
+		return
+	}
+	delete(h.index, lookupKey(key))
+
+	// Leave a tombstone in the ordered slice instead of shifting every field after it,
+	// and only compact the slice once it is mostly tombstones
+	field.values = nil
+	h.deleted++
+	if h.deleted > len(h.fields)/2 {
+		h.compact()
 	}
 }
 
-// Returns the length of the Headers object
+// Returns the number of distinct header fields in the Headers object
 func (h *Headers) Len() int {
-	return len(h.hashmap)
+	return len(h.index)
 }
 
-// Enumerate the Headers object
-func (h *Headers) Enumerate() map[string]string {
-	return h.hashmap
+// Enumerate the field lines of the Headers object in insertion order.
+// A field with multiple values appears once per value.
+func (h *Headers) Enumerate() []HeaderField {
+	lines := make([]HeaderField, 0, len(h.fields))
+	for _, field := range h.fields {
+		for _, value := range field.values { // Deleted fields have no values
+			lines = append(lines, HeaderField{Name: field.name, Value: value})
+		}
+	}
+	return lines
 }
 
 // Convert the Headers object to a string
 func (h *Headers) String() string {
-	fieldLines := make([]string, 0, h.Len())
-	for key, value := range h.Enumerate() {
-		fieldLines = append(fieldLines, fmt.Sprintf("%s: %s", key, value))
+	var sb strings.Builder
+	for _, line := range h.Enumerate() {
+		// Each field line is terminated by a CRLF
+		sb.WriteString(fmt.Sprintf("%s: %s", line.Name, line.Value) + CRLF)
+	}
+	return sb.String()
+}
+
+// Find a header field by its case-insensitive name
+func (h *Headers) find(key string) *headerField {
+	return h.index[lookupKey(key)]
+}
+
+// Append a new header field with a single value
+func (h *Headers) insert(key, value string) {
+	if h.index == nil {
+		h.index = make(map[string]*headerField) // Support the zero value of Headers
+	}
+	field := &headerField{name: CanonicalHeaderKey(key), values: []string{value}}
+	h.fields = append(h.fields, field)
+	h.index[lookupKey(key)] = field
+}
+
+// Remove the tombstones of deleted fields from the ordered slice
+func (h *Headers) compact() {
+	live := make([]*headerField, 0, len(h.index))
+	for _, field := range h.fields {
+		if field.values != nil {
+			live = append(live, field)
+		}
+	}
+	h.fields = live
+	h.deleted = 0
+}
+
+// The key a header field is stored under. Field names are case-insensitive,
+// so all case variants of a name share the same key (e.g. `content-length` and `Content-Length`)
+func lookupKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// Returns the canonical form of a header field name, where the first letter and
+// any letter following a hyphen are upper case, and the rest are lower case (e.g. `content-type` -> `Content-Type`).
+// Names that are not valid tokens are returned unchanged.
+func CanonicalHeaderKey(name string) string {
+	if !isToken(name) {
+		return name
+	}
+	b := []byte(name)
+	upper := true // Whether the next letter should be upper case
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		} else if !upper && 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
 	}
-	// Add an extra CRLF to separate the headers from the body
-	return strings.Join(fieldLines, CRLF) + CRLF
+	return string(b)
 }
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHeadersAdd(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Set-Cookie", "id=a3fWa")
+	headers.Add("set-cookie", "lang=en")
+
+	// Check if both values are kept
+	values := headers.Values("Set-Cookie")
+	if len(values) != 2 || values[0] != "id=a3fWa" || values[1] != "lang=en" {
+		t.Errorf("Expected values [id=a3fWa lang=en], but got %v", values)
+	}
+
+	// Get returns the first value
+	value, _ := headers.Get("Set-Cookie")
+	if value != "id=a3fWa" {
+		t.Errorf("Expected value id=a3fWa, but got %s", value)
+	}
+
+	// Both values belong to the same field
+	if headers.Len() != 1 {
+		t.Errorf("Expected 1 header, but got %d", headers.Len())
+	}
+}
+
+func TestHeadersSet(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Vary", "Accept")
+	headers.Add("Vary", "Accept-Encoding")
+	headers.Set("Vary", "User-Agent")
+
+	// Set replaces all existing values
+	values := headers.Values("Vary")
+	if len(values) != 1 || values[0] != "User-Agent" {
+		t.Errorf("Expected values [User-Agent], but got %v", values)
+	}
+}
+
+func TestHeadersDelete(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Set-Cookie", "id=a3fWa")
+	headers.Add("Set-Cookie", "lang=en")
+	headers.Set("Content-Type", "text/plain")
+
+	headers.Delete("set-cookie")
+
+	if headers.Contains("Set-Cookie") {
+		t.Errorf("Expected Set-Cookie to be deleted")
+	}
+	if headers.Values("Set-Cookie") != nil {
+		t.Errorf("Expected no values, but got %v", headers.Values("Set-Cookie"))
+	}
+	if !headers.Contains("Content-Type") {
+		t.Errorf("Expected Content-Type to be kept")
+	}
+}
+
+func TestHeadersString(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("content-type", "text/html")
+	headers.Add("Set-Cookie", "id=a3fWa")
+	headers.Set("X-REQUEST-ID", "12345")
+	headers.Add("Set-Cookie", "lang=en")
+	headers.Set("Content-Type", "text/plain") // Replacing keeps the original position
+
+	expected := strings.Join([]string{
+		"Content-Type: text/plain",
+		"Set-Cookie: id=a3fWa",
+		"Set-Cookie: lang=en",
+		"X-Request-Id: 12345",
+		"",
+	}, CRLF)
+
+	// The output must be the same every time
+	for i := 0; i < 10; i++ {
+		if headers.String() != expected {
+			t.Fatalf("Expected string\n%q\n\nbut got\n%q", expected, headers.String())
+		}
+	}
+}
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "content-type", expected: "Content-Type"},
+		{name: "CONTENT-LENGTH", expected: "Content-Length"},
+		{name: "x-request-id", expected: "X-Request-Id"},
+		{name: "Host", expected: "Host"},
+		{name: "invalid name", expected: "invalid name"},
+	}
+
+	for _, tc := range testCases {
+		if key := CanonicalHeaderKey(tc.name); key != tc.expected {
+			t.Errorf("Expected %s to be canonicalized to %s, but got %s", tc.name, tc.expected, key)
+		}
+	}
+}
+
+func TestParseRequestRepeatedHeaders(t *testing.T) {
+	message := "GET / HTTP/1.1\r\nAccept: text/html\r\nAccept: application/json\r\n\r\n"
+
+	req, err := ParseRequest(bufio.NewReader(strings.NewReader(message)))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	values := req.Headers.Values("Accept")
+	if len(values) != 2 || values[0] != "text/html" || values[1] != "application/json" {
+		t.Errorf("Expected values [text/html application/json], but got %v", values)
+	}
+}
+
+func TestParseRequestConflictingContentLength(t *testing.T) {
+	message := "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nHello!"
+
+	_, err := ParseRequest(bufio.NewReader(strings.NewReader(message)))
+	if !errors.Is(err, ErrInvalidContentLength) {
+		t.Errorf("Expected error %v, but got %v", ErrInvalidContentLength, err)
+	}
+}
+
+func TestHeadersCaseVariants(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("content-length", "5")
+	headers.Set("Content-Length", "10")
+	headers.Set("CONTENT-LENGTH", "15")
+
+	// All case variants refer to the same field
+	if headers.Len() != 1 {
+		t.Errorf("Expected 1 header, but got %d", headers.Len())
+	}
+	expected := "Content-Length: 15" + CRLF
+	if headers.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, headers.String())
+	}
+}
+
+func TestHeadersDeleteAndReAdd(t *testing.T) {
+	headers := NewHeaders()
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		headers.Set(name, strings.ToLower(name))
+	}
+
+	// Delete enough fields to trigger compaction, then re-add one of them
+	headers.Delete("B")
+	headers.Delete("D")
+	headers.Delete("A")
+	headers.Set("B", "b2")
+
+	expected := strings.Join([]string{"C: c", "E: e", "B: b2", ""}, CRLF)
+	if headers.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, headers.String())
+	}
+	if headers.Len() != 3 {
+		t.Errorf("Expected 3 headers, but got %d", headers.Len())
+	}
+	if headers.Contains("A") || headers.Contains("D") {
+		t.Errorf("Expected deleted headers to be gone")
+	}
+}
+
+func BenchmarkHeadersGet(b *testing.B) {
+	headers := NewHeaders()
+	for i := 0; i < 50; i++ {
+		headers.Set("X-Field-"+strings.Repeat("x", i), "value")
+	}
+	headers.Set("Content-Type", "text/plain")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		headers.Get("content-type")
+	}
+}
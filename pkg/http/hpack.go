@@ -0,0 +1,559 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc7541
+// --------------------------------------------------------------------------
+
+// HPACK compresses the header fields of HTTP/2 messages. Each side of a connection keeps a dynamic table
+// of recently sent fields, so that repeated fields can be sent as a small index into the table.
+
+// Returned when a header block can't be decoded. The connection must be closed with COMPRESSION_ERROR,
+// as the dynamic tables of both sides are out of sync
+var errHPACK = errors.New("hpack: invalid header block")
+
+// Returned when a header block decodes to more than the maximum header list size.
+// The block was still decoded in full, so the dynamic table stays in sync and only the stream must be refused
+var errHPACKListTooLarge = errors.New("hpack: header list too large")
+
+// The size of the dynamic table both sides start with, until the decoder asks for another one
+const hpackDefaultTableSize = 4096
+
+// A header field of an HTTP/2 message. Names are lower-case, and pseudo-header fields start with a colon (e.g. `:path`)
+type hpackField struct {
+	name  string
+	value string
+}
+
+// The size of the field in the dynamic table, which includes an overhead for the entry itself.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-4.1
+func (f hpackField) size() uint32 {
+	return uint32(len(f.name) + len(f.value) + 32)
+}
+
+// The fields that are always in the table, at indices 1 to 61. See https://datatracker.ietf.org/doc/html/rfc7541#appendix-A
+var hpackStaticTable = []hpackField{
+	{":authority", ""}, {":method", "GET"}, {":method", "POST"}, {":path", "/"}, {":path", "/index.html"},
+	{":scheme", "http"}, {":scheme", "https"}, {":status", "200"}, {":status", "204"}, {":status", "206"},
+	{":status", "304"}, {":status", "400"}, {":status", "404"}, {":status", "500"}, {"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"}, {"accept-language", ""}, {"accept-ranges", ""}, {"accept", ""},
+	{"access-control-allow-origin", ""}, {"age", ""}, {"allow", ""}, {"authorization", ""},
+	{"cache-control", ""}, {"content-disposition", ""}, {"content-encoding", ""}, {"content-language", ""},
+	{"content-length", ""}, {"content-location", ""}, {"content-range", ""}, {"content-type", ""},
+	{"cookie", ""}, {"date", ""}, {"etag", ""}, {"expect", ""}, {"expires", ""}, {"from", ""}, {"host", ""},
+	{"if-match", ""}, {"if-modified-since", ""}, {"if-none-match", ""}, {"if-range", ""},
+	{"if-unmodified-since", ""}, {"last-modified", ""}, {"link", ""}, {"location", ""}, {"max-forwards", ""},
+	{"proxy-authenticate", ""}, {"proxy-authorization", ""}, {"range", ""}, {"referer", ""}, {"refresh", ""},
+	{"retry-after", ""}, {"server", ""}, {"set-cookie", ""}, {"strict-transport-security", ""},
+	{"transfer-encoding", ""}, {"user-agent", ""}, {"vary", ""}, {"via", ""}, {"www-authenticate", ""},
+}
+
+// The indices of the static table by field, and by name for the first field with that name
+var (
+	hpackStaticIndex     = map[hpackField]uint64{}
+	hpackStaticNameIndex = map[string]uint64{}
+)
+
+func init() {
+	for i, field := range hpackStaticTable {
+		hpackStaticIndex[field] = uint64(i + 1)
+		if _, ok := hpackStaticNameIndex[field.name]; !ok {
+			hpackStaticNameIndex[field.name] = uint64(i + 1)
+		}
+	}
+}
+
+// -------------
+// DYNAMIC TABLE
+// -------------
+
+// hpackTable is the dynamic table of a decoder or encoder. New fields are inserted at the lowest index (62),
+// and the oldest fields are evicted once the table grows over its maximum size.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-2.3.2
+type hpackTable struct {
+	fields  []hpackField // The fields, oldest first
+	size    uint32       // The sum of the sizes of the fields
+	maxSize uint32       // The size the table may grow to
+}
+
+// Insert the field at the start of the table, evicting as many old fields as needed to make room for it.
+// A field larger than the whole table empties it without being inserted.
+func (t *hpackTable) add(field hpackField) {
+	t.size += field.size()
+	t.fields = append(t.fields, field)
+	t.evict()
+}
+
+// Change the maximum size of the table, evicting fields that no longer fit
+func (t *hpackTable) setMaxSize(size uint32) {
+	t.maxSize = size
+	t.evict()
+}
+
+// Evict the oldest fields until the table fits in its maximum size
+func (t *hpackTable) evict() {
+	n := 0
+	for t.size > t.maxSize && n < len(t.fields) {
+		t.size -= t.fields[n].size()
+		n++
+	}
+	if n > 0 {
+		t.fields = append(t.fields[:0], t.fields[n:]...)
+	}
+}
+
+// Returns the field at the index, which counts the static table first and then the dynamic table from the newest field
+func (t *hpackTable) lookup(index uint64) (hpackField, bool) {
+	if index == 0 {
+		return hpackField{}, false
+	}
+	if index <= uint64(len(hpackStaticTable)) {
+		return hpackStaticTable[index-1], true
+	}
+	index -= uint64(len(hpackStaticTable)) + 1
+	if index >= uint64(len(t.fields)) {
+		return hpackField{}, false
+	}
+	return t.fields[len(t.fields)-1-int(index)], true
+}
+
+// Returns the index of the field in either table, and whether the value matches too, or 0 if not even the name is found
+func (t *hpackTable) search(field hpackField) (uint64, bool) {
+	if index, ok := hpackStaticIndex[field]; ok {
+		return index, true
+	}
+	nameIndex := hpackStaticNameIndex[field.name]
+	for i := len(t.fields) - 1; i >= 0; i-- {
+		index := uint64(len(hpackStaticTable) + len(t.fields) - i)
+		if t.fields[i] == field {
+			return index, true
+		}
+		if nameIndex == 0 && t.fields[i].name == field.name {
+			nameIndex = index
+		}
+	}
+	return nameIndex, false
+}
+
+// -------
+// DECODER
+// -------
+
+// hpackDecoder decodes the header blocks received on a connection
+type hpackDecoder struct {
+	table        hpackTable
+	maxTableSize uint32 // The largest table the encoder may ask for, as advertised in our SETTINGS
+	maxListSize  uint32 // The largest header list we accept, as advertised in our SETTINGS, or 0 for no limit
+}
+
+// Instantiate a decoder with the default table size
+func newHPACKDecoder() *hpackDecoder {
+	return &hpackDecoder{
+		table:        hpackTable{maxSize: hpackDefaultTableSize},
+		maxTableSize: hpackDefaultTableSize,
+	}
+}
+
+// Decode a complete header block into its fields.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-6
+func (d *hpackDecoder) decode(block []byte) ([]hpackField, error) {
+	var fields []hpackField
+	var listSize uint64
+	tooLarge := false
+
+	// Keep the field unless the list grew too large. A few indexed fields can expand to a large list,
+	// so the fields are dropped as soon as the limit is crossed instead of being collected first
+	emit := func(field hpackField) {
+		listSize += uint64(field.size())
+		if d.maxListSize > 0 && listSize > uint64(d.maxListSize) {
+			tooLarge, fields = true, nil
+		}
+		if !tooLarge {
+			fields = append(fields, field)
+		}
+	}
+
+	for len(block) > 0 {
+		b := block[0]
+		switch {
+		// Indexed Header Field: `1xxxxxxx`
+		case b&0x80 != 0:
+			index, rest, err := decodeHPACKInt(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			field, ok := d.table.lookup(index)
+			if !ok {
+				return nil, fmt.Errorf("%w: index %d out of range", errHPACK, index)
+			}
+			emit(field)
+			block = rest
+
+		// Literal Header Field with Incremental Indexing: `01xxxxxx`
+		case b&0xc0 == 0x40:
+			field, rest, err := d.decodeLiteral(block, 6)
+			if err != nil {
+				return nil, err
+			}
+			d.table.add(field)
+			emit(field)
+			block = rest
+
+		// Dynamic Table Size Update: `001xxxxx`, only allowed before the first field of a block
+		case b&0xe0 == 0x20:
+			if listSize > 0 {
+				return nil, fmt.Errorf("%w: table size update after a field", errHPACK)
+			}
+			size, rest, err := decodeHPACKInt(block, 5)
+			if err != nil {
+				return nil, err
+			}
+			if size > uint64(d.maxTableSize) {
+				return nil, fmt.Errorf("%w: table size %d over the limit", errHPACK, size)
+			}
+			d.table.setMaxSize(uint32(size))
+			block = rest
+
+		// Literal Header Field without Indexing `0000xxxx`, or Never Indexed `0001xxxx`
+		default:
+			field, rest, err := d.decodeLiteral(block, 4)
+			if err != nil {
+				return nil, err
+			}
+			emit(field)
+			block = rest
+		}
+	}
+	if tooLarge {
+		return nil, errHPACKListTooLarge
+	}
+	return fields, nil
+}
+
+// Decode a literal field, whose name is either indexed in the prefix or follows as a string, and whose value follows
+func (d *hpackDecoder) decodeLiteral(block []byte, prefix uint8) (hpackField, []byte, error) {
+	index, rest, err := decodeHPACKInt(block, prefix)
+	if err != nil {
+		return hpackField{}, nil, err
+	}
+
+	var field hpackField
+	if index > 0 {
+		indexed, ok := d.table.lookup(index)
+		if !ok {
+			return hpackField{}, nil, fmt.Errorf("%w: index %d out of range", errHPACK, index)
+		}
+		field.name = indexed.name
+	} else if field.name, rest, err = decodeHPACKString(rest); err != nil {
+		return hpackField{}, nil, err
+	}
+
+	if field.value, rest, err = decodeHPACKString(rest); err != nil {
+		return hpackField{}, nil, err
+	}
+	return field, rest, nil
+}
+
+// Decode an integer whose first byte holds the given number of bits.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-5.1
+func decodeHPACKInt(block []byte, prefix uint8) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, fmt.Errorf("%w: truncated integer", errHPACK)
+	}
+	max := uint64(1)<<prefix - 1
+	value := uint64(block[0]) & max
+	block = block[1:]
+	if value < max {
+		return value, block, nil
+	}
+
+	// The rest of the value follows in groups of 7 bits, least significant first
+	for shift := uint(0); len(block) > 0; shift += 7 {
+		if shift > 28 {
+			return 0, nil, fmt.Errorf("%w: integer too large", errHPACK)
+		}
+		b := block[0]
+		block = block[1:]
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, block, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: truncated integer", errHPACK)
+}
+
+// Decode a string literal, which is Huffman encoded if the high bit of its length is set.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-5.2
+func decodeHPACKString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, fmt.Errorf("%w: truncated string", errHPACK)
+	}
+	huffman := block[0]&0x80 != 0
+	length, rest, err := decodeHPACKInt(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(rest)) {
+		return "", nil, fmt.Errorf("%w: truncated string", errHPACK)
+	}
+
+	data, rest := rest[:length], rest[length:]
+	if !huffman {
+		return string(data), rest, nil
+	}
+	s, err := huffmanDecode(data)
+	return s, rest, err
+}
+
+// -------
+// ENCODER
+// -------
+
+// hpackEncoder encodes the header blocks sent on a connection
+type hpackEncoder struct {
+	table         hpackTable
+	pendingUpdate bool // Whether the table size changed, and the next block must tell the decoder
+}
+
+// Instantiate an encoder with the default table size
+func newHPACKEncoder() *hpackEncoder {
+	return &hpackEncoder{table: hpackTable{maxSize: hpackDefaultTableSize}}
+}
+
+// Fields that differ from one response to the next, so adding them to the table would only evict useful fields
+var hpackUnindexed = map[string]bool{
+	"content-length": true,
+	"content-range":  true,
+	"date":           true,
+	"etag":           true,
+	"last-modified":  true,
+	"location":       true,
+}
+
+// Fields that must never be added to a table, so they can't be guessed by an attacker probing its compression
+var hpackSensitive = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"set-cookie":          true,
+}
+
+// Apply the table size the decoder allows (SETTINGS_HEADER_TABLE_SIZE). The encoder never uses more than the default.
+func (e *hpackEncoder) setMaxTableSize(size uint32) {
+	size = min(size, hpackDefaultTableSize)
+	if size != e.table.maxSize {
+		e.table.setMaxSize(size)
+		e.pendingUpdate = true
+	}
+}
+
+// Encode the fields into a header block
+func (e *hpackEncoder) encode(fields []hpackField) []byte {
+	var block []byte
+	if e.pendingUpdate {
+		block = appendHPACKInt(block, 0x20, 5, uint64(e.table.maxSize))
+		e.pendingUpdate = false
+	}
+
+	for _, field := range fields {
+		index, exact := e.table.search(field)
+		switch {
+		case hpackSensitive[field.name]:
+			// Literal Header Field Never Indexed
+			block = e.appendLiteral(block, 0x10, 4, index, field)
+		case exact:
+			// Indexed Header Field
+			block = appendHPACKInt(block, 0x80, 7, index)
+		case hpackUnindexed[field.name] || field.size() > e.table.maxSize:
+			// Literal Header Field without Indexing
+			block = e.appendLiteral(block, 0x00, 4, index, field)
+		default:
+			// Literal Header Field with Incremental Indexing
+			block = e.appendLiteral(block, 0x40, 6, index, field)
+			e.table.add(field)
+		}
+	}
+	return block
+}
+
+// Append a literal field, referring to its name by index if it is in a table
+func (e *hpackEncoder) appendLiteral(block []byte, pattern byte, prefix uint8, nameIndex uint64, field hpackField) []byte {
+	block = appendHPACKInt(block, pattern, prefix, nameIndex)
+	if nameIndex == 0 {
+		block = appendHPACKString(block, field.name)
+	}
+	return appendHPACKString(block, field.value)
+}
+
+// Append an integer whose first byte holds the pattern in its high bits and the given number of bits of the value
+func appendHPACKInt(block []byte, pattern byte, prefix uint8, value uint64) []byte {
+	max := uint64(1)<<prefix - 1
+	if value < max {
+		return append(block, pattern|byte(value))
+	}
+	block = append(block, pattern|byte(max))
+	value -= max
+	for value >= 0x80 {
+		block = append(block, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(block, byte(value))
+}
+
+// Append a string literal, Huffman encoded if that makes it shorter
+func appendHPACKString(block []byte, s string) []byte {
+	if n := huffmanEncodedLen(s); n < len(s) {
+		block = appendHPACKInt(block, 0x80, 7, uint64(n))
+		return huffmanEncode(block, s)
+	}
+	block = appendHPACKInt(block, 0x00, 7, uint64(len(s)))
+	return append(block, s...)
+}
+
+// -------
+// HUFFMAN
+// -------
+
+// A node of the tree used to decode Huffman codes, one bit at a time
+type huffmanNode struct {
+	children [2]*huffmanNode
+	symbol   byte
+	leaf     bool
+}
+
+// The root of the Huffman decoding tree, built from the codes
+var huffmanRoot = buildHuffmanTree()
+
+// Build the decoding tree by inserting the code of every byte
+func buildHuffmanTree() *huffmanNode {
+	root := &huffmanNode{}
+	for symbol, code := range huffmanCodes {
+		node := root
+		for i := int(huffmanCodeLen[symbol]) - 1; i >= 0; i-- {
+			bit := (code >> uint(i)) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &huffmanNode{}
+			}
+			node = node.children[bit]
+		}
+		node.symbol = byte(symbol)
+		node.leaf = true
+	}
+	return root
+}
+
+// Decode a Huffman encoded string. The last byte is padded with the most significant bits of the EOS code,
+// which are all ones, and the padding must be shorter than a byte.
+// See https://datatracker.ietf.org/doc/html/rfc7541#section-5.2
+func huffmanDecode(data []byte) (string, error) {
+	out := make([]byte, 0, len(data)*8/5)
+	node := huffmanRoot
+	depth := 0      // The number of bits read since the last symbol
+	allOnes := true // Whether those bits are all ones, as the padding must be
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bit := (b >> uint(i)) & 1
+			node = node.children[bit]
+			if node == nil {
+				// Only the 30-bit EOS code is missing from the tree, and it must not appear in the string
+				return "", fmt.Errorf("%w: invalid Huffman code", errHPACK)
+			}
+			depth++
+			allOnes = allOnes && bit == 1
+			if node.leaf {
+				out = append(out, node.symbol)
+				node, depth, allOnes = huffmanRoot, 0, true
+			}
+		}
+	}
+	if depth >= 8 || !allOnes {
+		return "", fmt.Errorf("%w: invalid Huffman padding", errHPACK)
+	}
+	return string(out), nil
+}
+
+// The length of the string once Huffman encoded
+func huffmanEncodedLen(s string) int {
+	bits := 0
+	for i := 0; i < len(s); i++ {
+		bits += int(huffmanCodeLen[s[i]])
+	}
+	return (bits + 7) / 8
+}
+
+// Append the Huffman encoded string, padding the last byte with ones
+func huffmanEncode(block []byte, s string) []byte {
+	var acc uint64 // Bits waiting to be appended, in the low n bits
+	n := 0
+	for i := 0; i < len(s); i++ {
+		acc = acc<<huffmanCodeLen[s[i]] | uint64(huffmanCodes[s[i]])
+		n += int(huffmanCodeLen[s[i]])
+		for n >= 8 {
+			n -= 8
+			block = append(block, byte(acc>>uint(n)))
+		}
+	}
+	if n > 0 {
+		block = append(block, byte(acc<<uint(8-n))|byte(0xff>>uint(n)))
+	}
+	return block
+}
+
+// The Huffman code of each byte, aligned to the least significant bit. See https://datatracker.ietf.org/doc/html/rfc7541#appendix-B
+var huffmanCodes = [256]uint32{
+	0x1ff8, 0x7fffd8, 0xfffffe2, 0xfffffe3, 0xfffffe4, 0xfffffe5, 0xfffffe6, 0xfffffe7,
+	0xfffffe8, 0xffffea, 0x3ffffffc, 0xfffffe9, 0xfffffea, 0x3ffffffd, 0xfffffeb, 0xfffffec,
+	0xfffffed, 0xfffffee, 0xfffffef, 0xffffff0, 0xffffff1, 0xffffff2, 0x3ffffffe, 0xffffff3,
+	0xffffff4, 0xffffff5, 0xffffff6, 0xffffff7, 0xffffff8, 0xffffff9, 0xffffffa, 0xffffffb,
+	0x14, 0x3f8, 0x3f9, 0xffa, 0x1ff9, 0x15, 0xf8, 0x7fa,
+	0x3fa, 0x3fb, 0xf9, 0x7fb, 0xfa, 0x16, 0x17, 0x18,
+	0x0, 0x1, 0x2, 0x19, 0x1a, 0x1b, 0x1c, 0x1d,
+	0x1e, 0x1f, 0x5c, 0xfb, 0x7ffc, 0x20, 0xffb, 0x3fc,
+	0x1ffa, 0x21, 0x5d, 0x5e, 0x5f, 0x60, 0x61, 0x62,
+	0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a,
+	0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72,
+	0xfc, 0x73, 0xfd, 0x1ffb, 0x7fff0, 0x1ffc, 0x3ffc, 0x22,
+	0x7ffd, 0x3, 0x23, 0x4, 0x24, 0x5, 0x25, 0x26,
+	0x27, 0x6, 0x74, 0x75, 0x28, 0x29, 0x2a, 0x7,
+	0x2b, 0x76, 0x2c, 0x8, 0x9, 0x2d, 0x77, 0x78,
+	0x79, 0x7a, 0x7b, 0x7ffe, 0x7fc, 0x3ffd, 0x1ffd, 0xffffffc,
+	0xfffe6, 0x3fffd2, 0xfffe7, 0xfffe8, 0x3fffd3, 0x3fffd4, 0x3fffd5, 0x7fffd9,
+	0x3fffd6, 0x7fffda, 0x7fffdb, 0x7fffdc, 0x7fffdd, 0x7fffde, 0xffffeb, 0x7fffdf,
+	0xffffec, 0xffffed, 0x3fffd7, 0x7fffe0, 0xffffee, 0x7fffe1, 0x7fffe2, 0x7fffe3,
+	0x7fffe4, 0x1fffdc, 0x3fffd8, 0x7fffe5, 0x3fffd9, 0x7fffe6, 0x7fffe7, 0xffffef,
+	0x3fffda, 0x1fffdd, 0xfffe9, 0x3fffdb, 0x3fffdc, 0x7fffe8, 0x7fffe9, 0x1fffde,
+	0x7fffea, 0x3fffdd, 0x3fffde, 0xfffff0, 0x1fffdf, 0x3fffdf, 0x7fffeb, 0x7fffec,
+	0x1fffe0, 0x1fffe1, 0x3fffe0, 0x1fffe2, 0x7fffed, 0x3fffe1, 0x7fffee, 0x7fffef,
+	0xfffea, 0x3fffe2, 0x3fffe3, 0x3fffe4, 0x7ffff0, 0x3fffe5, 0x3fffe6, 0x7ffff1,
+	0x3ffffe0, 0x3ffffe1, 0xfffeb, 0x7fff1, 0x3fffe7, 0x7ffff2, 0x3fffe8, 0x1ffffec,
+	0x3ffffe2, 0x3ffffe3, 0x3ffffe4, 0x7ffffde, 0x7ffffdf, 0x3ffffe5, 0xfffff1, 0x1ffffed,
+	0x7fff2, 0x1fffe3, 0x3ffffe6, 0x7ffffe0, 0x7ffffe1, 0x3ffffe7, 0x7ffffe2, 0xfffff2,
+	0x1fffe4, 0x1fffe5, 0x3ffffe8, 0x3ffffe9, 0xffffffd, 0x7ffffe3, 0x7ffffe4, 0x7ffffe5,
+	0xfffec, 0xfffff3, 0xfffed, 0x1fffe6, 0x3fffe9, 0x1fffe7, 0x1fffe8, 0x7ffff3,
+	0x3fffea, 0x3fffeb, 0x1ffffee, 0x1ffffef, 0xfffff4, 0xfffff5, 0x3ffffea, 0x7ffff4,
+	0x3ffffeb, 0x7ffffe6, 0x3ffffec, 0x3ffffed, 0x7ffffe7, 0x7ffffe8, 0x7ffffe9, 0x7ffffea,
+	0x7ffffeb, 0xffffffe, 0x7ffffec, 0x7ffffed, 0x7ffffee, 0x7ffffef, 0x7fffff0, 0x3ffffee,
+}
+
+// The length in bits of the Huffman code of each byte
+var huffmanCodeLen = [256]uint8{
+	13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+	28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+	5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+	13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+	15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+	6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+	20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+	24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+	22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+	21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+	26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+	19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+	20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+	26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26,
+}
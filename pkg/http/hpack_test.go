@@ -0,0 +1,225 @@
+package http
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Decode a hex string with optional spaces, as the examples of RFC 7541 are written
+func decodeTestHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("Invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestHPACKInt(t *testing.T) {
+	// See https://datatracker.ietf.org/doc/html/rfc7541#appendix-C.1
+	tests := []struct {
+		value   uint64
+		prefix  uint8
+		encoded string
+	}{
+		{10, 5, "0a"},
+		{1337, 5, "1f9a0a"},
+		{42, 8, "2a"},
+		{31, 5, "1f00"},
+	}
+
+	for _, test := range tests {
+		encoded := appendHPACKInt(nil, 0, test.prefix, test.value)
+		if hex.EncodeToString(encoded) != test.encoded {
+			t.Errorf("Expected %d to encode to %s, but got %x", test.value, test.encoded, encoded)
+		}
+		value, rest, err := decodeHPACKInt(encoded, test.prefix)
+		if err != nil || value != test.value || len(rest) != 0 {
+			t.Errorf("Expected %s to decode to %d, but got %d (%v)", test.encoded, test.value, value, err)
+		}
+	}
+
+	// Overlong and truncated integers
+	for _, encoded := range []string{"1fffffffffffff", "1f80"} {
+		if _, _, err := decodeHPACKInt(decodeTestHex(t, encoded), 5); !errors.Is(err, errHPACK) {
+			t.Errorf("Expected an error decoding %s, but got %v", encoded, err)
+		}
+	}
+}
+
+func TestHPACKDecodeRequests(t *testing.T) {
+	// Three requests on the same connection, Huffman encoded. See https://datatracker.ietf.org/doc/html/rfc7541#appendix-C.4
+	decoder := newHPACKDecoder()
+	tests := []struct {
+		block    string
+		expected []hpackField
+	}{
+		{
+			"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff",
+			[]hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {":authority", "www.example.com"}},
+		},
+		{
+			"8286 84be 5886 a8eb 1064 9cbf",
+			[]hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {":authority", "www.example.com"}, {"cache-control", "no-cache"}},
+		},
+		{
+			"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf",
+			[]hpackField{{":method", "GET"}, {":scheme", "https"}, {":path", "/index.html"}, {":authority", "www.example.com"}, {"custom-key", "custom-value"}},
+		},
+	}
+
+	for i, test := range tests {
+		fields, err := decoder.decode(decodeTestHex(t, test.block))
+		if err != nil {
+			t.Fatalf("Expected request %d to decode, but got %v", i+1, err)
+		}
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("Expected request %d to decode to %v, but got %v", i+1, test.expected, fields)
+		}
+	}
+
+	// The dynamic table holds the literal fields, newest first
+	expectedTable := []hpackField{{":authority", "www.example.com"}, {"cache-control", "no-cache"}, {"custom-key", "custom-value"}}
+	if !reflect.DeepEqual(decoder.table.fields, expectedTable) || decoder.table.size != 164 {
+		t.Errorf("Expected the table %v of size 164, but got %v of size %d", expectedTable, decoder.table.fields, decoder.table.size)
+	}
+}
+
+func TestHPACKDecodeEviction(t *testing.T) {
+	// Responses with a table of 256 bytes, which forces evictions. See https://datatracker.ietf.org/doc/html/rfc7541#appendix-C.5
+	decoder := newHPACKDecoder()
+	decoder.table.setMaxSize(256)
+
+	blocks := []string{
+		"4803 3330 3258 0770 7269 7661 7465 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3120 474d 546e 1768 7474 7073 3a2f 2f77 7777 2e65 7861 6d70 6c65 2e63 6f6d",
+		"4803 3330 37c1 c0bf",
+	}
+	for _, block := range blocks {
+		if _, err := decoder.decode(decodeTestHex(t, block)); err != nil {
+			t.Fatalf("Expected the block to decode, but got %v", err)
+		}
+	}
+
+	// `:status: 302` was evicted to make room for `:status: 307`
+	expected := []hpackField{{"cache-control", "private"}, {"date", "Mon, 21 Oct 2013 20:13:21 GMT"}, {"location", "https://www.example.com"}, {":status", "307"}}
+	if !reflect.DeepEqual(decoder.table.fields, expected) || decoder.table.size != 222 {
+		t.Errorf("Expected the table %v of size 222, but got %v of size %d", expected, decoder.table.fields, decoder.table.size)
+	}
+}
+
+func TestHPACKDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+	}{
+		{"index 0", "80"},
+		{"index out of range", "be"},
+		{"truncated string", "4005 6162"},
+		{"EOS padding too long", "4003 6162 6381 ff"},
+		{"padding not all ones", "4003 6162 6381 00"},
+		{"table size over the limit", "3fe21f"},
+		{"table size update after a field", "82 20"},
+	}
+
+	for _, test := range tests {
+		if _, err := newHPACKDecoder().decode(decodeTestHex(t, test.block)); !errors.Is(err, errHPACK) {
+			t.Errorf("Expected an error for %s, but got %v", test.name, err)
+		}
+	}
+}
+
+func TestHPACKDecodeListSize(t *testing.T) {
+	encoder := newHPACKEncoder()
+	decoder := newHPACKDecoder()
+	decoder.maxListSize = 100
+
+	big := hpackField{"x-big", strings.Repeat("a", 50)} // 87 bytes in the list
+	small := hpackField{"x-small", "b"}                 // 40 bytes in the list
+
+	// The field fits on its own, and then takes a single byte to repeat
+	if _, err := decoder.decode(encoder.encode([]hpackField{big})); err != nil {
+		t.Fatalf("Expected the block to decode, but got %v", err)
+	}
+	block := encoder.encode([]hpackField{big, big, small})
+	if len(block) > 20 {
+		t.Fatalf("Expected the repeated field to be indexed, but got a block of %d bytes", len(block))
+	}
+	if fields, err := decoder.decode(block); !errors.Is(err, errHPACKListTooLarge) || fields != nil {
+		t.Fatalf("Expected errHPACKListTooLarge without fields, but got %v and %v", err, fields)
+	}
+
+	// The block was decoded in full, so the field it added to the table can be referred to
+	fields, err := decoder.decode(encoder.encode([]hpackField{small}))
+	if err != nil {
+		t.Fatalf("Expected the block to decode, but got %v", err)
+	}
+	if !reflect.DeepEqual(fields, []hpackField{small}) {
+		t.Errorf("Expected %v, but got %v", []hpackField{small}, fields)
+	}
+}
+
+func TestHPACKRoundTrip(t *testing.T) {
+	encoder := newHPACKEncoder()
+	decoder := newHPACKDecoder()
+
+	responses := [][]hpackField{
+		{{":status", "200"}, {"content-type", "text/plain"}, {"content-length", "13"}, {"server", ServerName}},
+		{{":status", "404"}, {"content-type", "text/plain"}, {"set-cookie", "session=secret"}, {"server", ServerName}},
+		{{":status", "200"}, {"x-custom", strings.Repeat("a", 5000)}, {"server", ServerName}}, // Too large for the table
+	}
+
+	var sizes []int
+	for _, fields := range responses {
+		block := encoder.encode(fields)
+		sizes = append(sizes, len(block))
+		decoded, err := decoder.decode(block)
+		if err != nil {
+			t.Fatalf("Expected the block to decode, but got %v", err)
+		}
+		if !reflect.DeepEqual(decoded, fields) {
+			t.Errorf("Expected %v, but got %v", fields, decoded)
+		}
+	}
+
+	// Fields repeated from the first response are sent as indices
+	if sizes[1] >= sizes[0] {
+		t.Errorf("Expected the second block to be smaller than the first, but got %d and %d bytes", sizes[1], sizes[0])
+	}
+	// Sensitive fields never enter the table
+	for _, field := range encoder.table.fields {
+		if field.name == "set-cookie" {
+			t.Errorf("Expected set-cookie not to be indexed")
+		}
+	}
+
+	// A smaller table size is announced at the start of the next block
+	encoder.setMaxTableSize(0)
+	decoder.maxTableSize = 0
+	if _, err := decoder.decode(encoder.encode(responses[0])); err != nil {
+		t.Fatalf("Expected the block to decode, but got %v", err)
+	}
+	if len(decoder.table.fields) != 0 {
+		t.Errorf("Expected the table to be emptied, but got %v", decoder.table.fields)
+	}
+}
+
+func TestHuffman(t *testing.T) {
+	for _, s := range []string{"", "www.example.com", "no-cache", "Mon, 21 Oct 2013 20:13:21 GMT", "\x00\xff binary \x7f"} {
+		encoded := huffmanEncode(nil, s)
+		if len(encoded) != huffmanEncodedLen(s) {
+			t.Errorf("Expected %q to encode to %d bytes, but got %d", s, huffmanEncodedLen(s), len(encoded))
+		}
+		decoded, err := huffmanDecode(encoded)
+		if err != nil || decoded != s {
+			t.Errorf("Expected %q to round trip, but got %q (%v)", s, decoded, err)
+		}
+	}
+
+	// See https://datatracker.ietf.org/doc/html/rfc7541#appendix-C.4.1
+	if encoded := hex.EncodeToString(huffmanEncode(nil, "www.example.com")); encoded != "f1e3c2e5f23a6ba0ab90f4ff" {
+		t.Errorf("Expected f1e3c2e5f23a6ba0ab90f4ff, but got %s", encoded)
+	}
+}
@@ -1,6 +1,9 @@
 package http
 
 import (
+	"bufio"
+	"io"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -20,7 +23,7 @@ type HTTPMessage struct {
 
 	StartLine string   // The first line of the HTTP Request/Response
 	Headers   *Headers // The heeders of the HTTP Request/Response
-	Body      string   // The body of the HTTP Request/Response
+	content   string   // The in-memory body, set by WithBody or ParseMessage. Parsed requests stream theirs with BodyReader instead
 
 	separator string // The sequence of characters that separate the startLine, headers and the body
 }
@@ -40,17 +43,23 @@ func (r *HTTPMessage) WithStartLine(startLine string) *HTTPMessage {
 	return r
 }
 
-// Set the headers of the HTTP Request/Response Message
+// Set the headers of the HTTP Request/Response Message.
+// New fields are added in sorted order, as maps have no order of their own.
 func (r *HTTPMessage) WithHeaders(headers map[string]string) *HTTPMessage {
-	for key, value := range headers {
-		r.Headers.Set(key, value)
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		r.Headers.Set(key, headers[key])
 	}
 	return r
 }
 
 // Set the body of the HTTP Request/Response Message
 func (r *HTTPMessage) WithBody(b string) *HTTPMessage {
-	r.Body = b
+	r.content = b
 	return r
 }
 
@@ -63,12 +72,25 @@ func (r *HTTPMessage) ParseMessage(message string) *HTTPMessage {
 	r.StartLine = s[0]
 
 	// Read each header field line into a hash table by field name until the empty line
-	for _, line := range s[1:] {
+	bodyStart := len(s)
+	for i, line := range s[1:] {
 		if line == "" {
-			break // Stop when an empty line is encountered
+			bodyStart = i + 2 // The body starts after the empty line
+			break             // Stop when an empty line is encountered
 		}
 		parts := strings.Split(line, ": ") // Split the line into field-value pairs
-		r.Headers.Set(parts[0], parts[1])  // Add the field-value pair to the headers
+		r.Headers.Add(parts[0], parts[1])  // Add the field-value pair to the headers
+	}
+
+	// Decode the body if it was sent using the chunked transfer coding
+	if isChunked(r.Headers) && bodyStart < len(s) {
+		rest := strings.Join(s[bodyStart:], r.separator)
+		body, err := io.ReadAll(newChunkedReader(bufio.NewReader(strings.NewReader(rest)), r.Headers, DefaultMaxHeaderBytes))
+		if err != nil {
+			return r
+		}
+		r.content = string(body)
+		return r
 	}
 
 	// Get the Content-Length header
@@ -83,25 +105,23 @@ func (r *HTTPMessage) ParseMessage(message string) *HTTPMessage {
 	}
 
 	// The body is the last part of the message and is of length Content-Length
-	r.Body = s[len(s)-1][:contentLength]
+	r.content = s[len(s)-1][:contentLength]
 
 	return r
 }
 
+// The start-line and header section of the HTTP Request/Response, terminated by the empty line
+func (r *HTTPMessage) head() string {
+	return r.StartLine + r.separator + r.Headers.String() + r.separator
+}
+
 // The string representation of the HTTP Request/Response
 func (r *HTTPMessage) String() string {
-	// If the body is empty, return the startLine and headers only
-	if r.Body == "" || r.Body == CRLF {
-		return strings.Join([]string{
-			r.StartLine,
-			r.Headers.String(),
-		}, r.separator)
+	// Encode the body in chunks if the chunked transfer coding was requested
+	if isChunked(r.Headers) {
+		return r.head() + encodeChunked(r.content)
 	}
-	return strings.Join([]string{
-		r.StartLine,
-		r.Headers.String(),
-		r.Body,
-	}, r.separator)
+	return r.head() + r.content
 }
 
 // The byte-array representation of the HTTP Request/Response
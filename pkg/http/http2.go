@@ -0,0 +1,1178 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9113
+// --------------------------------------------------------------------------
+
+// HTTP/2 sends the same requests and responses as HTTP/1.1, but as frames of concurrent streams on a single connection.
+// The server speaks it when the client asks for `h2` during the TLS handshake (ALPN), and over cleartext (h2c)
+// when the client starts the connection with the HTTP/2 preface or asks to upgrade an HTTP/1.1 request.
+// Every stream is handed to the same Handler as an HTTP/1.1 request would be.
+
+// The settings the server advertises to clients
+const (
+	http2MaxConcurrentStreams = 250       // How many streams a client may have open at once
+	http2StreamWindowSize     = 256 << 10 // How much of a request body a client may send before the handler reads it
+	http2ConnWindowSize       = 1 << 20   // How much data all streams together may have in flight
+)
+
+// The protocol version of requests received over HTTP/2
+const http2Protocol = "HTTP/2.0"
+
+// Fields that only make sense for a single HTTP/1.1 connection, and so are forbidden in HTTP/2.
+// See https://datatracker.ietf.org/doc/html/rfc9113#section-8.2.2
+var http2ConnectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// http2Conn is the state of an HTTP/2 connection. A single goroutine reads the frames, while the handler
+// of each stream runs in its own goroutine and writes its response frames as they are ready.
+type http2Conn struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	decoder      *hpackDecoder // Decodes the header blocks of the client. Only used by the reading goroutine
+	frameBuf     []byte        // The buffer frames are read into
+	maxFrameSize uint32        // The largest frame we accept, as advertised in our SETTINGS
+
+	writeMu sync.Mutex    // Serializes writes to the connection, so frames don't interleave
+	encoder *hpackEncoder // Encodes the header blocks of the responses. Guarded by writeMu
+
+	mu               sync.Mutex              // Guards the fields below
+	flow             *sync.Cond              // Signaled when a send window grows or a stream closes
+	streams          map[uint32]*http2Stream // The open streams by ID
+	lastStreamID     uint32                  // The highest stream ID the client has opened
+	sendWindow       int64                   // How much DATA may still be sent on the connection
+	peerWindowSize   int64                   // The initial send window of new streams (SETTINGS_INITIAL_WINDOW_SIZE)
+	peerMaxFrameSize uint32                  // The largest frame the client accepts (SETTINGS_MAX_FRAME_SIZE)
+	goingAway        bool                    // Whether a GOAWAY frame was sent, so no new streams are accepted
+	sentGoAway       bool                    // Whether we sent a GOAWAY frame with NO_ERROR, which is only sent once
+	closed           bool                    // Whether the connection is gone
+}
+
+// http2Stream is a request and its response
+type http2Stream struct {
+	id   uint32
+	conn *http2Conn
+	body *http2Body // The body of the request, or nil if the request had none
+
+	// Guarded by conn.mu
+	sendWindow    int64 // How much DATA may still be sent on the stream
+	recvWindow    int64 // How much DATA the client may still send on the stream
+	remoteClosed  bool  // Whether the client has sent the whole request
+	reset         bool  // Whether the stream was reset by either side
+	contentLength int64 // The Content-Length of the request, or -1
+	received      int64 // The number of body bytes received so far
+}
+
+// Take over the connection after the client chose HTTP/2.
+// The upgrade is the HTTP/1.1 request that asked for h2c, which becomes stream 1, or nil if the connection started as HTTP/2.
+func (s *Server) serveHTTP2(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, upgrade *Request, settings []http2Setting) {
+	c := &http2Conn{
+		server:           s,
+		conn:             conn,
+		reader:           reader,
+		writer:           writer,
+		decoder:          newHPACKDecoder(),
+		maxFrameSize:     http2DefaultMaxFrameSize,
+		encoder:          newHPACKEncoder(),
+		streams:          make(map[uint32]*http2Stream),
+		sendWindow:       http2DefaultWindowSize,
+		peerWindowSize:   http2DefaultWindowSize,
+		peerMaxFrameSize: http2DefaultMaxFrameSize,
+	}
+	c.flow = sync.NewCond(&c.mu)
+	c.decoder.maxListSize = uint32(s.maxHeaderBytes())
+	defer c.close()
+
+	// Shutdown tells the connection to go away, instead of closing it while it is idle
+	s.trackHTTP2Conn(conn, c)
+	defer s.untrackHTTP2Conn(conn)
+
+	// Until a stream is open, the connection is idle. The upgrade request is the first stream
+	if upgrade == nil {
+		s.setConnState(conn, stateIdle)
+	}
+
+	if err := c.serve(upgrade, settings); err != nil {
+		var connErr http2ConnError
+		if errors.As(err, &connErr) {
+			c.writeGoAway(connErr.code)
+		}
+	}
+}
+
+// Tell the client that the server is shutting down, so it opens no new streams.
+// The connection closes once its open streams are done, or right away if there are none.
+func (c *http2Conn) shutdown() {
+	c.mu.Lock()
+	idle := len(c.streams) == 0
+	c.mu.Unlock()
+
+	c.writeGoAway(http2NoError)
+	if idle {
+		c.conn.SetReadDeadline(time.Now()) // Wake up the reading goroutine to close
+	}
+}
+
+// Exchange the prefaces, then read frames until the connection fails or is closed
+func (c *http2Conn) serve(upgrade *Request, settings []http2Setting) error {
+	// The server preface is its SETTINGS, followed by more room for the request bodies of all streams together
+	err := c.writeFrame(http2FrameSettings, 0, 0, encodeHTTP2Settings([]http2Setting{
+		{http2SettingMaxConcurrentStreams, http2MaxConcurrentStreams},
+		{http2SettingInitialWindowSize, http2StreamWindowSize},
+		{http2SettingMaxHeaderListSize, uint32(c.server.maxHeaderBytes())},
+	}))
+	if err != nil {
+		return err
+	}
+	if err := c.writeWindowUpdate(0, http2ConnWindowSize-http2DefaultWindowSize); err != nil {
+		return err
+	}
+
+	// The settings sent along the upgrade request count as the first SETTINGS of the client
+	if upgrade != nil {
+		if err := c.applySettings(settings); err != nil {
+			return err
+		}
+	}
+
+	// The client preface must follow, and then its SETTINGS
+	c.conn.SetReadDeadline(deadline(time.Now(), c.server.readHeaderTimeout()))
+	if c.server.inShutdown.Load() && upgrade == nil {
+		return http2ConnError{http2NoError, "server shutting down"}
+	}
+	preface := make([]byte, len(http2ClientPreface))
+	if _, err := io.ReadFull(c.reader, preface); err != nil {
+		return err
+	}
+	if string(preface) != http2ClientPreface {
+		return http2ConnError{http2ProtocolError, "invalid client preface"}
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if frame.typ != http2FrameSettings || frame.flags&http2FlagAck != 0 {
+		return http2ConnError{http2ProtocolError, "client preface must be followed by SETTINGS"}
+	}
+	if err := c.handleFrame(frame); err != nil {
+		return err
+	}
+
+	// The upgrade request is answered on stream 1, which the client has already half-closed
+	if upgrade != nil {
+		c.mu.Lock()
+		stream := c.newStream(1)
+		stream.remoteClosed = true
+		c.streams[1] = stream
+		c.lastStreamID = 1
+		c.startStream(stream, upgrade)
+		c.mu.Unlock()
+	}
+
+	for {
+		// Wait for the next frame, but only as long as the idle timeout if there are no streams to wait for
+		c.mu.Lock()
+		idle := len(c.streams) == 0
+		c.mu.Unlock()
+		if idle {
+			c.conn.SetReadDeadline(deadline(time.Now(), c.server.idleTimeout()))
+			// Checked after setting the deadline, so a Shutdown right before can't be missed
+			if c.server.inShutdown.Load() {
+				return http2ConnError{http2NoError, "server shutting down"}
+			}
+		} else {
+			c.conn.SetReadDeadline(time.Time{})
+		}
+
+		frame, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		if err := c.handleFrame(frame); err != nil {
+			var streamErr http2StreamError
+			if errors.As(err, &streamErr) {
+				c.resetStream(streamErr.streamID, streamErr.code)
+				continue
+			}
+			return err
+		}
+	}
+}
+
+// Read the next frame from the client
+func (c *http2Conn) readFrame() (http2Frame, error) {
+	frame, buf, err := readHTTP2Frame(c.reader, c.maxFrameSize, c.frameBuf)
+	c.frameBuf = buf
+	return frame, err
+}
+
+// Forget the streams, and wake up the handlers waiting to send or receive on them
+func (c *http2Conn) close() {
+	c.mu.Lock()
+	c.closed = true
+	streams := c.streams
+	c.streams = map[uint32]*http2Stream{}
+	c.mu.Unlock()
+	c.flow.Broadcast()
+
+	for _, stream := range streams {
+		if stream.body != nil {
+			stream.body.closeWithError(io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// ------
+// FRAMES
+// ------
+
+// Handle a frame received from the client. Returns a http2StreamError if only the stream must be reset,
+// or any other error if the connection must be closed.
+func (c *http2Conn) handleFrame(frame http2Frame) error {
+	switch frame.typ {
+	case http2FrameData:
+		return c.handleData(frame)
+	case http2FrameHeaders:
+		return c.handleHeaders(frame)
+	case http2FramePriority:
+		// Priorities are only a hint, and are ignored
+		if frame.streamID == 0 {
+			return http2ConnError{http2ProtocolError, "PRIORITY on stream 0"}
+		}
+		if len(frame.payload) != 5 {
+			return http2StreamError{frame.streamID, http2FrameSizeError}
+		}
+		return nil
+	case http2FrameRSTStream:
+		return c.handleRSTStream(frame)
+	case http2FrameSettings:
+		return c.handleSettings(frame)
+	case http2FramePushPromise:
+		return http2ConnError{http2ProtocolError, "clients can't push"}
+	case http2FramePing:
+		return c.handlePing(frame)
+	case http2FrameGoAway:
+		// The client won't open any more streams, but the open ones are still answered
+		c.mu.Lock()
+		c.goingAway = true
+		c.mu.Unlock()
+		return nil
+	case http2FrameWindowUpdate:
+		return c.handleWindowUpdate(frame)
+	case http2FrameContinuation:
+		return http2ConnError{http2ProtocolError, "CONTINUATION without HEADERS"}
+	default:
+		return nil // Unknown frame types must be ignored
+	}
+}
+
+// Start a new stream with the request, or end the body of an open stream with its trailers
+func (c *http2Conn) handleHeaders(frame http2Frame) error {
+	id := frame.streamID
+	if id == 0 || id%2 == 0 {
+		return http2ConnError{http2ProtocolError, "HEADERS on an invalid stream"}
+	}
+
+	payload, err := frame.unpadded()
+	if err != nil {
+		return err
+	}
+	if frame.flags&http2FlagPriority != 0 {
+		if len(payload) < 5 {
+			return http2ConnError{http2FrameSizeError, "HEADERS too short for its priority"}
+		}
+		payload = payload[5:]
+	}
+
+	// The header block may continue in CONTINUATION frames, which must follow right away.
+	// A block is never larger than the header list it decodes to, so it is limited the same way.
+	// It can't be skipped without decoding it though, so a larger block ends the connection
+	block := append([]byte(nil), payload...)
+	for {
+		if len(block) > c.server.maxHeaderBytes() {
+			return http2ConnError{http2EnhanceYourCalm, "header block too large"}
+		}
+		if frame.flags&http2FlagEndHeaders != 0 {
+			break
+		}
+		next, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		if next.typ != http2FrameContinuation || next.streamID != id {
+			return http2ConnError{http2ProtocolError, "HEADERS must be followed by CONTINUATION"}
+		}
+		block = append(block, next.payload...)
+		frame.flags |= next.flags & http2FlagEndHeaders
+	}
+
+	// The block must be decoded even if the stream is refused, to keep the dynamic table in sync.
+	// A header list over SETTINGS_MAX_HEADER_LIST_SIZE is decoded without keeping its fields, and answered with 431
+	fields, err := c.decoder.decode(block)
+	tooLarge := errors.Is(err, errHPACKListTooLarge)
+	if err != nil && !tooLarge {
+		return http2ConnError{http2CompressionError, err.Error()}
+	}
+	endStream := frame.flags&http2FlagEndStream != 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// HEADERS on an open stream are the trailers of the request, which end its body
+	if stream, ok := c.streams[id]; ok {
+		if stream.remoteClosed {
+			return http2StreamError{id, http2StreamClosed}
+		}
+		if !endStream || tooLarge {
+			return http2StreamError{id, http2ProtocolError}
+		}
+		return c.endRequestBody(stream)
+	}
+	// The stream was already answered or reset, and the client may not know yet (e.g. trailers crossing our RST_STREAM).
+	// Like its DATA, the frame is ignored. See https://datatracker.ietf.org/doc/html/rfc9113#section-5.1
+	if id <= c.lastStreamID {
+		return nil
+	}
+	c.lastStreamID = id
+
+	if c.goingAway {
+		return http2StreamError{id, http2RefusedStream}
+	}
+	if len(c.streams) >= http2MaxConcurrentStreams {
+		return http2StreamError{id, http2RefusedStream}
+	}
+
+	// Without its fields, the request is only answered with 431, and whatever body it has is dropped
+	if tooLarge {
+		stream := c.newStream(id)
+		stream.remoteClosed = endStream
+		if !endStream {
+			stream.body = newHTTP2Body(stream, 0)
+		}
+		c.streams[id] = stream
+		c.startStream(stream, nil)
+		return nil
+	}
+
+	request, contentLength, err := c.newRequest(fields)
+	if err != nil {
+		return http2StreamError{id, http2ProtocolError}
+	}
+	if endStream && contentLength > 0 {
+		return http2StreamError{id, http2ProtocolError} // The body is shorter than its Content-Length
+	}
+
+	stream := c.newStream(id)
+	stream.contentLength = contentLength
+	stream.remoteClosed = endStream
+	if !endStream {
+		// Like on an HTTP/1.1 connection, the whole body must arrive within the ReadTimeout
+		stream.body = newHTTP2Body(stream, c.server.ReadTimeout)
+		request.body = stream.body
+	}
+	c.streams[id] = stream
+	c.startStream(stream, request)
+	return nil
+}
+
+// Instantiate a stream with the current windows. Must be called with c.mu held
+func (c *http2Conn) newStream(id uint32) *http2Stream {
+	return &http2Stream{
+		id:            id,
+		conn:          c,
+		sendWindow:    c.peerWindowSize,
+		recvWindow:    http2StreamWindowSize,
+		contentLength: -1,
+	}
+}
+
+// Append the body of the request to its stream
+func (c *http2Conn) handleData(frame http2Frame) error {
+	id := frame.streamID
+	if id == 0 {
+		return http2ConnError{http2ProtocolError, "DATA on stream 0"}
+	}
+	data, err := frame.unpadded()
+	if err != nil {
+		return err
+	}
+
+	buffered, padding, err := c.bufferData(id, frame, data)
+
+	// The whole frame counts against the connection window. What is buffered is given back as the handler reads it,
+	// and the rest right away: the padding, and the data of streams that are gone
+	if n := len(frame.payload) - buffered; n > 0 {
+		if err := c.writeWindowUpdate(0, uint32(n)); err != nil {
+			return err
+		}
+	}
+	// The padding is never read by the handler, so its share of the stream window is given back right away too
+	if padding > 0 {
+		if err := c.writeWindowUpdate(id, uint32(padding)); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Append the data of the frame to the body of its stream.
+// Returns how much of the payload was buffered for the handler, and how much padding to give back to the stream window.
+func (c *http2Conn) bufferData(id uint32, frame http2Frame, data []byte) (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stream, ok := c.streams[id]
+	if !ok {
+		if id > c.lastStreamID {
+			return 0, 0, http2ConnError{http2ProtocolError, "DATA on an idle stream"}
+		}
+		return 0, 0, nil // The stream was already answered or reset, so whatever is left of its body is dropped
+	}
+	if stream.remoteClosed || stream.body == nil {
+		return 0, 0, http2StreamError{id, http2StreamClosed}
+	}
+
+	stream.recvWindow -= int64(len(frame.payload))
+	if stream.recvWindow < 0 {
+		return 0, 0, http2StreamError{id, http2FlowControlError}
+	}
+	padding := len(frame.payload) - len(data)
+	stream.recvWindow += int64(padding)
+
+	stream.received += int64(len(data))
+	if stream.contentLength >= 0 && stream.received > stream.contentLength {
+		return 0, 0, http2StreamError{id, http2ProtocolError} // The body is longer than its Content-Length
+	}
+	buffered := 0
+	if stream.body.write(data) {
+		buffered = len(data)
+	}
+
+	if frame.flags&http2FlagEndStream != 0 {
+		return buffered, padding, c.endRequestBody(stream)
+	}
+	return buffered, padding, nil
+}
+
+// Mark the request of the stream as complete. Must be called with c.mu held
+func (c *http2Conn) endRequestBody(stream *http2Stream) error {
+	if stream.contentLength >= 0 && stream.received != stream.contentLength {
+		return http2StreamError{stream.id, http2ProtocolError}
+	}
+	stream.remoteClosed = true
+	if stream.body != nil {
+		stream.body.closeWithError(io.EOF)
+	}
+	return nil
+}
+
+// Abort the stream at the request of the client
+func (c *http2Conn) handleRSTStream(frame http2Frame) error {
+	if frame.streamID == 0 {
+		return http2ConnError{http2ProtocolError, "RST_STREAM on stream 0"}
+	}
+	if len(frame.payload) != 4 {
+		return http2ConnError{http2FrameSizeError, "RST_STREAM must be 4 bytes"}
+	}
+
+	c.mu.Lock()
+	if frame.streamID > c.lastStreamID {
+		c.mu.Unlock()
+		return http2ConnError{http2ProtocolError, "RST_STREAM on an idle stream"}
+	}
+	stream, ok := c.streams[frame.streamID]
+	if ok {
+		stream.reset = true
+		delete(c.streams, frame.streamID)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.flow.Broadcast()
+		if stream.body != nil {
+			stream.body.closeWithError(errHTTP2StreamReset)
+		}
+	}
+	return nil
+}
+
+// Apply the settings of the client, and acknowledge them
+func (c *http2Conn) handleSettings(frame http2Frame) error {
+	if frame.streamID != 0 {
+		return http2ConnError{http2ProtocolError, "SETTINGS on a stream"}
+	}
+	if frame.flags&http2FlagAck != 0 {
+		if len(frame.payload) != 0 {
+			return http2ConnError{http2FrameSizeError, "SETTINGS acknowledgement with a payload"}
+		}
+		return nil
+	}
+
+	settings, err := parseHTTP2Settings(frame.payload)
+	if err != nil {
+		return err
+	}
+	if err := c.applySettings(settings); err != nil {
+		return err
+	}
+	return c.writeFrame(http2FrameSettings, http2FlagAck, 0, nil)
+}
+
+// Apply the settings of the client. See https://datatracker.ietf.org/doc/html/rfc9113#section-6.5.2
+func (c *http2Conn) applySettings(settings []http2Setting) error {
+	for _, setting := range settings {
+		switch setting.id {
+		case http2SettingHeaderTableSize:
+			c.writeMu.Lock()
+			c.encoder.setMaxTableSize(setting.value)
+			c.writeMu.Unlock()
+		case http2SettingEnablePush:
+			if setting.value > 1 {
+				return http2ConnError{http2ProtocolError, "invalid SETTINGS_ENABLE_PUSH"}
+			}
+		case http2SettingInitialWindowSize:
+			if setting.value > http2MaxWindowSize {
+				return http2ConnError{http2FlowControlError, "SETTINGS_INITIAL_WINDOW_SIZE too large"}
+			}
+			// The change applies to the windows of the open streams too
+			c.mu.Lock()
+			delta := int64(setting.value) - c.peerWindowSize
+			c.peerWindowSize = int64(setting.value)
+			for _, stream := range c.streams {
+				stream.sendWindow += delta
+			}
+			c.mu.Unlock()
+			c.flow.Broadcast()
+		case http2SettingMaxFrameSize:
+			if setting.value < http2DefaultMaxFrameSize || setting.value > http2MaxFrameSizeLimit {
+				return http2ConnError{http2ProtocolError, "invalid SETTINGS_MAX_FRAME_SIZE"}
+			}
+			c.mu.Lock()
+			c.peerMaxFrameSize = setting.value
+			c.mu.Unlock()
+		}
+		// Unknown settings, and the ones that don't affect a server, are ignored
+	}
+	return nil
+}
+
+// Answer a PING from the client
+func (c *http2Conn) handlePing(frame http2Frame) error {
+	if frame.streamID != 0 {
+		return http2ConnError{http2ProtocolError, "PING on a stream"}
+	}
+	if len(frame.payload) != 8 {
+		return http2ConnError{http2FrameSizeError, "PING must be 8 bytes"}
+	}
+	if frame.flags&http2FlagAck != 0 {
+		return nil
+	}
+	return c.writeFrame(http2FramePing, http2FlagAck, 0, frame.payload)
+}
+
+// Grow the send window of the connection or a stream
+func (c *http2Conn) handleWindowUpdate(frame http2Frame) error {
+	if len(frame.payload) != 4 {
+		return http2ConnError{http2FrameSizeError, "WINDOW_UPDATE must be 4 bytes"}
+	}
+	increment := int64(binary.BigEndian.Uint32(frame.payload) & (1<<31 - 1))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.flow.Broadcast()
+
+	if frame.streamID == 0 {
+		if increment == 0 {
+			return http2ConnError{http2ProtocolError, "WINDOW_UPDATE of 0"}
+		}
+		c.sendWindow += increment
+		if c.sendWindow > http2MaxWindowSize {
+			return http2ConnError{http2FlowControlError, "connection window too large"}
+		}
+		return nil
+	}
+
+	stream, ok := c.streams[frame.streamID]
+	if !ok {
+		return nil // The stream is already closed
+	}
+	if increment == 0 {
+		return http2StreamError{frame.streamID, http2ProtocolError}
+	}
+	stream.sendWindow += increment
+	if stream.sendWindow > http2MaxWindowSize {
+		return http2StreamError{frame.streamID, http2FlowControlError}
+	}
+	return nil
+}
+
+// -------
+// WRITING
+// -------
+
+// Write a frame and flush it to the connection within the write timeout
+func (c *http2Conn) writeFrame(typ, flags uint8, streamID uint32, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrameLocked(typ, flags, streamID, payload)
+}
+
+// Write a frame and flush it. Must be called with c.writeMu held
+func (c *http2Conn) writeFrameLocked(typ, flags uint8, streamID uint32, payload []byte) error {
+	c.conn.SetWriteDeadline(deadline(time.Now(), c.server.WriteTimeout))
+	if err := writeHTTP2Frame(c.writer, typ, flags, streamID, payload); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+// Let the client send more DATA on the connection (stream 0) or a stream
+func (c *http2Conn) writeWindowUpdate(streamID, increment uint32) error {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], increment)
+	return c.writeFrame(http2FrameWindowUpdate, 0, streamID, payload[:])
+}
+
+// Give back n bytes of the connection window, once buffered DATA was read or dropped. Must be called without c.mu held
+func (c *http2Conn) releaseWindow(n int) {
+	if n == 0 {
+		return
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		c.writeWindowUpdate(0, uint32(n))
+	}
+}
+
+// Encode the fields and write them as a HEADERS frame, split into CONTINUATION frames if they don't fit in one
+func (c *http2Conn) writeHeaders(streamID uint32, fields []hpackField, endStream bool) error {
+	c.mu.Lock()
+	maxSize := int(c.peerMaxFrameSize)
+	c.mu.Unlock()
+
+	// The block must be written right after it is encoded, so the client decodes the blocks in the same order
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	block := c.encoder.encode(fields)
+
+	typ, flags := uint8(http2FrameHeaders), uint8(0)
+	if endStream {
+		flags |= http2FlagEndStream
+	}
+	for {
+		chunk := block[:min(len(block), maxSize)]
+		block = block[len(chunk):]
+		if len(block) == 0 {
+			flags |= http2FlagEndHeaders
+		}
+		if err := c.writeFrameLocked(typ, flags, streamID, chunk); err != nil {
+			return err
+		}
+		if len(block) == 0 {
+			return nil
+		}
+		typ, flags = http2FrameContinuation, 0
+	}
+}
+
+// Reset the stream, and tell the client unless the connection is gone
+func (c *http2Conn) resetStream(id uint32, code http2ErrorCode) {
+	c.mu.Lock()
+	stream, ok := c.streams[id]
+	if ok {
+		stream.reset = true
+		delete(c.streams, id)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.flow.Broadcast()
+		if stream.body != nil {
+			stream.body.closeWithError(errHTTP2StreamReset)
+		}
+	}
+
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(code))
+	c.writeFrame(http2FrameRSTStream, 0, id, payload[:])
+}
+
+// Send a GOAWAY frame with the code. One with NO_ERROR is only sent once, however many times the connection is told to go away
+func (c *http2Conn) writeGoAway(code http2ErrorCode) error {
+	c.mu.Lock()
+	sent := c.sentGoAway
+	if code == http2NoError {
+		c.sentGoAway = true
+	}
+	c.mu.Unlock()
+	if sent && code == http2NoError {
+		return nil
+	}
+	return c.writeFrame(http2FrameGoAway, 0, 0, c.goAwayPayload(code))
+}
+
+// The payload of a GOAWAY frame, telling the client the last stream that was processed
+func (c *http2Conn) goAwayPayload(code http2ErrorCode) []byte {
+	c.mu.Lock()
+	c.goingAway = true
+	lastStreamID := c.lastStreamID
+	c.mu.Unlock()
+
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload, lastStreamID)
+	binary.BigEndian.PutUint32(payload[4:], uint32(code))
+	return payload
+}
+
+// -------
+// STREAMS
+// -------
+
+// Returned when reading the body of a request whose stream was reset
+var errHTTP2StreamReset = errors.New("http2: stream reset")
+
+// Build the request from the header fields of a stream, checking the pseudo-header fields.
+// Returns the Content-Length of the request, or -1 if it has none.
+// See https://datatracker.ietf.org/doc/html/rfc9113#section-8.3.1
+func (c *http2Conn) newRequest(fields []hpackField) (*Request, int64, error) {
+	request := &Request{
+		HTTPMessage: createHTTPMessage(),
+		Trailer:     NewHeaders(),
+		body:        strings.NewReader(""),
+	}
+	request.protocol = http2Protocol
+
+	var scheme, authority string
+	var cookies []string
+	regular := false // Whether a regular field was seen, after which no pseudo-header field may follow
+	for _, field := range fields {
+		if field.name != strings.ToLower(field.name) {
+			return nil, 0, errors.New("upper-case field name")
+		}
+
+		if strings.HasPrefix(field.name, ":") {
+			if regular {
+				return nil, 0, errors.New("pseudo-header field after a regular field")
+			}
+			var target *string
+			switch field.name {
+			case ":method":
+				target = &request.Method
+			case ":path":
+				target = &request.Path
+			case ":scheme":
+				target = &scheme
+			case ":authority":
+				target = &authority
+			default:
+				return nil, 0, fmt.Errorf("unknown pseudo-header field %s", field.name)
+			}
+			if *target != "" {
+				return nil, 0, fmt.Errorf("repeated pseudo-header field %s", field.name)
+			}
+			*target = field.value
+			continue
+		}
+
+		regular = true
+		if http2ConnectionHeaders[field.name] || (field.name == "te" && field.value != "trailers") {
+			return nil, 0, fmt.Errorf("connection-specific field %s", field.name)
+		}
+		if _, _, err := parseFieldLine(field.name + ": " + field.value); err != nil {
+			return nil, 0, err
+		}
+		// Cookies may be split into several fields for better compression, but handlers expect a single one
+		if field.name == "cookie" {
+			cookies = append(cookies, field.value)
+			continue
+		}
+		request.Headers.Add(field.name, field.value)
+	}
+
+	if request.Method == "" || scheme == "" || request.Path == "" || !isToken(request.Method) {
+		return nil, 0, errors.New("missing pseudo-header fields")
+	}
+	if len(cookies) > 0 {
+		request.Headers.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	// The authority takes the place of the Host field
+	if authority != "" && !request.Headers.Contains("Host") {
+		request.Headers.Set("Host", authority)
+	}
+	request.StartLine = request.Method + " " + request.Path + " " + http2Protocol
+
+	contentLength := int64(-1)
+	if value, ok := request.Headers.Get("Content-Length"); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+		}
+		contentLength = n
+	}
+	return request, contentLength, nil
+}
+
+// Run the handler of the stream in a new goroutine, and send its response. Must be called with c.mu held.
+// A nil request means the header list was too large, which is answered with 431 without running the handler.
+func (c *http2Conn) startStream(stream *http2Stream, request *Request) {
+	c.server.setConnState(c.conn, stateActive)
+	go func() {
+		response := CreateResponse()
+		response.protocol = http2Protocol
+
+		// The header section is limited like for HTTP/1.1
+		if request == nil {
+			response.WithStatus(http.StatusRequestHeaderFieldsTooLarge)
+		} else {
+			body := &bodyErrorRecorder{reader: request.body}
+			request.body = body
+			c.server.handler().ServeHTTP(request, response)
+
+			// If the body could not be read in time, the request is incomplete
+			if isTimeout(body.err) {
+				response.reset()
+				response.WithStatus(http.StatusRequestTimeout)
+			}
+			response.omitBody = request.Method == "HEAD"
+		}
+
+		if err := stream.writeResponse(response); err != nil && !errors.Is(err, errHTTP2StreamReset) {
+			c.resetStream(stream.id, http2InternalError)
+		}
+		c.finishStream(stream)
+	}()
+}
+
+// Close the stream once its response was sent
+func (c *http2Conn) finishStream(stream *http2Stream) {
+	c.mu.Lock()
+	_, open := c.streams[stream.id]
+	delete(c.streams, stream.id)
+	stopBody := open && !stream.remoteClosed
+	idle := len(c.streams) == 0
+	if idle {
+		// Under c.mu, so that a stream starting meanwhile can't be overridden
+		c.server.setConnState(c.conn, stateIdle)
+	}
+	c.mu.Unlock()
+
+	// The response is complete, so the rest of the request body is not needed.
+	// See https://datatracker.ietf.org/doc/html/rfc9113#section-8.1
+	if stopBody {
+		var payload [4]byte
+		binary.BigEndian.PutUint32(payload[:], uint32(http2NoError))
+		c.writeFrame(http2FrameRSTStream, 0, stream.id, payload[:])
+	}
+	if stream.body != nil {
+		stream.body.discard()
+	}
+
+	if idle {
+		// Tell the client to go elsewhere if the server is shutting down, and wake up the reading goroutine to close
+		if c.server.inShutdown.Load() {
+			c.writeGoAway(http2NoError)
+			c.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// Send the response on the stream as a HEADERS frame, followed by DATA frames for the body
+func (s *http2Stream) writeResponse(response *Response) error {
+	if err := response.prepare(); err != nil {
+		fmt.Println("Error writing response: ", err.Error())
+		response.reset()
+		response.WithStatus(http.StatusInternalServerError)
+		response.prepare()
+	}
+
+	// Don't answer a stream the client has given up on
+	s.conn.mu.Lock()
+	reset := s.reset
+	s.conn.mu.Unlock()
+	if reset {
+		if closer, ok := response.bodyReader.(io.Closer); ok {
+			closer.Close()
+		}
+		return errHTTP2StreamReset
+	}
+
+	fields := []hpackField{{":status", strconv.Itoa(response.statusCode)}}
+	for _, field := range response.Headers.Enumerate() {
+		name := strings.ToLower(field.Name)
+		if http2ConnectionHeaders[name] {
+			continue // The framing replaces them
+		}
+		fields = append(fields, hpackField{name, field.Value})
+	}
+
+	hasBody := !response.omitBody && (response.bodyReader != nil || response.content != "")
+	if closer, ok := response.bodyReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if err := s.conn.writeHeaders(s.id, fields, !hasBody); err != nil {
+		return err
+	}
+	if !hasBody {
+		return nil
+	}
+
+	w := &http2DataWriter{stream: s}
+	if err := writeHTTP2Body(w, response); err != nil {
+		return err
+	}
+	return w.close()
+}
+
+// Copy the body of the response, compressing it if the response asks for it
+func writeHTTP2Body(w io.Writer, response *Response) error {
+	if response.bodyReader == nil {
+		_, err := io.WriteString(w, response.content)
+		return err
+	}
+
+	// A body of unknown length is compressed on the way, like it would be with the chunked transfer coding
+	if isChunked(response.Headers) {
+		if response.encoder == nil {
+			_, err := io.Copy(w, response.bodyReader)
+			return err
+		}
+		encoded, err := response.encoder(w)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(encoded, response.bodyReader); err != nil {
+			encoded.Close()
+			return err
+		}
+		return encoded.Close()
+	}
+
+	n, err := io.Copy(w, io.LimitReader(response.bodyReader, response.contentLength))
+	if err == nil && n < response.contentLength {
+		err = io.ErrUnexpectedEOF // The body was shorter than the declared Content-Length
+	}
+	return err
+}
+
+// http2DataWriter writes the body of a response as DATA frames, within the send windows of the stream and connection
+type http2DataWriter struct {
+	stream *http2Stream
+}
+
+// Write the data in as many frames as needed, waiting for the client to open the windows when they are exhausted
+func (w *http2DataWriter) Write(p []byte) (int, error) {
+	c := w.stream.conn
+	written := 0
+	for len(p) > 0 {
+		c.mu.Lock()
+		for !w.stream.reset && !c.closed && (w.stream.sendWindow <= 0 || c.sendWindow <= 0) {
+			c.flow.Wait()
+		}
+		if w.stream.reset || c.closed {
+			c.mu.Unlock()
+			return written, errHTTP2StreamReset
+		}
+		n := min(int64(len(p)), w.stream.sendWindow, c.sendWindow, int64(c.peerMaxFrameSize))
+		w.stream.sendWindow -= n
+		c.sendWindow -= n
+		c.mu.Unlock()
+
+		if err := c.writeFrame(http2FrameData, 0, w.stream.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += int(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// End the stream with an empty DATA frame
+func (w *http2DataWriter) close() error {
+	return w.stream.conn.writeFrame(http2FrameData, http2FlagEndStream, w.stream.id, nil)
+}
+
+// ----
+// BODY
+// ----
+
+// http2Body is the body of a request, buffered as its DATA frames arrive until the handler reads it.
+// Reading gives the window back to the client, so it may send more.
+type http2Body struct {
+	stream *http2Stream
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	err    error       // io.EOF once the whole body was received, or why it never will be
+	timer  *time.Timer // Fails the body once it took too long to arrive, or nil if it may take forever
+}
+
+// Instantiate an empty body for the stream, that must be received in full within the timeout (0 for no limit).
+// The connection keeps no read deadline while streams are open, so this is what stops a client from stalling a handler.
+func newHTTP2Body(stream *http2Stream, timeout time.Duration) *http2Body {
+	b := &http2Body{stream: stream}
+	b.cond = sync.NewCond(&b.mu)
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.closeWithError(os.ErrDeadlineExceeded)
+		})
+	}
+	return b
+}
+
+// Read the received data, waiting for more if there is none yet
+func (b *http2Body) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	for b.buf.Len() == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.buf.Len() == 0 {
+		err := b.err
+		b.mu.Unlock()
+		return 0, err
+	}
+	n, _ := b.buf.Read(p)
+	b.mu.Unlock()
+
+	// Let the client send as much again on the connection, and on the stream unless it already sent everything
+	c := b.stream.conn
+	c.mu.Lock()
+	update := !b.stream.remoteClosed && !b.stream.reset
+	if update {
+		b.stream.recvWindow += int64(n)
+	}
+	c.mu.Unlock()
+	c.releaseWindow(n)
+	if update && n > 0 {
+		c.writeWindowUpdate(b.stream.id, uint32(n))
+	}
+	return n, nil
+}
+
+// Append data received from the client. Returns false if the data was dropped, because the body already failed
+func (b *http2Body) write(data []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return false
+	}
+	b.buf.Write(data)
+	b.cond.Broadcast()
+	return true
+}
+
+// Stop the body with the error once the buffered data has been read.
+// The first error wins, so a completed body stays complete.
+func (b *http2Body) closeWithError(err error) {
+	b.stop(err, false)
+}
+
+// Stop the body once the handler is done with it, dropping whatever it did not read
+func (b *http2Body) discard() {
+	b.stop(errHTTP2StreamReset, true)
+}
+
+// Stop the body with the error, dropping the buffered data unless the body is complete and it may still be read
+func (b *http2Body) stop(err error, discard bool) {
+	b.mu.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if b.err == nil {
+		b.err = err
+	}
+	// Nobody is going to read the rest, so the client may send as much again on the connection
+	dropped := 0
+	if b.err != io.EOF || discard {
+		dropped = b.buf.Len()
+		b.buf.Reset()
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	b.stream.conn.releaseWindow(dropped)
+}
+
+// -----------
+// NEGOTIATION
+// -----------
+
+// Checks if the client starts the connection with the HTTP/2 preface (prior knowledge).
+// Only waits for more bytes while what was received so far matches the preface,
+// so that short HTTP/1.1 requests are not held up.
+func hasHTTP2Preface(reader *bufio.Reader) bool {
+	for n := 1; n <= len(http2ClientPreface); n++ {
+		b, err := reader.Peek(n)
+		if err != nil || b[n-1] != http2ClientPreface[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the HTTP/1.1 request asks to switch to HTTP/2 over cleartext, and returns the settings it carries.
+// Requests with a body are served as HTTP/1.1, as the body would have to be read before switching.
+// See https://datatracker.ietf.org/doc/html/rfc7540#section-3.2
+func h2cUpgradeSettings(request *Request) ([]http2Setting, bool) {
+	upgrade, _ := request.Headers.Get("Upgrade")
+	connection := strings.Join(request.Headers.Values("Connection"), ",")
+	if !headerHasToken(upgrade, "h2c") || !headerHasToken(connection, "upgrade") || !headerHasToken(connection, "http2-settings") {
+		return nil, false
+	}
+	if request.Headers.Contains("Transfer-Encoding") {
+		return nil, false
+	}
+	if length, ok := request.Headers.Get("Content-Length"); ok && length != "0" {
+		return nil, false
+	}
+
+	values := request.Headers.Values("HTTP2-Settings")
+	if len(values) != 1 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(values[0], "="))
+	if err != nil {
+		return nil, false
+	}
+	settings, err := parseHTTP2Settings(payload)
+	if err != nil {
+		return nil, false
+	}
+	return settings, true
+}
+
+// Checks if the comma-separated header value contains the token, ignoring case (e.g. `keep-alive, Upgrade`)
+func headerHasToken(value, token string) bool {
+	for _, element := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(element), token) {
+			return true
+		}
+	}
+	return false
+}
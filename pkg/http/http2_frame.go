@@ -0,0 +1,194 @@
+package http
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9113#section-4
+// --------------------------------------------------------------------------
+
+// Every HTTP/2 connection starts with the client sending this preface, which looks like a request
+// with an unknown method to an HTTP/1.1 server. See https://datatracker.ietf.org/doc/html/rfc9113#section-3.4
+const http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// The size of the header of every frame
+const http2FrameHeaderLen = 9
+
+// The types of frames. See https://datatracker.ietf.org/doc/html/rfc9113#section-6
+const (
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FramePriority     = 0x2
+	http2FrameRSTStream    = 0x3
+	http2FrameSettings     = 0x4
+	http2FramePushPromise  = 0x5
+	http2FramePing         = 0x6
+	http2FrameGoAway       = 0x7
+	http2FrameWindowUpdate = 0x8
+	http2FrameContinuation = 0x9
+)
+
+// The flags of frames. Their meaning depends on the type of the frame
+const (
+	http2FlagEndStream  = 0x1  // DATA and HEADERS: the last frame the sender sends on the stream
+	http2FlagAck        = 0x1  // SETTINGS and PING: acknowledges the frame of the peer
+	http2FlagEndHeaders = 0x4  // HEADERS and CONTINUATION: the last frame of the header block
+	http2FlagPadded     = 0x8  // DATA and HEADERS: the payload is padded
+	http2FlagPriority   = 0x20 // HEADERS: the payload starts with the stream priority
+)
+
+// The parameters of a SETTINGS frame. See https://datatracker.ietf.org/doc/html/rfc9113#section-6.5.2
+const (
+	http2SettingHeaderTableSize      = 0x1
+	http2SettingEnablePush           = 0x2
+	http2SettingMaxConcurrentStreams = 0x3
+	http2SettingInitialWindowSize    = 0x4
+	http2SettingMaxFrameSize         = 0x5
+	http2SettingMaxHeaderListSize    = 0x6
+)
+
+// Limits of the protocol
+const (
+	http2DefaultWindowSize   = 65535     // The initial flow-control window of connections and streams
+	http2MaxWindowSize       = 1<<31 - 1 // The largest a flow-control window may grow to
+	http2DefaultMaxFrameSize = 16384     // The largest frame payload both sides accept, until told otherwise
+	http2MaxFrameSizeLimit   = 1<<24 - 1 // The largest frame payload either side may ever advertise
+)
+
+// An error code of RST_STREAM and GOAWAY frames. See https://datatracker.ietf.org/doc/html/rfc9113#section-7
+type http2ErrorCode uint32
+
+const (
+	http2NoError          http2ErrorCode = 0x0
+	http2ProtocolError    http2ErrorCode = 0x1
+	http2InternalError    http2ErrorCode = 0x2
+	http2FlowControlError http2ErrorCode = 0x3
+	http2StreamClosed     http2ErrorCode = 0x5
+	http2FrameSizeError   http2ErrorCode = 0x6
+	http2RefusedStream    http2ErrorCode = 0x7
+	http2Cancel           http2ErrorCode = 0x8
+	http2CompressionError http2ErrorCode = 0x9
+	http2EnhanceYourCalm  http2ErrorCode = 0xb
+)
+
+// http2ConnError is an error that affects the whole connection, which is closed with a GOAWAY frame
+type http2ConnError struct {
+	code   http2ErrorCode
+	reason string
+}
+
+func (e http2ConnError) Error() string {
+	return fmt.Sprintf("http2: connection error %d: %s", e.code, e.reason)
+}
+
+// http2StreamError is an error that only affects one stream, which is closed with a RST_STREAM frame
+type http2StreamError struct {
+	streamID uint32
+	code     http2ErrorCode
+}
+
+func (e http2StreamError) Error() string {
+	return fmt.Sprintf("http2: stream %d error %d", e.streamID, e.code)
+}
+
+// A frame of an HTTP/2 connection. See https://datatracker.ietf.org/doc/html/rfc9113#section-4.1
+type http2Frame struct {
+	typ      uint8  // The type of the frame (e.g. http2FrameHeaders)
+	flags    uint8  // The flags of the frame, depending on its type
+	streamID uint32 // The stream the frame belongs to, or 0 for the connection itself
+	payload  []byte // The payload of the frame, only valid until the next frame is read
+}
+
+// Read the next frame, rejecting payloads larger than maxSize. The buffer is reused for the payload when large enough.
+func readHTTP2Frame(r io.Reader, maxSize uint32, buf []byte) (http2Frame, []byte, error) {
+	var header [http2FrameHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return http2Frame{}, buf, err
+	}
+
+	length := uint32(header[0])<<16 | uint32(header[1])<<8 | uint32(header[2])
+	frame := http2Frame{
+		typ:      header[3],
+		flags:    header[4],
+		streamID: binary.BigEndian.Uint32(header[5:]) & (1<<31 - 1), // The reserved bit is ignored
+	}
+	if length > maxSize {
+		return frame, buf, http2ConnError{http2FrameSizeError, fmt.Sprintf("frame of %d bytes over the limit of %d", length, maxSize)}
+	}
+
+	if uint32(cap(buf)) < length {
+		buf = make([]byte, length)
+	}
+	frame.payload = buf[:length]
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame, buf, err
+	}
+	return frame, buf, nil
+}
+
+// Write a frame with the payload
+func writeHTTP2Frame(w io.Writer, typ, flags uint8, streamID uint32, payload []byte) error {
+	header := [http2FrameHeaderLen]byte{
+		byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)),
+		typ, flags,
+	}
+	binary.BigEndian.PutUint32(header[5:], streamID)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// Remove the padding of a DATA or HEADERS frame, whose payload then starts with the length of the padding.
+// See https://datatracker.ietf.org/doc/html/rfc9113#section-6.1
+func (f http2Frame) unpadded() ([]byte, error) {
+	if f.flags&http2FlagPadded == 0 {
+		return f.payload, nil
+	}
+	if len(f.payload) == 0 {
+		return nil, http2ConnError{http2FrameSizeError, "padded frame without a pad length"}
+	}
+	padding := int(f.payload[0])
+	if padding >= len(f.payload) {
+		return nil, http2ConnError{http2ProtocolError, "padding longer than the payload"}
+	}
+	return f.payload[1 : len(f.payload)-padding], nil
+}
+
+// A parameter of a SETTINGS frame
+type http2Setting struct {
+	id    uint16
+	value uint32
+}
+
+// Parse the parameters of a SETTINGS frame, each made of a 16-bit identifier and a 32-bit value
+func parseHTTP2Settings(payload []byte) ([]http2Setting, error) {
+	if len(payload)%6 != 0 {
+		return nil, http2ConnError{http2FrameSizeError, "SETTINGS payload is not a multiple of 6 bytes"}
+	}
+	settings := make([]http2Setting, 0, len(payload)/6)
+	for i := 0; i < len(payload); i += 6 {
+		settings = append(settings, http2Setting{
+			id:    binary.BigEndian.Uint16(payload[i:]),
+			value: binary.BigEndian.Uint32(payload[i+2:]),
+		})
+	}
+	return settings, nil
+}
+
+// Encode the parameters of a SETTINGS frame
+func encodeHTTP2Settings(settings []http2Setting) []byte {
+	payload := make([]byte, 0, 6*len(settings))
+	for _, s := range settings {
+		payload = binary.BigEndian.AppendUint16(payload, s.id)
+		payload = binary.BigEndian.AppendUint32(payload, s.value)
+	}
+	return payload
+}
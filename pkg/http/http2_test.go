@@ -0,0 +1,673 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHTTP2Client speaks HTTP/2 to a test server with raw frames
+type testHTTP2Client struct {
+	t       *testing.T
+	conn    net.Conn
+	reader  *bufio.Reader
+	encoder *hpackEncoder
+	decoder *hpackDecoder
+}
+
+// Start an HTTP/2 connection with prior knowledge, sending the client preface and empty SETTINGS
+func dialTestHTTP2(t *testing.T, addr string) *testHTTP2Client {
+	t.Helper()
+	conn := dialTestServer(t, addr)
+	conn.Write([]byte(http2ClientPreface))
+	client := newTestHTTP2Client(t, conn, bufio.NewReader(conn))
+	client.writeFrame(http2FrameSettings, 0, 0, nil)
+	return client
+}
+
+// Speak HTTP/2 on a connection that already switched to it
+func newTestHTTP2Client(t *testing.T, conn net.Conn, reader *bufio.Reader) *testHTTP2Client {
+	return &testHTTP2Client{t: t, conn: conn, reader: reader, encoder: newHPACKEncoder(), decoder: newHPACKDecoder()}
+}
+
+// Write a frame to the server
+func (c *testHTTP2Client) writeFrame(typ, flags uint8, streamID uint32, payload []byte) {
+	c.t.Helper()
+	if err := writeHTTP2Frame(c.conn, typ, flags, streamID, payload); err != nil {
+		c.t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// Read the next frame from the server, with a copy of its payload
+func (c *testHTTP2Client) readFrame() (http2Frame, error) {
+	frame, _, err := readHTTP2Frame(c.reader, http2DefaultMaxFrameSize, nil)
+	return frame, err
+}
+
+// Send a request on the stream, with a body if it isn't empty
+func (c *testHTTP2Client) request(streamID uint32, method, path, body string, extra ...hpackField) {
+	c.t.Helper()
+	fields := append([]hpackField{{":method", method}, {":scheme", "http"}, {":path", path}, {":authority", "localhost"}}, extra...)
+	c.writeHeaders(streamID, fields, body == "")
+	if body != "" {
+		c.writeFrame(http2FrameData, http2FlagEndStream, streamID, []byte(body))
+	}
+}
+
+// Send a HEADERS frame with the fields
+func (c *testHTTP2Client) writeHeaders(streamID uint32, fields []hpackField, endStream bool) {
+	c.t.Helper()
+	flags := uint8(http2FlagEndHeaders)
+	if endStream {
+		flags |= http2FlagEndStream
+	}
+	c.writeFrame(http2FrameHeaders, flags, streamID, c.encoder.encode(fields))
+}
+
+// A response read from a stream
+type testHTTP2Response struct {
+	status  string
+	headers map[string]string
+	body    string
+}
+
+// Read frames until the response on each of the streams is complete, acknowledging SETTINGS on the way
+func (c *testHTTP2Client) readResponses(streamIDs ...uint32) map[uint32]*testHTTP2Response {
+	c.t.Helper()
+	responses := map[uint32]*testHTTP2Response{}
+	pending := len(streamIDs)
+	for pending > 0 {
+		frame, err := c.readFrame()
+		if err != nil {
+			c.t.Fatalf("Failed to read frame: %v", err)
+		}
+		switch frame.typ {
+		case http2FrameSettings:
+			if frame.flags&http2FlagAck == 0 {
+				c.writeFrame(http2FrameSettings, http2FlagAck, 0, nil)
+			}
+		case http2FrameHeaders:
+			fields, err := c.decoder.decode(frame.payload)
+			if err != nil {
+				c.t.Fatalf("Failed to decode headers: %v", err)
+			}
+			response := &testHTTP2Response{headers: map[string]string{}}
+			for _, field := range fields {
+				if field.name == ":status" {
+					response.status = field.value
+				} else {
+					response.headers[field.name] = field.value
+				}
+			}
+			responses[frame.streamID] = response
+		case http2FrameData:
+			responses[frame.streamID].body += string(frame.payload)
+		case http2FrameRSTStream, http2FrameGoAway:
+			c.t.Fatalf("Unexpected frame of type %d with payload %x", frame.typ, frame.payload)
+		}
+		if (frame.typ == http2FrameHeaders || frame.typ == http2FrameData) && frame.flags&http2FlagEndStream != 0 {
+			pending--
+		}
+	}
+	return responses
+}
+
+// Read frames until one of the type arrives, skipping the others
+func (c *testHTTP2Client) expectFrame(typ uint8) http2Frame {
+	c.t.Helper()
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			c.t.Fatalf("Expected a frame of type %d, but got %v", typ, err)
+		}
+		if frame.typ == typ {
+			return frame
+		}
+	}
+}
+
+// A handler that answers with the method, path and body of the request
+func echoHTTP2Handler(req *Request, res *Response) {
+	body, _ := io.ReadAll(req.BodyReader())
+	host, _ := req.Headers.Get("Host")
+	res.WithStatus(200).WithHeaders(map[string]string{"X-Host": host})
+	res.WithBody(req.Method + " " + req.Path + " " + string(body))
+}
+
+func TestHTTP2PriorKnowledge(t *testing.T) {
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)})
+	client := dialTestHTTP2(t, addr)
+
+	client.request(1, "GET", "/hello?x=1", "")
+	client.request(3, "POST", "/upload", "some data", hpackField{"content-length", "9"})
+	responses := client.readResponses(1, 3)
+
+	tests := []struct {
+		streamID uint32
+		body     string
+	}{
+		{1, "GET /hello?x=1 "},
+		{3, "POST /upload some data"},
+	}
+	for _, test := range tests {
+		response := responses[test.streamID]
+		if response.status != "200" || response.body != test.body {
+			t.Errorf("Expected 200 with body %q on stream %d, but got %s with body %q", test.body, test.streamID, response.status, response.body)
+		}
+		// The authority takes the place of the Host header, and connection-specific fields are left out
+		if response.headers["x-host"] != "localhost" {
+			t.Errorf("Expected the Host to be the authority, but got %q", response.headers["x-host"])
+		}
+		if _, ok := response.headers["connection"]; ok {
+			t.Errorf("Expected no Connection field in an HTTP/2 response")
+		}
+	}
+}
+
+func TestHTTP2Multiplexing(t *testing.T) {
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)})
+	client := dialTestHTTP2(t, addr)
+
+	// The body of the first request is still being sent when the second request is answered
+	client.writeHeaders(1, []hpackField{{":method", "POST"}, {":scheme", "http"}, {":path", "/slow"}}, false)
+	client.writeFrame(http2FrameData, 0, 1, []byte("part 1, "))
+	client.request(3, "GET", "/fast", "")
+	fast := client.readResponses(3)[3]
+	if fast.body != "GET /fast " {
+		t.Errorf("Expected the second request to be answered first, but got %q", fast.body)
+	}
+
+	client.writeFrame(http2FrameData, http2FlagEndStream, 1, []byte("part 2"))
+	slow := client.readResponses(1)[1]
+	if slow.body != "POST /slow part 1, part 2" {
+		t.Errorf("Expected the whole body of the first request, but got %q", slow.body)
+	}
+}
+
+func TestHTTP2FlowControl(t *testing.T) {
+	body := strings.Repeat("0123456789", 10000) // Larger than the initial window of 65535 bytes
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		res.WithStatus(200).WithBody(body)
+	})}
+	client := dialTestHTTP2(t, startTestServer(t, server))
+	client.request(1, "GET", "/", "")
+
+	// The server stops once the window is exhausted
+	received := 0
+	for received < http2DefaultWindowSize {
+		frame := client.expectFrame(http2FrameData)
+		received += len(frame.payload)
+	}
+	if received != http2DefaultWindowSize {
+		t.Fatalf("Expected exactly %d bytes before the window is exhausted, but got %d", http2DefaultWindowSize, received)
+	}
+	client.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		frame, err := client.readFrame()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		if frame.typ == http2FrameData {
+			t.Fatalf("Expected no DATA beyond the window, but got %d bytes", len(frame.payload))
+		}
+	}
+
+	// Opening the windows of the connection and the stream lets the rest through
+	client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	increment := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	client.writeFrame(http2FrameWindowUpdate, 0, 0, increment)
+	client.writeFrame(http2FrameWindowUpdate, 0, 1, increment)
+	for {
+		frame := client.expectFrame(http2FrameData)
+		received += len(frame.payload)
+		if frame.flags&http2FlagEndStream != 0 {
+			break
+		}
+	}
+	if received != len(body) {
+		t.Errorf("Expected %d bytes in total, but got %d", len(body), received)
+	}
+}
+
+func TestHTTP2RequestBodyFlowControl(t *testing.T) {
+	// A body larger than the stream window only arrives as the handler reads it
+	body := strings.Repeat("x", 3*http2StreamWindowSize)
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		data, _ := io.ReadAll(req.BodyReader())
+		res.WithStatus(200).WithBody(strings.Repeat("!", len(data)/1000))
+	})}
+	client := dialTestHTTP2(t, startTestServer(t, server))
+	client.writeHeaders(1, []hpackField{{":method", "PUT"}, {":scheme", "http"}, {":path", "/"}}, false)
+
+	// Send within the windows the server grants
+	window := int64(http2StreamWindowSize)
+	for sent := 0; sent < len(body); {
+		for window <= 0 {
+			frame := client.expectFrame(http2FrameWindowUpdate)
+			if frame.streamID == 1 {
+				window += int64(binary.BigEndian.Uint32(frame.payload))
+			}
+		}
+		n := min(len(body)-sent, int(window), http2DefaultMaxFrameSize)
+		client.writeFrame(http2FrameData, 0, 1, []byte(body[sent:sent+n]))
+		sent += n
+		window -= int64(n)
+	}
+	client.writeFrame(http2FrameData, http2FlagEndStream, 1, nil)
+
+	response := client.readResponses(1)[1]
+	if len(response.body) != len(body)/1000 {
+		t.Errorf("Expected the handler to read %d bytes, but got %d", len(body), len(response.body)*1000)
+	}
+}
+
+func TestHTTP2ConnectionWindow(t *testing.T) {
+	release, received := make(chan struct{}), make(chan struct{})
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		if req.Path == "/ignore" {
+			<-received
+			res.WithStatus(200)
+			return
+		}
+		<-release
+		echoHTTP2Handler(req, res)
+	})}
+	client := dialTestHTTP2(t, startTestServer(t, server))
+
+	// Collect the window increments the server sends by stream, until it goes quiet
+	windowUpdates := func() map[uint32]uint32 {
+		t.Helper()
+		updates := map[uint32]uint32{}
+		for {
+			client.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			frame, err := client.readFrame()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				client.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				return updates
+			}
+			if err != nil {
+				t.Fatalf("Failed to read frame: %v", err)
+			}
+			if frame.typ == http2FrameWindowUpdate {
+				updates[frame.streamID] += binary.BigEndian.Uint32(frame.payload)
+			}
+		}
+	}
+	windowUpdates() // The initial window of the connection, and the SETTINGS
+
+	// The padding is given back right away, the data only once the handler reads it
+	client.writeHeaders(1, []hpackField{{":method", "POST"}, {":scheme", "http"}, {":path", "/"}}, false)
+	client.writeFrame(http2FrameData, http2FlagPadded, 1, append([]byte{3}, "hello\x00\x00\x00"...))
+	if updates := windowUpdates(); updates[0] != 4 || updates[1] != 4 {
+		t.Errorf("Expected the padding of 4 bytes to be given back, but got %v", updates)
+	}
+	close(release)
+	if updates := windowUpdates(); updates[0] != 5 || updates[1] != 5 {
+		t.Errorf("Expected the 5 bytes read to be given back, but got %v", updates)
+	}
+	client.writeFrame(http2FrameData, http2FlagEndStream, 1, nil)
+	if response := client.readResponses(1)[1]; response.body != "POST / hello" {
+		t.Errorf("Expected the body to be read, but got %q", response.body)
+	}
+
+	// A body the handler never reads is given back to the connection once the stream is done
+	client.writeHeaders(3, []hpackField{{":method", "POST"}, {":scheme", "http"}, {":path", "/ignore"}}, false)
+	client.writeFrame(http2FrameData, http2FlagEndStream, 3, []byte("0123456789"))
+	client.writeFrame(http2FramePing, 0, 0, []byte("received"))
+	client.expectFrame(http2FramePing) // Frames are handled in order, so the body was buffered
+	close(received)
+	client.readResponses(3)
+	if updates := windowUpdates(); updates[0] != 10 {
+		t.Errorf("Expected the 10 bytes dropped to be given back, but got %v", updates)
+	}
+}
+
+func TestHTTP2Ping(t *testing.T) {
+	client := dialTestHTTP2(t, startTestServer(t, &Server{}))
+	client.writeFrame(http2FramePing, 0, 0, []byte("12345678"))
+
+	frame := client.expectFrame(http2FramePing)
+	if frame.flags&http2FlagAck == 0 || string(frame.payload) != "12345678" {
+		t.Errorf("Expected a PING acknowledgement with the same payload, but got flags %x and %q", frame.flags, frame.payload)
+	}
+}
+
+func TestHTTP2ConnectionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(c *testHTTP2Client)
+		code http2ErrorCode
+	}{
+		{"DATA on stream 0", func(c *testHTTP2Client) {
+			c.writeFrame(http2FrameData, 0, 0, []byte("x"))
+		}, http2ProtocolError},
+		{"HEADERS on an even stream", func(c *testHTTP2Client) {
+			c.request(2, "GET", "/", "")
+		}, http2ProtocolError},
+		{"PING of the wrong size", func(c *testHTTP2Client) {
+			c.writeFrame(http2FramePing, 0, 0, []byte("1234"))
+		}, http2FrameSizeError},
+		{"invalid header block", func(c *testHTTP2Client) {
+			c.writeFrame(http2FrameHeaders, http2FlagEndHeaders|http2FlagEndStream, 1, []byte{0x80})
+		}, http2CompressionError},
+		{"CONTINUATION without HEADERS", func(c *testHTTP2Client) {
+			c.writeFrame(http2FrameContinuation, http2FlagEndHeaders, 1, nil)
+		}, http2ProtocolError},
+		{"frame too large", func(c *testHTTP2Client) {
+			c.writeFrame(http2FrameData, 0, 1, make([]byte, http2DefaultMaxFrameSize+1))
+		}, http2FrameSizeError},
+		{"invalid initial window size", func(c *testHTTP2Client) {
+			c.writeFrame(http2FrameSettings, 0, 0, encodeHTTP2Settings([]http2Setting{{http2SettingInitialWindowSize, 1 << 31}}))
+		}, http2FlowControlError},
+	}
+
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)})
+	for _, test := range tests {
+		client := dialTestHTTP2(t, addr)
+		test.send(client)
+
+		frame := client.expectFrame(http2FrameGoAway)
+		if code := http2ErrorCode(binary.BigEndian.Uint32(frame.payload[4:])); code != test.code {
+			t.Errorf("Expected GOAWAY with code %d for %s, but got %d", test.code, test.name, code)
+		}
+		// The server closes the connection afterwards
+		if _, err := client.readFrame(); err == nil {
+			t.Errorf("Expected the connection to be closed after %s", test.name)
+		}
+	}
+}
+
+func TestHTTP2MalformedRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []hpackField
+	}{
+		{"missing :path", []hpackField{{":method", "GET"}, {":scheme", "http"}}},
+		{"unknown pseudo-header", []hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {":protocol", "x"}}},
+		{"pseudo-header after a field", []hpackField{{":method", "GET"}, {":scheme", "http"}, {"accept", "*/*"}, {":path", "/"}}},
+		{"upper-case name", []hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {"Accept", "*/*"}}},
+		{"connection-specific field", []hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {"connection", "keep-alive"}}},
+		{"body shorter than Content-Length", []hpackField{{":method", "GET"}, {":scheme", "http"}, {":path", "/"}, {"content-length", "5"}}},
+	}
+
+	client := dialTestHTTP2(t, startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)}))
+	for i, test := range tests {
+		streamID := uint32(2*i + 1)
+		client.writeHeaders(streamID, test.fields, true)
+
+		frame := client.expectFrame(http2FrameRSTStream)
+		code := http2ErrorCode(binary.BigEndian.Uint32(frame.payload))
+		if frame.streamID != streamID || code != http2ProtocolError {
+			t.Errorf("Expected RST_STREAM with PROTOCOL_ERROR on stream %d for %s, but got code %d on stream %d", streamID, test.name, code, frame.streamID)
+		}
+	}
+
+	// The connection is still usable afterwards
+	client.request(99, "GET", "/ok", "")
+	if response := client.readResponses(99)[99]; response.status != "200" {
+		t.Errorf("Expected 200 after the malformed requests, but got %s", response.status)
+	}
+}
+
+func TestHTTP2FramesOnClosedStreams(t *testing.T) {
+	// The handler answers without waiting for the body, so the stream is closed while the client still sends
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		res.WithStatus(200).WithBody("early")
+	})}
+	client := dialTestHTTP2(t, startTestServer(t, server))
+	client.writeHeaders(1, []hpackField{{":method", "PUT"}, {":scheme", "http"}, {":path", "/"}}, false)
+
+	if response := client.readResponses(1)[1]; response.status != "200" {
+		t.Fatalf("Expected 200, but got %s", response.status)
+	}
+	frame := client.expectFrame(http2FrameRSTStream)
+	if code := http2ErrorCode(binary.BigEndian.Uint32(frame.payload)); frame.streamID != 1 || code != http2NoError {
+		t.Fatalf("Expected RST_STREAM with NO_ERROR on stream 1, but got code %d on stream %d", code, frame.streamID)
+	}
+
+	// The rest of the body and the trailers crossed the RST_STREAM, and are ignored
+	client.writeFrame(http2FrameData, 0, 1, []byte("late"))
+	client.writeHeaders(1, []hpackField{{"x-checksum", "abc"}}, true)
+
+	// The connection is still usable afterwards, with the trailers in the dynamic table
+	client.request(3, "GET", "/", "", hpackField{"x-checksum", "abc"})
+	if response := client.readResponses(3)[3]; response.status != "200" {
+		t.Errorf("Expected 200 after the frames on the closed stream, but got %s", response.status)
+	}
+}
+
+func TestHTTP2HeaderListTooLarge(t *testing.T) {
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler), MaxHeaderBytes: 1024})
+	client := dialTestHTTP2(t, addr)
+
+	// A field that fits, but takes only a byte to repeat once it is in the dynamic table
+	field := hpackField{"x-padding", strings.Repeat("a", 300)}
+	client.request(1, "GET", "/", "", field)
+	if response := client.readResponses(1)[1]; response.status != "200" {
+		t.Fatalf("Expected 200, but got %s", response.status)
+	}
+
+	// A small block that decodes to a list over the limit
+	client.request(3, "GET", "/", "", field, field, field, field)
+	if response := client.readResponses(3)[3]; response.status != "431" {
+		t.Errorf("Expected 431 for a header list over the limit, but got %s", response.status)
+	}
+
+	// The dynamic table is still in sync
+	client.request(5, "GET", "/ok", "", field)
+	if response := client.readResponses(5)[5]; response.status != "200" || response.body != "GET /ok " {
+		t.Errorf("Expected 200 after the header list over the limit, but got %s with %q", response.status, response.body)
+	}
+
+	// A block over the limit can't be skipped without decoding it, so it ends the connection
+	client = dialTestHTTP2(t, addr)
+	client.request(1, "GET", "/", "", hpackField{"x-padding", strings.Repeat("a", 2000)})
+	frame := client.expectFrame(http2FrameGoAway)
+	if code := http2ErrorCode(binary.BigEndian.Uint32(frame.payload[4:])); code != http2EnhanceYourCalm {
+		t.Errorf("Expected GOAWAY with ENHANCE_YOUR_CALM for a header block over the limit, but got %d", code)
+	}
+}
+
+func TestHTTP2RequestBodyTimeout(t *testing.T) {
+	server := &Server{Handler: HandlerFunc(echoHTTP2Handler), ReadTimeout: 100 * time.Millisecond, IdleTimeout: time.Minute}
+	client := dialTestHTTP2(t, startTestServer(t, server))
+
+	// The body never ends, though the connection stays busy
+	client.writeHeaders(1, []hpackField{{":method", "PUT"}, {":scheme", "http"}, {":path", "/"}}, false)
+	client.writeFrame(http2FrameData, 0, 1, []byte("part"))
+	client.writeFrame(http2FramePing, 0, 0, []byte("12345678"))
+
+	start := time.Now()
+	if response := client.readResponses(1)[1]; response.status != "408" {
+		t.Errorf("Expected 408 for a body that took too long, but got %s", response.status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the body to time out after 100ms, but it took %s", elapsed)
+	}
+}
+
+func TestHTTP2Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &Server{IdleTimeout: time.Minute, Handler: HandlerFunc(func(req *Request, res *Response) {
+		if req.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		res.WithStatus(200).WithBody("done")
+	})}
+	addr := startTestServer(t, server)
+
+	// A connection that never opened a stream, and one with a request in-flight
+	idle := dialTestHTTP2(t, addr)
+	idle.writeFrame(http2FramePing, 0, 0, []byte("12345678"))
+	idle.expectFrame(http2FramePing)
+	active := dialTestHTTP2(t, addr)
+	active.request(1, "GET", "/slow", "")
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- server.Shutdown(context.Background()) }()
+
+	// Both are told to go away right away, with the in-flight stream as the last one processed
+	for _, test := range []struct {
+		client       *testHTTP2Client
+		lastStreamID uint32
+	}{{idle, 0}, {active, 1}} {
+		frame := test.client.expectFrame(http2FrameGoAway)
+		lastStreamID, code := binary.BigEndian.Uint32(frame.payload), http2ErrorCode(binary.BigEndian.Uint32(frame.payload[4:]))
+		if lastStreamID != test.lastStreamID || code != http2NoError {
+			t.Errorf("Expected GOAWAY with NO_ERROR and last stream %d, but got code %d and last stream %d", test.lastStreamID, code, lastStreamID)
+		}
+	}
+	if _, err := idle.readFrame(); err == nil {
+		t.Errorf("Expected the idle connection to be closed")
+	}
+
+	// The in-flight request completes, and Shutdown returns once its connection is closed
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Expected Shutdown to wait for the in-flight request, but it returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if response := active.readResponses(1)[1]; response.status != "200" || response.body != "done" {
+		t.Errorf("Expected the in-flight request to complete, but got %s with %q", response.status, response.body)
+	}
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Expected Shutdown to succeed, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected Shutdown to return once the streams are done, instead of waiting for the idle timeout")
+	}
+}
+
+func TestHTTP2H2CUpgrade(t *testing.T) {
+	conn := dialTestServer(t, startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)}))
+	reader := bufio.NewReader(conn)
+
+	settings := base64.RawURLEncoding.EncodeToString(encodeHTTP2Settings([]http2Setting{{http2SettingEnablePush, 0}}))
+	conn.Write([]byte("GET /upgraded HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\n" +
+		"Upgrade: h2c\r\nHTTP2-Settings: " + settings + "\r\n\r\n"))
+
+	status, headers, _ := readTestResponse(t, reader)
+	if upgrade, _ := headers.Get("Upgrade"); status != "HTTP/1.1 101 Switching Protocols" || upgrade != "h2c" {
+		t.Fatalf("Expected 101 Switching Protocols to h2c, but got %q with Upgrade %q", status, upgrade)
+	}
+
+	// The request is answered on stream 1 once the client sends its preface
+	conn.Write([]byte(http2ClientPreface))
+	client := newTestHTTP2Client(t, conn, reader)
+	client.writeFrame(http2FrameSettings, 0, 0, nil)
+	response := client.readResponses(1)[1]
+	if response.status != "200" || response.body != "GET /upgraded " {
+		t.Errorf("Expected 200 with body %q, but got %s with body %q", "GET /upgraded ", response.status, response.body)
+	}
+
+	// Later requests use new streams
+	client.request(3, "GET", "/next", "")
+	if response := client.readResponses(3)[3]; response.body != "GET /next " {
+		t.Errorf("Expected body %q, but got %q", "GET /next ", response.body)
+	}
+}
+
+func TestHTTP2ALPN(t *testing.T) {
+	certFile, keyFile, _ := createTestCertificate(t, t.TempDir(), "localhost", "localhost")
+	addr := startTestTLSServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler)}, certFile, keyFile)
+
+	tests := []struct {
+		protos   []string
+		expected string
+	}{
+		{[]string{"h2", "http/1.1"}, "h2"},
+		{[]string{"http/1.1"}, "http/1.1"},
+	}
+
+	for _, test := range tests {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: test.protos})
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != test.expected {
+			t.Errorf("Expected %q to be negotiated, but got %q", test.expected, protocol)
+			continue
+		}
+
+		reader := bufio.NewReader(conn)
+		if test.expected == "h2" {
+			conn.Write([]byte(http2ClientPreface))
+			client := newTestHTTP2Client(t, conn, reader)
+			client.writeFrame(http2FrameSettings, 0, 0, nil)
+			client.request(1, "GET", "/secure", "")
+			if response := client.readResponses(1)[1]; response.body != "GET /secure " {
+				t.Errorf("Expected body %q over h2, but got %q", "GET /secure ", response.body)
+			}
+		} else {
+			conn.Write([]byte("GET /secure HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			if _, _, body := readTestResponse(t, reader); body != "GET /secure " {
+				t.Errorf("Expected body %q over HTTP/1.1, but got %q", "GET /secure ", body)
+			}
+		}
+	}
+}
+
+func TestHTTP2Disabled(t *testing.T) {
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(echoHTTP2Handler), DisableHTTP2: true})
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+
+	// The preface is an HTTP/1.1 request with an unsupported version
+	conn.Write([]byte(http2ClientPreface))
+	if status, _, _ := readTestResponse(t, reader); status != "HTTP/1.1 505 HTTP Version Not Supported" {
+		t.Errorf("Expected 505 HTTP Version Not Supported, but got %q", status)
+	}
+
+	// Upgrade requests are answered over HTTP/1.1
+	conn = dialTestServer(t, addr)
+	reader = bufio.NewReader(conn)
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n"))
+	if status, _, _ := readTestResponse(t, reader); status != "HTTP/1.1 200 OK" {
+		t.Errorf("Expected 200 OK over HTTP/1.1, but got %q", status)
+	}
+}
+
+func TestHTTP2PrefaceDetection(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected bool
+	}{
+		{http2ClientPreface, true},
+		{"GET / HTTP/1.1\r\n\r\n", false},
+		{"PRI / HTTP/1.1\r\n\r\n", false},
+		{"P", false}, // The connection ends before the preface is complete
+	}
+
+	for _, test := range tests {
+		reader := bufio.NewReader(bytes.NewReader([]byte(test.data)))
+		if got := hasHTTP2Preface(reader); got != test.expected {
+			t.Errorf("Expected %v for %q, but got %v", test.expected, test.data, got)
+		}
+		// Nothing is consumed
+		if reader.Buffered() != len(test.data) {
+			t.Errorf("Expected the data to stay buffered, but %d of %d bytes are", reader.Buffered(), len(test.data))
+		}
+	}
+}
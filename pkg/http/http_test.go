@@ -119,8 +119,8 @@ func TestWithBody(t *testing.T) {
 	http := createHTTPMessage().WithBody(body)
 
 	// Check if the body is set correctly
-	if http.Body != body {
-		t.Errorf("Expected body %s, but got %s", body, http.Body)
+	if http.content != body {
+		t.Errorf("Expected body %s, but got %s", body, http.content)
 	}
 }
 
@@ -160,8 +160,8 @@ func TestParseMessage(t *testing.T) {
 	}
 
 	// Check if the body is set correctly
-	if http.Body != "{\"key\": \"value\"}" {
-		t.Errorf("Expected body {\"key\": \"value\"}, but got %s", http.Body)
+	if http.content != "{\"key\": \"value\"}" {
+		t.Errorf("Expected body {\"key\": \"value\"}, but got %s", http.content)
 	}
 }
 
@@ -193,8 +193,8 @@ func TestParseMessageText(t *testing.T) {
 	}
 
 	// Check if the body is set correctly
-	if http.Body != "Hello, World!" {
-		t.Errorf("Expected body Hello, World!, but got %s", http.Body)
+	if http.content != "Hello, World!" {
+		t.Errorf("Expected body Hello, World!, but got %s", http.content)
 	}
 }
 
@@ -226,8 +226,8 @@ func TestParseMessageHTML(t *testing.T) {
 
 	// Check if the body is set correctly
 	doc := "<!DOCTYPE html><html><head><title>TITLE</title></head><body><h1>Hello, World!</h1></body></html>"
-	if http.Body != doc {
-		t.Errorf("Expected body:\n\n"+doc+"\n\n", http.Body)
+	if http.content != doc {
+		t.Errorf("Expected body:\n\n"+doc+"\n\n", http.content)
 	}
 }
 
@@ -256,8 +256,8 @@ func TestParseMessageWithNoBody(t *testing.T) {
 	}
 
 	// Check if the body is set correctly
-	if http.Body != "" {
-		t.Errorf("Expected empty body, but got %s", http.Body)
+	if http.content != "" {
+		t.Errorf("Expected empty body, but got %s", http.content)
 	}
 
 }
@@ -278,9 +278,9 @@ func TestString(t *testing.T) {
 
 	expected := strings.Join([]string{
 		"GET / HTTP/1.1",
-		"Content-Type: application/json",
-		"Content-Length: 16",
 		"Authorization: Bearer token",
+		"Content-Length: 16",
+		"Content-Type: application/json",
 		"",
 		"{\"key\": \"value\"}",
 	}, CRLF)
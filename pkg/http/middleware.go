@@ -0,0 +1,36 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// Logger is a Middleware that prints every request and the response it produced
+func Logger(next Handler) Handler {
+	return HandlerFunc(func(req *Request, res *Response) {
+		// Print the request
+		fmt.Printf("Request:\n%+v\n", req)
+
+		next.ServeHTTP(req, res)
+
+		// Print the response
+		fmt.Println("Response:\n", res.String())
+	})
+}
+
+// Recoverer is a Middleware that recovers from panics in the handler
+// and responds with 500 Internal Server Error instead of crashing the server
+func Recoverer(next Handler) Handler {
+	return HandlerFunc(func(req *Request, res *Response) {
+		defer func() {
+			if err := recover(); err != nil {
+				fmt.Printf("Recovered from panic while handling %s %s: %v\n%s", req.Method, req.Path, err, debug.Stack())
+				// Discard whatever the handler had written so far
+				res.reset()
+				res.WithStatus(http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(req, res)
+	})
+}
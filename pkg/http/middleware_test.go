@@ -0,0 +1,71 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	// Record the order in which the middlewares and handler run
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(req *Request, res *Response) {
+				calls = append(calls, name+":before")
+				next.ServeHTTP(req, res)
+				calls = append(calls, name+":after")
+			})
+		}
+	}
+	handler := HandlerFunc(func(req *Request, res *Response) {
+		calls = append(calls, "handler")
+	})
+
+	Chain(handler, middleware("first"), middleware("second")).ServeHTTP(createTestRequest("GET", "/"), CreateResponse())
+
+	expected := "first:before second:before handler second:after first:after"
+	if strings.Join(calls, " ") != expected {
+		t.Errorf("Expected calls %q, but got %q", expected, strings.Join(calls, " "))
+	}
+}
+
+func TestRouterUse(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /", func(req *Request, res *Response) {
+		res.WithStatus(200)
+	})
+
+	// Add a header to every response
+	router.Use(func(next Handler) Handler {
+		return HandlerFunc(func(req *Request, res *Response) {
+			next.ServeHTTP(req, res)
+			res.Headers.Set("X-Middleware", "true")
+		})
+	})
+
+	// The middleware must also wrap requests that don't match any route
+	for _, path := range []string{"/", "/unknown"} {
+		res := CreateResponse()
+		router.ServeHTTP(createTestRequest("GET", path), res)
+		if !res.Headers.Contains("X-Middleware") {
+			t.Errorf("Expected the middleware to run for %s", path)
+		}
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	handler := HandlerFunc(func(req *Request, res *Response) {
+		res.WithStatus(200).WithHeaders(map[string]string{"X-Partial": "true"})
+		panic("something went wrong")
+	})
+
+	res := CreateResponse()
+	Recoverer(handler).ServeHTTP(createTestRequest("GET", "/"), res)
+
+	if res.statusCode != 500 {
+		t.Errorf("Expected status 500, but got %d", res.statusCode)
+	}
+	if res.Headers.Contains("X-Partial") {
+		t.Errorf("Expected the headers set before the panic to be discarded")
+	}
+}
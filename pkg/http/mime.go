@@ -0,0 +1,114 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The number of bytes http.DetectContentType looks at to sniff the media type of content
+const sniffLen = 512
+
+// The media types of files by their lower-case extension
+var mimeTypes = struct {
+	sync.RWMutex
+	byExt map[string]string
+}{
+	byExt: map[string]string{
+		// Text
+		".html": "text/html; charset=utf-8",
+		".htm":  "text/html; charset=utf-8",
+		".css":  "text/css; charset=utf-8",
+		".csv":  "text/csv; charset=utf-8",
+		".txt":  "text/plain; charset=utf-8",
+		".md":   "text/markdown; charset=utf-8",
+		".xml":  "text/xml; charset=utf-8",
+
+		// Scripts and data
+		".js":   "text/javascript; charset=utf-8",
+		".mjs":  "text/javascript; charset=utf-8",
+		".json": "application/json",
+		".map":  "application/json",
+		".wasm": "application/wasm",
+		".pdf":  "application/pdf",
+
+		// Images
+		".avif": "image/avif",
+		".gif":  "image/gif",
+		".ico":  "image/vnd.microsoft.icon",
+		".jpeg": "image/jpeg",
+		".jpg":  "image/jpeg",
+		".png":  "image/png",
+		".svg":  "image/svg+xml",
+		".webp": "image/webp",
+
+		// Fonts
+		".otf":   "font/otf",
+		".ttf":   "font/ttf",
+		".woff":  "font/woff",
+		".woff2": "font/woff2",
+
+		// Audio and video
+		".mp3":  "audio/mpeg",
+		".ogg":  "audio/ogg",
+		".wav":  "audio/wav",
+		".mp4":  "video/mp4",
+		".webm": "video/webm",
+
+		// Archives
+		".gz":  "application/gzip",
+		".tar": "application/x-tar",
+		".zip": "application/zip",
+	},
+}
+
+// Register the media type of files with the given extension (e.g. `.md` -> `text/markdown`),
+// replacing the built-in mapping if there is one
+func RegisterMIMEType(ext, contentType string) error {
+	if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+		return fmt.Errorf("invalid extension %q: must start with a dot", ext)
+	}
+	if mediaType, _, _ := strings.Cut(contentType, ";"); !strings.Contains(mediaType, "/") {
+		return fmt.Errorf("invalid media type %q for %s", contentType, ext)
+	}
+
+	mimeTypes.Lock()
+	defer mimeTypes.Unlock()
+	mimeTypes.byExt[strings.ToLower(ext)] = contentType
+	return nil
+}
+
+// Returns the media type of a file based on its extension (e.g. `report.html` -> `text/html; charset=utf-8`),
+// or an empty string if the extension is unknown
+func TypeByExtension(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+
+	mimeTypes.RLock()
+	defer mimeTypes.RUnlock()
+	return mimeTypes.byExt[ext]
+}
+
+// Returns the media type of a file, based on its extension or else on its first 512 bytes.
+// The content is rewound to the start afterwards.
+// See https://mimesniff.spec.whatwg.org/ for the sniffing algorithm
+func DetectFileType(name string, content io.ReadSeeker) (string, error) {
+	if contentType := TypeByExtension(name); contentType != "" {
+		return contentType, nil
+	}
+
+	var buf [sniffLen]byte
+	n, err := io.ReadFull(content, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
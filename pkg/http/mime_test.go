@@ -0,0 +1,90 @@
+package http
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTypeByExtension(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "report.html", expected: "text/html; charset=utf-8"},
+		{name: "fixtures/data.json", expected: "application/json"},
+		{name: "LOGO.PNG", expected: "image/png"},
+		{name: "archive.tar.gz", expected: "application/gzip"},
+		{name: "unknown.xyz", expected: ""},
+		{name: "Makefile", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if contentType := TypeByExtension(tc.name); contentType != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, contentType)
+			}
+		})
+	}
+}
+
+func TestDetectFileType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "By extension", content: "not really json", expected: "application/json"},
+		{name: "Sniffed HTML", content: "<!DOCTYPE html><html></html>", expected: "text/html; charset=utf-8"},
+		{name: "Sniffed PNG", content: "\x89PNG\x0D\x0A\x1A\x0A rest of the image", expected: "image/png"},
+		{name: "Sniffed text", content: "just some words", expected: "text/plain; charset=utf-8"},
+		{name: "Sniffed binary", content: "\x00\x01\x02\x03", expected: "application/octet-stream"},
+		{name: "Empty", content: "", expected: "text/plain; charset=utf-8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := "file"
+			if tc.name == "By extension" {
+				name = "file.json"
+			}
+			content := strings.NewReader(tc.content)
+
+			contentType, err := DetectFileType(name, content)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if contentType != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, contentType)
+			}
+
+			// The content must be readable from the start again
+			rest, _ := io.ReadAll(content)
+			if string(rest) != tc.content {
+				t.Errorf("Expected the content to be rewound, but got %q", rest)
+			}
+		})
+	}
+}
+
+func TestRegisterMIMEType(t *testing.T) {
+	if err := RegisterMIMEType(".Report", "text/html; charset=utf-8"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	t.Cleanup(func() {
+		mimeTypes.Lock()
+		defer mimeTypes.Unlock()
+		delete(mimeTypes.byExt, ".report")
+	})
+
+	if contentType := TypeByExtension("weekly.report"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Expected the registered type, but got %q", contentType)
+	}
+
+	// Invalid mappings are rejected
+	for _, mapping := range [][2]string{{"txt", "text/plain"}, {".", "text/plain"}, {".txt", "plain"}} {
+		if err := RegisterMIMEType(mapping[0], mapping[1]); err == nil {
+			t.Errorf("Expected an error registering %s=%s", mapping[0], mapping[1])
+		}
+	}
+}
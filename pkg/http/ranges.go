@@ -0,0 +1,229 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc9110#section-14
+// --------------------------------------------------------------------------
+
+// The most ranges a single request may ask for. Asking for more is a sign of abuse,
+// so the Range header is ignored and the whole content is sent instead
+const maxRanges = 100
+
+// Returned by parseRange when none of the requested ranges overlap the content
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// Returned by parseRange when the Range header is not a valid byte range set, so it must be ignored
+var errInvalidRange = errors.New("invalid range")
+
+// A range of bytes of the content
+type byteRange struct {
+	start  int64 // The offset of the first byte
+	length int64 // The number of bytes
+}
+
+// The value of the `Content-Range` header for the range (e.g. `bytes 0-499/1234`)
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// Parse a `Range` header (e.g. `bytes=0-499, -500`) against content of the given size.
+// Ranges that start past the end of the content are left out, and the others are clipped to it.
+// See https://datatracker.ietf.org/doc/html/rfc9110#section-14.1.2
+func parseRange(header string, size int64) ([]byteRange, error) {
+	unit, set, found := strings.Cut(header, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, errInvalidRange // Other range units are not supported
+	}
+
+	specs := strings.Split(set, ",")
+	if len(specs) > maxRanges {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	var total int64 // The number of bytes in all the ranges
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue // Empty list elements are allowed
+		}
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, errInvalidRange
+		}
+
+		var r byteRange
+		if first == "" {
+			// A suffix range (e.g. `-500`) asks for the last bytes of the content
+			n, err := parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 || size == 0 {
+				continue // An empty suffix is never satisfiable
+			}
+			r = byteRange{start: max(size-n, 0), length: min(n, size)}
+		} else {
+			start, err := parseRangeInt(first)
+			if err != nil {
+				return nil, err
+			}
+			end := size - 1 // An open range (e.g. `500-`) goes until the end
+			if last != "" {
+				if end, err = parseRangeInt(last); err != nil {
+					return nil, err
+				}
+				if end < start {
+					return nil, errInvalidRange
+				}
+			}
+			if start >= size {
+				continue // Starts past the end of the content
+			}
+			r = byteRange{start: start, length: min(end, size-1) - start + 1}
+		}
+
+		ranges = append(ranges, r)
+		total += r.length
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	// Overlapping ranges that add up to more than the content are cheaper to send as a whole
+	if total > size {
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// Parse a non-negative position of a byte range
+func parseRangeInt(s string) (int64, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, errInvalidRange
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errInvalidRange
+	}
+	return n, nil
+}
+
+// Checks if the `If-Range` precondition of the request holds against the current entity-tag and
+// modification time of the file, so that the requested ranges may be sent.
+// Without the header, the ranges are always sent. See https://datatracker.ietf.org/doc/html/rfc9110#section-13.1.5
+func ifRangeMatches(req *Request, etag string, modTime time.Time) bool {
+	ifRange, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+
+	// An entity-tag must be a strong match
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return matchesETag(ifRange, etag, true)
+	}
+
+	// A date must exactly match the last modification time of the file
+	date, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return modTime.Truncate(time.Second).Equal(date)
+}
+
+// Respond with the ranges of the file requested by the `Range` header.
+// Returns false if the whole file should be sent instead, because the Range header is missing, invalid,
+// or fails the If-Range precondition.
+func serveRanges(req *Request, res *Response, file *os.File, info fs.FileInfo, etag string) bool {
+	header, ok := req.Headers.Get("Range")
+	if !ok || (req.Method != "GET" && req.Method != "HEAD") || !ifRangeMatches(req, etag, info.ModTime()) {
+		return false
+	}
+
+	size := info.Size()
+	ranges, err := parseRange(header, size)
+	if errors.Is(err, errUnsatisfiableRange) {
+		file.Close()
+		res.WithStatus(http.StatusRequestedRangeNotSatisfiable).WithHeaders(map[string]string{
+			"Content-Range": fmt.Sprintf("bytes */%d", size),
+		})
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	// A single range is sent as is
+	if len(ranges) == 1 {
+		r := ranges[0]
+		if _, err := file.Seek(r.start, io.SeekStart); err != nil {
+			file.Close()
+			res.WithStatus(http.StatusInternalServerError)
+			return true
+		}
+		res.WithStatus(http.StatusPartialContent).WithHeaders(map[string]string{
+			"Content-Range": r.contentRange(size),
+		})
+		res.WithBodyReader(readCloser{io.LimitReader(file, r.length), file}, r.length)
+		return true
+	}
+
+	// Multiple ranges are sent as the parts of a multipart/byteranges body.
+	// See https://datatracker.ietf.org/doc/html/rfc9110#section-14.6
+	boundary, err := randomBoundary()
+	if err != nil {
+		file.Close()
+		res.WithStatus(http.StatusInternalServerError)
+		return true
+	}
+	contentType, _ := res.Headers.Get("Content-Type")
+
+	readers := make([]io.Reader, 0, 2*len(ranges)+1)
+	var length int64
+	for i, r := range ranges {
+		partHeader := fmt.Sprintf("--%s%sContent-Type: %s%sContent-Range: %s%s%s",
+			boundary, CRLF, contentType, CRLF, r.contentRange(size), CRLF, CRLF)
+		if i > 0 {
+			partHeader = CRLF + partHeader // Each part after the first starts on a new line
+		}
+		readers = append(readers, strings.NewReader(partHeader), io.NewSectionReader(file, r.start, r.length))
+		length += int64(len(partHeader)) + r.length
+	}
+	closing := CRLF + "--" + boundary + "--" + CRLF
+	readers = append(readers, strings.NewReader(closing))
+	length += int64(len(closing))
+
+	res.WithStatus(http.StatusPartialContent).WithHeaders(map[string]string{
+		"Content-Type": "multipart/byteranges; boundary=" + boundary,
+	})
+	res.WithBodyReader(readCloser{io.MultiReader(readers...), file}, length)
+	return true
+}
+
+// Generate a random boundary for a multipart body, that is unlikely to appear in the content
+func randomBoundary() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// readCloser reads from a reader, and closes a separate closer (e.g. a section of a file, and the file itself)
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,221 @@
+package http
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		header   string
+		size     int64
+		expected []byteRange
+		err      error
+	}{
+		{header: "bytes=0-4", size: 10, expected: []byteRange{{start: 0, length: 5}}},
+		{header: "bytes=5-", size: 10, expected: []byteRange{{start: 5, length: 5}}},
+		{header: "bytes=-3", size: 10, expected: []byteRange{{start: 7, length: 3}}},
+		{header: "bytes=-30", size: 10, expected: []byteRange{{start: 0, length: 10}}},
+		{header: "bytes=8-20", size: 10, expected: []byteRange{{start: 8, length: 2}}},
+		{header: "bytes=0-1, 4-5", size: 10, expected: []byteRange{{start: 0, length: 2}, {start: 4, length: 2}}},
+		{header: "BYTES = 0-1,,", size: 10, expected: []byteRange{{start: 0, length: 2}}},
+		{header: "bytes=0-1, 20-30", size: 10, expected: []byteRange{{start: 0, length: 2}}},
+		{header: "bytes=10-", size: 10, err: errUnsatisfiableRange},
+		{header: "bytes=-0", size: 10, err: errUnsatisfiableRange},
+		{header: "bytes=0-", size: 0, err: errUnsatisfiableRange},
+		{header: "bytes=5-4", size: 10, err: errInvalidRange},
+		{header: "bytes=a-b", size: 10, err: errInvalidRange},
+		{header: "bytes=+1-2", size: 10, err: errInvalidRange},
+		{header: "bytes=5", size: 10, err: errInvalidRange},
+		{header: "items=0-5", size: 10, err: errInvalidRange},
+		{header: "bytes=0-9, 0-9", size: 10, err: errInvalidRange},
+		{header: "bytes=" + strings.Repeat("0-0,", maxRanges+1), size: 10, err: errInvalidRange},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			ranges, err := parseRange(tc.header, tc.size)
+			if err != tc.err {
+				t.Fatalf("Expected error %v, but got %v", tc.err, err)
+			}
+			if len(ranges) != len(tc.expected) {
+				t.Fatalf("Expected ranges %v, but got %v", tc.expected, ranges)
+			}
+			for i := range ranges {
+				if ranges[i] != tc.expected[i] {
+					t.Errorf("Expected range %v, but got %v", tc.expected[i], ranges[i])
+				}
+			}
+		})
+	}
+}
+
+// Create a Root with a single file `digits.txt` containing `0123456789`, modified at the given time
+func createRangeTestRoot(t *testing.T, modTime time.Time) *Root {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "digits.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatalf("Failed to open the root: %v", err)
+	}
+	return root
+}
+
+func TestServeFileRange(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	root := createRangeTestRoot(t, modTime)
+
+	testCases := []struct {
+		name         string
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{
+			name:    "No range",
+			headers: map[string]string{},
+			status:  http.StatusOK,
+			body:    "0123456789",
+		},
+		{
+			name:         "Single range",
+			headers:      map[string]string{"Range": "bytes=2-5"},
+			status:       http.StatusPartialContent,
+			body:         "2345",
+			contentRange: "bytes 2-5/10",
+		},
+		{
+			name:         "Suffix range",
+			headers:      map[string]string{"Range": "bytes=-3"},
+			status:       http.StatusPartialContent,
+			body:         "789",
+			contentRange: "bytes 7-9/10",
+		},
+		{
+			name:         "Unsatisfiable",
+			headers:      map[string]string{"Range": "bytes=20-"},
+			status:       http.StatusRequestedRangeNotSatisfiable,
+			contentRange: "bytes */10",
+		},
+		{
+			name:    "Invalid range is ignored",
+			headers: map[string]string{"Range": "bytes=x-y"},
+			status:  http.StatusOK,
+			body:    "0123456789",
+		},
+		{
+			name:         "If-Range with matching date",
+			headers:      map[string]string{"Range": "bytes=0-0", "If-Range": modTime.Format(http.TimeFormat)},
+			status:       http.StatusPartialContent,
+			body:         "0",
+			contentRange: "bytes 0-0/10",
+		},
+		{
+			name:    "If-Range with outdated date",
+			headers: map[string]string{"Range": "bytes=0-0", "If-Range": modTime.Add(-time.Hour).Format(http.TimeFormat)},
+			status:  http.StatusOK,
+			body:    "0123456789",
+		},
+		{
+			name:    "If-Range with unknown entity-tag",
+			headers: map[string]string{"Range": "bytes=0-0", "If-Range": `"abc"`},
+			status:  http.StatusOK,
+			body:    "0123456789",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestRequest("GET", "/digits.txt")
+			for name, value := range tc.headers {
+				req.Headers.Set(name, value)
+			}
+			res := serveTestRequest(t, HandlerFunc(func(req *Request, res *Response) {
+				ServeFile(req, res, root, "digits.txt")
+			}), req)
+
+			if res.statusCode != tc.status {
+				t.Fatalf("Expected status %d, but got %d", tc.status, res.statusCode)
+			}
+			if res.content != tc.body {
+				t.Errorf("Expected body %q, but got %q", tc.body, res.content)
+			}
+			if contentRange, _ := res.Headers.Get("Content-Range"); contentRange != tc.contentRange {
+				t.Errorf("Expected Content-Range %q, but got %q", tc.contentRange, contentRange)
+			}
+			if acceptRanges, _ := res.Headers.Get("Accept-Ranges"); acceptRanges != "bytes" {
+				t.Errorf("Expected Accept-Ranges: bytes, but got %q", acceptRanges)
+			}
+		})
+	}
+}
+
+func TestServeFileMultipleRanges(t *testing.T) {
+	root := createRangeTestRoot(t, time.Now())
+
+	req := createTestRequest("GET", "/digits.txt")
+	req.Headers.Set("Range", "bytes=0-1, 5-6, -1")
+	res := serveTestRequest(t, HandlerFunc(func(req *Request, res *Response) {
+		ServeFile(req, res, root, "digits.txt")
+	}), req)
+
+	if res.statusCode != http.StatusPartialContent {
+		t.Fatalf("Expected status 206, but got %d", res.statusCode)
+	}
+	if contentLength, _ := res.Headers.Get("Content-Length"); contentLength != strconv.Itoa(len(res.content)) {
+		t.Errorf("Expected Content-Length %d, but got %s", len(res.content), contentLength)
+	}
+
+	contentType, _ := res.Headers.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected multipart/byteranges, but got %s", contentType)
+	}
+
+	expected := []struct {
+		contentRange string
+		body         string
+	}{
+		{contentRange: "bytes 0-1/10", body: "01"},
+		{contentRange: "bytes 5-6/10", body: "56"},
+		{contentRange: "bytes 9-9/10", body: "9"},
+	}
+	reader := multipart.NewReader(strings.NewReader(res.content), params["boundary"])
+	for i, part := range expected {
+		p, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("Failed to read part %d: %v", i, err)
+		}
+		if contentRange := p.Header.Get("Content-Range"); contentRange != part.contentRange {
+			t.Errorf("Expected Content-Range %q, but got %q", part.contentRange, contentRange)
+		}
+		if contentType := p.Header.Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+			t.Errorf("Expected the Content-Type of the file, but got %q", contentType)
+		}
+		body, _ := io.ReadAll(p)
+		if string(body) != part.body {
+			t.Errorf("Expected part %q, but got %q", part.body, body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("Expected no more parts, but got %v", err)
+	}
+}
@@ -4,81 +4,229 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"net"
 	"strconv"
 	"strings"
 )
 
 // Represents a HTTP Request
 type Request struct {
-	*HTTPMessage        // Embeds the HTTP message
-	Method       string // HTTP Method (e.g. GET, POST, PATCH, DELETE)
-	Path         string // Path of the requested resource
+	*HTTPMessage                   // Embeds the HTTP message
+	Method       string            // HTTP Method (e.g. GET, POST, PATCH, DELETE)
+	Path         string            // Path of the requested resource
+	Trailer      *Headers          // Trailer fields sent after a chunked body. Only filled in once the body was read
+	body         io.Reader         // Streams the body of the request from the connection
+	params       map[string]string // Path parameters captured by the Router
 }
 
-// Parse the incoming request
-func ParseRequest(conn net.Conn) *Request {
+// The default limit on the size of the request-line and header section of a request
+const DefaultMaxHeaderBytes = 1 << 20 // 1 MB
+
+// Parse the incoming request from the buffered reader of the connection.
+// The same reader must be reused for every request on a persistent connection,
+// as it may already hold bytes belonging to the next request.
+// The body is not read into memory, use BodyReader to stream it.
+//
+// Returns io.EOF if the connection was closed before a new request started,
+// or one of the Err* errors (e.g. ErrMalformedRequestLine) if the request is invalid.
+func ParseRequest(reader *bufio.Reader) (*Request, error) {
+	return parseRequest(reader, DefaultMaxHeaderBytes)
+}
+
+// Parse the incoming request, reading at most maxHeaderBytes for the request-line and header section.
+// Returns io.EOF if the connection was closed before a new request started.
+func parseRequest(reader *bufio.Reader, maxHeaderBytes int) (*Request, error) {
 	// Instantiate the Request
 	request := &Request{
 		HTTPMessage: createHTTPMessage(),
+		Trailer:     NewHeaders(),
+		body:        strings.NewReader(""),
 	}
 
-	// Create a buffered reader to read the connection
-	reader := bufio.NewReader(conn)
+	// The number of bytes that may still be read before the header section is too large
+	remaining := maxHeaderBytes
 
 	// Read and parse the request line
-	startLine, err := reader.ReadString('\n')
+	startLine, err := readLimitedLine(reader, &remaining)
+	if err == io.EOF && startLine == "" {
+		return nil, io.EOF // End of connection stream. Connection closed
+	}
 	if err == io.EOF {
-		return nil // End of connection stream. Connection closed
+		return nil, io.ErrUnexpectedEOF
 	}
 	if err != nil {
-		fmt.Println("Error reading request line: ", err.Error())
-		return nil
+		return nil, err
+	}
+	request.StartLine = strings.TrimRight(startLine, CRLF)
+	if err := request.parseRequestLine(); err != nil {
+		return nil, err
 	}
-	request.StartLine = strings.TrimSpace(startLine)
-	request.parseRequestLine()
 
 	// Read each header field into a hash table by field name until we hit an empty line
 	for {
-		line, err := reader.ReadString('\n')
-		line = strings.TrimSpace(line) // Trim extra-whitespace
-		if line == "\r\n" || line == "\n\r" || line == "" {
+		line, err := readLimitedLine(reader, &remaining)
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF // The connection was closed in the middle of the header section
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, CRLF) // Trim the line terminator
+		if line == "" {
 			break // Empty line is the delimiter between header and body
 		}
+		name, value, err := parseFieldLine(line) // Split the line into field-value pairs
 		if err != nil {
-			fmt.Println("Error reading header line: ", err.Error())
-			return nil
+			return nil, err
 		}
-		parts := strings.Split(line, ": ") // Split the line into field-value pairs
-		if len(parts) != 2 {
-			fmt.Println("Failed to parse header line: ", line)
-			return nil
+		request.Headers.Add(name, value) // Add the field-value pair to the headers
+	}
+
+	// Decode the body if it was sent using the chunked transfer coding.
+	// Transfer-Encoding overrides Content-Length. See https://datatracker.ietf.org/doc/html/rfc9112#section-6.3
+	if request.Headers.Contains("Transfer-Encoding") {
+		// Without chunked as the final coding, there is no way to tell where the body ends
+		if !isChunked(request.Headers) {
+			transferEncoding, _ := request.Headers.Get("Transfer-Encoding")
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedTransferEncoding, transferEncoding)
 		}
-		request.Headers.Set(parts[0], parts[1]) // Add the field-value pair to the headers
+		request.Headers.Delete("Content-Length")
+		// Trailers are kept apart from the header section, so they can't replace fields the request was handled with
+		// (e.g. Authorization or Content-Length). See https://datatracker.ietf.org/doc/html/rfc9110#section-6.5.1
+		request.body = newChunkedReader(reader, request.Trailer, maxHeaderBytes)
+		return request, nil
 	}
 
 	// Get the Content-Length header
 	contentLengthStr, ok := request.Headers.Get("Content-Length")
 	if !ok {
-		return request
+		return request, nil
 	}
-	contentLength, err := strconv.Atoi(contentLengthStr)
-	if err != nil {
-		return request
+	// Repeated Content-Length fields must all agree, or the body can't be framed reliably
+	for _, value := range request.Headers.Values("Content-Length") {
+		if value != contentLengthStr {
+			return nil, fmt.Errorf("%w: conflicting values %q", ErrInvalidContentLength, request.Headers.Values("Content-Length"))
+		}
+	}
+	contentLength, err := strconv.ParseInt(contentLengthStr, 10, 64)
+	if err != nil || contentLength < 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidContentLength, contentLengthStr)
 	}
 
-	// The body is the last part of the message and is of Content-Length
-	buf := make([]byte, contentLength)
-	reader.Read(buf)
-	request.Body = string(buf)
+	// The body follows the headers and is exactly Content-Length bytes long
+	request.body = &fixedLengthReader{reader: reader, remaining: contentLength}
 
-	return request
+	return request, nil
+}
+
+// Returns a reader that streams the body of the request from the connection.
+// The body can only be read once.
+func (r *Request) BodyReader() io.Reader {
+	return r.body
+}
+
+// fixedLengthReader reads a body of exactly the remaining number of bytes.
+// Unlike io.LimitReader, it fails with io.ErrUnexpectedEOF if the connection ends before, so a cut-off body is not taken for a whole one.
+type fixedLengthReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+// Read at most the remaining bytes of the body
+func (r *fixedLengthReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Read a line, failing with ErrHeaderTooLarge once more than the remaining number of bytes have been read.
+// Lines are read in slices of the buffer size, so an overly long line never has to be held in memory.
+func readLimitedLine(reader *bufio.Reader, remaining *int) (string, error) {
+	var line []byte
+	for {
+		slice, err := reader.ReadSlice('\n')
+		*remaining -= len(slice)
+		if *remaining < 0 {
+			return "", ErrHeaderTooLarge
+		}
+		line = append(line, slice...)
+		if err == bufio.ErrBufferFull {
+			continue // The line is longer than the buffer, keep reading
+		}
+		return string(line), err
+	}
 }
 
 // Parse the Method and Path from the request line. See https://datatracker.ietf.org/doc/html/rfc9112#section-3
-func (r *Request) parseRequestLine() {
-	s := strings.Fields(r.StartLine)
+func (r *Request) parseRequestLine() error {
+	// The request-line is exactly three parts separated by a single space
+	s := strings.Split(r.StartLine, " ")
+	if len(s) != 3 || !isToken(s[0]) || s[1] == "" {
+		return fmt.Errorf("%w: %q", ErrMalformedRequestLine, r.StartLine)
+	}
+
+	// The HTTP-version must be well-formed (e.g. `HTTP/1.1`), and we only speak HTTP/1.x
+	// See https://datatracker.ietf.org/doc/html/rfc9112#section-2.3
+	version := s[2]
+	if len(version) != len("HTTP/x.y") || !strings.HasPrefix(version, "HTTP/") ||
+		!isDigit(version[5]) || version[6] != '.' || !isDigit(version[7]) {
+		return fmt.Errorf("%w: %q", ErrMalformedRequestLine, r.StartLine)
+	}
+	if version[5] != '1' {
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+	}
+
 	r.Method = s[0]
 	r.Path = s[1]
-	r.protocol = s[2]
+	r.protocol = version
+	return nil
+}
+
+// Split a field line into its name and value. See https://datatracker.ietf.org/doc/html/rfc9112#section-5
+func parseFieldLine(line string) (string, string, error) {
+	name, value, found := strings.Cut(line, ":")
+
+	// The name must be a token, without any whitespace before the colon
+	if !found || !isToken(name) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	// Optional whitespace around the value is not part of it
+	value = strings.Trim(value, " \t")
+
+	// Values may not contain control characters (this also rules out obsolete line folding)
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return "", "", fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+		}
+	}
+
+	return name, value, nil
+}
+
+// Checks if the string is a token (e.g. a method or field name). See https://datatracker.ietf.org/doc/html/rfc9110#section-5.6.2
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isDigit(c) && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the byte is an ASCII digit
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
@@ -1,6 +1,12 @@
 package http
 
-import "testing"
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
 
 func TestParseRequestLine(t *testing.T) {
 	testCases := []struct {
@@ -34,7 +40,9 @@ func TestParseRequestLine(t *testing.T) {
 			HTTPMessage: createHTTPMessage().WithStartLine(tc.startLine),
 		}
 
-		req.parseRequestLine()
+		if err := req.parseRequestLine(); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
 
 		if req.Method != tc.method {
 			t.Errorf("Expected method %s, but got %s", tc.method, req.Method)
@@ -49,3 +57,199 @@ func TestParseRequestLine(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRequestBody(t *testing.T) {
+	// Two pipelined requests on the same connection
+	message := strings.Join([]string{
+		"POST /files/hello.txt HTTP/1.1",
+		"Content-Length: 5",
+		"",
+		"HelloGET / HTTP/1.1",
+		"",
+		"",
+	}, CRLF)
+	reader := bufio.NewReader(strings.NewReader(message))
+
+	req, err := ParseRequest(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// Check if the body is bounded by the Content-Length
+	body, err := io.ReadAll(req.BodyReader())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if string(body) != "Hello" {
+		t.Errorf("Expected body Hello, but got %s", string(body))
+	}
+
+	// Check if the next request can be read from the same reader
+	next, err := ParseRequest(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if next.Method != "GET" || next.Path != "/" {
+		t.Errorf("Expected GET /, but got %s %s", next.Method, next.Path)
+	}
+}
+
+func TestParseRequestBodyCutOff(t *testing.T) {
+	// The connection ends before the whole body was sent
+	reader := bufio.NewReader(strings.NewReader("POST /files/hello.txt HTTP/1.1\r\nContent-Length: 10\r\n\r\nHello"))
+
+	req, err := ParseRequest(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	body, err := io.ReadAll(req.BodyReader())
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, but got %v", err)
+	}
+	if string(body) != "Hello" {
+		t.Errorf("Expected the part of the body that arrived, but got %q", body)
+	}
+}
+
+func TestParseRequestChunkedBody(t *testing.T) {
+	message := strings.Join([]string{
+		"POST /files/hello.txt HTTP/1.1",
+		"Transfer-Encoding: chunked",
+		"Content-Length: 100",
+		"Authorization: Bearer good",
+		"",
+		"5",
+		"Hello",
+		"0",
+		"X-Checksum: abc123",
+		"Authorization: Bearer evil",
+		"Content-Length: 99",
+		"",
+		"",
+	}, CRLF)
+
+	req, err := ParseRequest(bufio.NewReader(strings.NewReader(message)))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// Transfer-Encoding takes precedence over Content-Length
+	if req.Headers.Contains("Content-Length") {
+		t.Errorf("Expected Content-Length to be removed")
+	}
+
+	body, err := io.ReadAll(req.BodyReader())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if string(body) != "Hello" {
+		t.Errorf("Expected body Hello, but got %s", string(body))
+	}
+
+	// Check if the trailer fields are available once the body was read
+	checksum, _ := req.Trailer.Get("X-Checksum")
+	if checksum != "abc123" {
+		t.Errorf("Expected trailer X-Checksum: abc123, but got %s", checksum)
+	}
+
+	// Trailers never replace the fields of the header section
+	if auth, _ := req.Headers.Get("Authorization"); auth != "Bearer good" {
+		t.Errorf("Expected Authorization: Bearer good, but got %s", auth)
+	}
+	if req.Headers.Contains("Content-Length") || req.Headers.Contains("X-Checksum") {
+		t.Errorf("Expected no trailer fields in the headers, but got %v", req.Headers.Enumerate())
+	}
+}
+
+func TestParseRequestMalformed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		message string
+		err     error
+	}{
+		{
+			name:    "Missing HTTP-version",
+			message: "GET /\r\n\r\n",
+			err:     ErrMalformedRequestLine,
+		},
+		{
+			name:    "Too many parts",
+			message: "GET / extra HTTP/1.1\r\n\r\n",
+			err:     ErrMalformedRequestLine,
+		},
+		{
+			name:    "Invalid method",
+			message: "G(T / HTTP/1.1\r\n\r\n",
+			err:     ErrMalformedRequestLine,
+		},
+		{
+			name:    "Invalid HTTP-version",
+			message: "GET / HTTP/one\r\n\r\n",
+			err:     ErrMalformedRequestLine,
+		},
+		{
+			name:    "Unsupported HTTP-version",
+			message: "GET / HTTP/2.0\r\n\r\n",
+			err:     ErrUnsupportedVersion,
+		},
+		{
+			name:    "Header without colon",
+			message: "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			err:     ErrInvalidHeader,
+		},
+		{
+			name:    "Whitespace before colon",
+			message: "GET / HTTP/1.1\r\nHost : localhost\r\n\r\n",
+			err:     ErrInvalidHeader,
+		},
+		{
+			name:    "Obsolete line folding",
+			message: "GET / HTTP/1.1\r\nX-Folded: a\r\n b\r\n\r\n",
+			err:     ErrInvalidHeader,
+		},
+		{
+			name:    "Invalid Content-Length",
+			message: "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+			err:     ErrInvalidContentLength,
+		},
+		{
+			name:    "Unsupported transfer coding",
+			message: "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			err:     ErrUnsupportedTransferEncoding,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRequest(bufio.NewReader(strings.NewReader(tc.message)))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error %v, but got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestParseRequestHeaderWhitespace(t *testing.T) {
+	message := "GET / HTTP/1.1\r\nHost:localhost\r\nUser-Agent: \t curl/8.0 \r\n\r\n"
+
+	req, err := ParseRequest(bufio.NewReader(strings.NewReader(message)))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	// Optional whitespace around field values is not part of the value
+	host, _ := req.Headers.Get("Host")
+	if host != "localhost" {
+		t.Errorf("Expected header Host: localhost, but got %q", host)
+	}
+	userAgent, _ := req.Headers.Get("User-Agent")
+	if userAgent != "curl/8.0" {
+		t.Errorf("Expected header User-Agent: curl/8.0, but got %q", userAgent)
+	}
+}
+
+func TestParseRequestEOF(t *testing.T) {
+	if _, err := ParseRequest(bufio.NewReader(strings.NewReader(""))); err != io.EOF {
+		t.Errorf("Expected io.EOF, but got %v", err)
+	}
+}
@@ -1,9 +1,15 @@
 package http
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // HTTP Response is made up of three parts, each separated by a [CRLF](https://developer.mozilla.org/en-US/docs/Glossary/CRLF) (`\r\n`):
@@ -11,20 +17,73 @@ import (
 // 2. One or more Headers: `Content-Type: text/html`
 // 3. (Optional) Body: `<!DOCTYPE html><html><body><h1>Hello, World!</h1></body></html>`
 
+// The value of the `Server` header sent with every response
+const ServerName = "codecrafters-http-server-go"
+
+// Returned by WriteTo when the handler set a Content-Length that disagrees with the actual body.
+// Nothing is written to the connection in that case.
+var ErrContentLengthMismatch = errors.New("Content-Length does not match the length of the body")
+
+// Returned by Hijack when the connection can't be taken over (e.g. HTTP/2, where it is shared by many requests)
+var ErrNotHijackable = errors.New("http: connection does not support hijacking")
+
+// Returned by Hijack when the connection was already taken over
+var ErrHijacked = errors.New("http: connection has already been hijacked")
+
+// Returns the current time. Replaced in tests to get a predictable `Date` header
+var now = time.Now
+
 // Represents an HTTP response
 type Response struct {
-	*HTTPMessage     // Embeds the HTTP message
-	statusCode   int // The status code for the response
+	*HTTPMessage              // Embeds the HTTP message
+	statusCode      int       // The status code for the response
+	bodyReader      io.Reader // Streams the body of the response. Takes precedence over the string Body
+	contentLength   int64     // Length of the streamed body, or -1 if unknown
+	encoder         Encoder   // Compresses the streamed body as it is written, if set
+	omitBody        bool      // Whether to leave out the body, keeping the headers that describe it (e.g. for HEAD)
+	closeDelimited  bool      // Whether the streamed body of unknown length ends by closing the connection, instead of being chunked
+	compressDecided bool      // Whether Compress already decided how to encode the body
+
+	hijack   func() (net.Conn, *bufio.ReadWriter) // Hands the connection over to the handler, if the server supports it
+	hijacked bool                                 // Whether the handler took over the connection, so the response is never written
 }
 
 // Create a new HTTP Response
 func CreateResponse() *Response {
 	return &Response{
-		HTTPMessage: createHTTPMessage(),
-		statusCode:  http.StatusInternalServerError,
+		HTTPMessage:   createHTTPMessage(),
+		statusCode:    http.StatusInternalServerError,
+		contentLength: -1,
 	}
 }
 
+// Discard the status, headers and body of the HTTP Response
+func (r *Response) reset() {
+	// The connection stays hijacked (or hijackable)
+	hijack, hijacked := r.hijack, r.hijacked
+	*r = *CreateResponse()
+	r.hijack, r.hijacked = hijack, hijacked
+}
+
+// Take over the connection of the request, to speak another protocol on it (e.g. WebSocket).
+// The server then no longer reads or writes on the connection and never writes the response:
+// the handler answers the request itself, using the buffered reader and writer.
+// The reader may already hold data the client sent after the request.
+//
+// The connection belongs to the handler until it returns, after which the server closes it.
+// Its deadlines are cleared. Returns ErrNotHijackable for HTTP/2 requests.
+func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.hijack == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if r.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	r.hijacked = true
+	conn, rw := r.hijack()
+	return conn, rw, nil
+}
+
 // Set the status code of the HTTP Response
 func (r *Response) WithStatus(code int) *Response {
 	r.statusCode = code
@@ -34,3 +93,184 @@ func (r *Response) WithStatus(code int) *Response {
 	r.WithStartLine(statusMsg)
 	return r
 }
+
+// Send the body of the HTTP Response using the chunked transfer coding.
+// Used when the length of the body is not known upfront.
+func (r *Response) WithChunkedEncoding() *Response {
+	r.Headers.Delete("Content-Length")
+	r.Headers.Set("Transfer-Encoding", "chunked")
+	return r
+}
+
+// Avoid the chunked transfer coding, for clients that don't know it (HTTP/1.0).
+// An in-memory body gets a Content-Length instead, while a streamed body ends by closing the connection.
+// Returns whether the connection must be closed after the response.
+// See https://datatracker.ietf.org/doc/html/rfc9112#section-6.3
+func (r *Response) withoutChunking() bool {
+	if !isChunked(r.Headers) {
+		return false
+	}
+	r.Headers.Delete("Transfer-Encoding")
+	r.closeDelimited = r.bodyReader != nil
+	return r.closeDelimited
+}
+
+// Set a streamed body for the HTTP Response.
+// The body is copied straight to the connection when the response is written, instead of being held in memory.
+// If the size is not known upfront, pass -1 and the body will be sent using the chunked transfer coding.
+// If the body implements io.Closer, it is closed once the response has been written.
+func (r *Response) WithBodyReader(body io.Reader, size int64) *Response {
+	r.bodyReader = body
+	r.contentLength = size
+	if size < 0 {
+		return r.WithChunkedEncoding()
+	}
+	r.Headers.Delete("Transfer-Encoding")
+	r.Headers.Set("Content-Length", strconv.FormatInt(size, 10))
+	return r
+}
+
+// Write the HTTP Response to w. A streamed body is copied directly from its reader,
+// so that memory use is independent of the size of the body.
+func (r *Response) WriteTo(w io.Writer) (int64, error) {
+	// Fill in the headers that are derived from the response itself
+	if err := r.prepare(); err != nil {
+		return 0, err
+	}
+
+	// A response to HEAD carries the headers of the body, but not the body itself
+	if r.omitBody {
+		if closer, ok := r.bodyReader.(io.Closer); ok {
+			closer.Close()
+		}
+		n, err := io.WriteString(w, r.head())
+		return int64(n), err
+	}
+
+	// Responses with an in-memory body are written in one go
+	if r.bodyReader == nil {
+		n, err := io.WriteString(w, r.String())
+		return int64(n), err
+	}
+
+	// Close the body once it has been written
+	if closer, ok := r.bodyReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Write the start-line and headers
+	written, err := io.WriteString(w, r.head())
+	if err != nil {
+		return int64(written), err
+	}
+	total := int64(written)
+
+	// Stream the body using the chunked transfer coding if its size is unknown,
+	// or as is if it ends by closing the connection
+	if isChunked(r.Headers) || r.closeDelimited {
+		counter := &countingWriter{writer: w}
+		var cw io.WriteCloser = newChunkedWriter(counter)
+		if r.closeDelimited {
+			cw = nopWriteCloser{counter}
+		}
+
+		// Compress the body on its way to the chunked writer, if requested
+		var dst io.WriteCloser = cw
+		if r.encoder != nil {
+			encoded, err := r.encoder(cw)
+			if err != nil {
+				return total, err
+			}
+			dst = encoded
+		}
+
+		if _, err := io.Copy(dst, r.bodyReader); err != nil {
+			return total + counter.n, err
+		}
+		if dst != cw {
+			if err := dst.Close(); err != nil {
+				return total + counter.n, err
+			}
+		}
+		err := cw.Close()
+		return total + counter.n, err
+	}
+
+	// Otherwise, copy exactly Content-Length bytes.
+	// io.Copy uses io.WriterTo or io.ReaderFrom when available, (e.g. sendfile for files over TCP)
+	n, err := io.Copy(w, io.LimitReader(r.bodyReader, r.contentLength))
+	total += n
+	if err == nil && n < r.contentLength {
+		err = io.ErrUnexpectedEOF // The body was shorter than the declared Content-Length
+	}
+	return total, err
+}
+
+// nopWriteCloser is a writer with a Close method that does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Does nothing, as the underlying writer needs no closing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// countingWriter counts the number of bytes written to the underlying writer
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+// Write p to the underlying writer and add the number of bytes written to the count
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Prepare the HTTP Response to be written to the connection.
+// Sets the `Content-Length` (unless the body is chunked), `Date` and `Server` headers,
+// and checks that a Content-Length set by the handler agrees with the body.
+func (r *Response) prepare() error {
+	// Make sure there is a status-line, even if the handler never set one
+	if r.StartLine == "" {
+		r.WithStatus(r.statusCode)
+	}
+
+	// 1xx, 204 No Content and 304 Not Modified responses never have a body
+	// See https://datatracker.ietf.org/doc/html/rfc9112#section-6.3
+	if r.statusCode < 200 || r.statusCode == http.StatusNoContent || r.statusCode == http.StatusNotModified {
+		if closer, ok := r.bodyReader.(io.Closer); ok {
+			closer.Close()
+		}
+		r.content = ""
+		r.bodyReader = nil
+		r.Headers.Delete("Transfer-Encoding")
+		if r.statusCode != http.StatusNotModified {
+			r.Headers.Delete("Content-Length")
+		}
+	} else if !isChunked(r.Headers) && !r.closeDelimited {
+		// The actual length of the body
+		length := int64(len(r.content))
+		if r.bodyReader != nil {
+			length = r.contentLength
+		}
+
+		// Reject a Content-Length that would desynchronize the connection
+		if declared, ok := r.Headers.Get("Content-Length"); ok && declared != strconv.FormatInt(length, 10) {
+			return fmt.Errorf("%w: declared %s, but the body is %d bytes long", ErrContentLengthMismatch, declared, length)
+		}
+		r.Headers.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+
+	// Every response carries the date it was generated at, and identifies the server
+	if !r.Headers.Contains("Date") {
+		r.Headers.Set("Date", now().UTC().Format(http.TimeFormat))
+	}
+	if !r.Headers.Contains("Server") {
+		r.Headers.Set("Server", ServerName)
+	}
+
+	return nil
+}
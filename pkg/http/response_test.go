@@ -1,6 +1,12 @@
 package http
 
-import "testing"
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestResponse_WithStatus(t *testing.T) {
 	testCases := []struct {
@@ -34,3 +40,166 @@ func TestResponse_WithStatus(t *testing.T) {
 		})
 	}
 }
+
+// Freeze the clock used for the `Date` header until the test finishes
+func freezeTime(t *testing.T) {
+	t.Helper()
+	now = func() time.Time { return time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+}
+
+// The `Date` and `Server` headers added to every response while the clock is frozen
+const frozenHeaders = "Date: Wed, 21 Oct 2015 07:28:00 GMT\r\nServer: " + ServerName + "\r\n"
+
+func TestResponse_WriteTo(t *testing.T) {
+	freezeTime(t)
+	var sb strings.Builder
+	response := CreateResponse().WithStatus(200)
+	response.WithBody("Hello, World!")
+
+	if _, err := response.WriteTo(&sb); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n" + frozenHeaders + "\r\nHello, World!"
+	if sb.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, sb.String())
+	}
+}
+
+func TestResponse_WriteToBodyReader(t *testing.T) {
+	freezeTime(t)
+	testCases := []struct {
+		name     string
+		size     int64
+		expected string
+	}{
+		{
+			name:     "Known size",
+			size:     13,
+			expected: "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n" + frozenHeaders + "\r\nHello, World!",
+		},
+		{
+			name:     "Unknown size",
+			size:     -1,
+			expected: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n" + frozenHeaders + "\r\nd\r\nHello, World!\r\n0\r\n\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			response := CreateResponse().WithStatus(200)
+			response.WithBodyReader(strings.NewReader("Hello, World!"), tc.size)
+
+			n, err := response.WriteTo(&sb)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if sb.String() != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, sb.String())
+			}
+			if n != int64(len(tc.expected)) {
+				t.Errorf("Expected %d bytes written, but got %d", len(tc.expected), n)
+			}
+		})
+	}
+}
+
+func TestResponse_WriteToShortBody(t *testing.T) {
+	var sb strings.Builder
+	response := CreateResponse().WithStatus(200)
+	response.WithBodyReader(strings.NewReader("Hello"), 10)
+
+	if _, err := response.WriteTo(&sb); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, but got %v", err)
+	}
+}
+
+func TestResponse_WriteToContentLength(t *testing.T) {
+	freezeTime(t)
+
+	testCases := []struct {
+		name     string
+		response *Response
+		expected string
+	}{
+		{
+			name:     "Empty body",
+			response: CreateResponse().WithStatus(404),
+			expected: "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n" + frozenHeaders + "\r\n",
+		},
+		{
+			name:     "Matching Content-Length set by the handler",
+			response: newTestResponse(201, map[string]string{"Content-Length": "7"}, "Created"),
+			expected: "HTTP/1.1 201 Created\r\nContent-Length: 7\r\n" + frozenHeaders + "\r\nCreated",
+		},
+		{
+			name:     "No Content",
+			response: newTestResponse(204, nil, "ignored"),
+			expected: "HTTP/1.1 204 No Content\r\n" + frozenHeaders + "\r\n",
+		},
+		{
+			name:     "Missing status",
+			response: CreateResponse(),
+			expected: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n" + frozenHeaders + "\r\n",
+		},
+		{
+			name:     "Date and Server set by the handler",
+			response: newTestResponse(200, map[string]string{"Date": "Thu, 01 Jan 2026 00:00:00 GMT", "Server": "custom"}, ""),
+			expected: "HTTP/1.1 200 OK\r\nDate: Thu, 01 Jan 2026 00:00:00 GMT\r\nServer: custom\r\nContent-Length: 0\r\n\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			if _, err := tc.response.WriteTo(&sb); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if sb.String() != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, sb.String())
+			}
+		})
+	}
+}
+
+func TestResponse_WriteToContentLengthMismatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		response *Response
+	}{
+		{
+			name:     "In-memory body",
+			response: newTestResponse(200, map[string]string{"Content-Length": "100"}, "Hello"),
+		},
+		{
+			name: "Streamed body",
+			response: func() *Response {
+				r := CreateResponse().WithStatus(200)
+				r.WithBodyReader(strings.NewReader("Hello"), 5)
+				r.Headers.Set("Content-Length", "3")
+				return r
+			}(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sb strings.Builder
+			_, err := tc.response.WriteTo(&sb)
+			if !errors.Is(err, ErrContentLengthMismatch) {
+				t.Errorf("Expected error %v, but got %v", ErrContentLengthMismatch, err)
+			}
+			if sb.Len() != 0 {
+				t.Errorf("Expected nothing to be written, but got %q", sb.String())
+			}
+		})
+	}
+}
+
+// Create a response with the given status, headers and body, for use in table tests
+func newTestResponse(status int, headers map[string]string, body string) *Response {
+	r := CreateResponse().WithStatus(status)
+	r.WithHeaders(headers).WithBody(body)
+	return r
+}
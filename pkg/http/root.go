@@ -0,0 +1,272 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Errors returned by Root when a name cannot be safely resolved inside the root directory
+var (
+	ErrInvalidPath     = errors.New("invalid path")           // The name contains a NUL byte, or is reserved for the temporary files of CreateAtomic
+	ErrPathEscapesRoot = errors.New("path escapes from root") // The name refers to a file outside of the root, using `..` or a symlink
+)
+
+// Root gives access to the files inside a directory, and not to anything outside of it.
+// Names are slash-separated paths relative to the root (e.g. `docs/readme.txt`), and are rejected if they
+// contain `..` segments or NUL bytes, or lead outside of the directory through a symlink.
+// The temporary files of CreateAtomic can't be reached through a Root either, so they are never served.
+// Symlinks that stay inside the directory are followed as usual.
+//
+// Symlinks are resolved before the file is used, and files are opened by their resolved path without following
+// a symlink in its last element (on Unix). A symlink that replaces one of the parent directories in between
+// (e.g. by another process writing to the directory) is still followed, so the directory must not be writable
+// by anyone who shouldn't be able to read outside of it.
+type Root struct {
+	dir string // The absolute path of the directory, with any symlinks resolved
+}
+
+// Open the directory as a Root. The directory must exist.
+func OpenRoot(dir string) (*Root, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "openroot", Path: dir, Err: errors.New("not a directory")}
+	}
+	return &Root{dir: resolved}, nil
+}
+
+// The absolute path of the root directory
+func (r *Root) Name() string {
+	return r.dir
+}
+
+// Open the named file in the root for reading
+func (r *Root) Open(name string) (*os.File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create or truncate the named file in the root for writing
+func (r *Root) Create(name string) (*os.File, error) {
+	return r.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open the named file in the root with the given flags (e.g. os.O_APPEND) and permissions, like os.OpenFile
+func (r *Root) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	_, resolved, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	// The file was checked under its resolved path, so a symlink put in its place since then is not followed
+	return os.OpenFile(resolved, flag|oNoFollow, perm)
+}
+
+// Create the named directory in the root, along with any missing parents, like os.MkdirAll
+func (r *Root) MkdirAll(name string, perm fs.FileMode) error {
+	_, resolved, err := r.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(resolved, perm)
+}
+
+// Remove the named file or empty directory from the root. The root itself can't be removed.
+func (r *Root) Remove(name string) error {
+	path, _, err := r.resolve(name)
+	if err != nil {
+		return err
+	}
+	if path == r.dir {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Remove(path)
+}
+
+// Create a temporary file next to the named file in the root, that atomically replaces it once committed.
+// Readers see either the previous file or the complete new one, never a partially written file.
+func (r *Root) CreateAtomic(name string) (*AtomicFile, error) {
+	path, _, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if path == r.dir {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrPermission}
+	}
+
+	// The temporary file must be on the same filesystem for the rename to be atomic, so use the same directory.
+	// Its name is reserved (see isTempName), so it can't be opened, listed or overwritten through the Root
+	file, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*"+tempSuffix)
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp only gives the owner access, but the file should be readable like any other
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// Returns the FileInfo of the named file in the root, following symlinks
+func (r *Root) Stat(name string) (fs.FileInfo, error) {
+	_, resolved, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(resolved) // Symlinks are already resolved, so a new one is not followed
+}
+
+// Resolve the name to the path of the file on disk, checking that it stays inside the root.
+// Returns the path as named, whose last element may be a symlink (e.g. to remove the symlink itself),
+// and the path with all symlinks resolved, to use the file it refers to.
+func (r *Root) resolve(name string) (string, string, error) {
+	// NUL bytes would silently truncate the path at the system call
+	if strings.ContainsRune(name, 0) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidPath, name)
+	}
+
+	// Reject `..` outright instead of cleaning it away, as a legitimate client never sends it
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", "", fmt.Errorf("%w: %q", ErrPathEscapesRoot, name)
+		}
+		// A file that is still being written must not be read or replaced
+		if isTempName(segment) {
+			return "", "", fmt.Errorf("%w: %q is reserved for temporary files", ErrInvalidPath, name)
+		}
+	}
+
+	path := filepath.Join(r.dir, filepath.FromSlash(name))
+
+	// A symlink inside the root may still point outside of it
+	resolved, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !isWithin(r.dir, resolved) {
+		return "", "", fmt.Errorf("%w: %q", ErrPathEscapesRoot, name)
+	}
+
+	return path, resolved, nil
+}
+
+// The temporary files of CreateAtomic are named `.~upload-<random>.partial`, where the random part is decimal digits.
+// The pattern is unusual enough that no user file is expected to match it
+const (
+	tempPrefix = ".~upload-"
+	tempSuffix = ".partial"
+)
+
+// Checks if the file name is that of a temporary file created by CreateAtomic
+func isTempName(name string) bool {
+	random, ok := strings.CutPrefix(name, tempPrefix)
+	if !ok {
+		return false
+	}
+	random, ok = strings.CutSuffix(random, tempSuffix)
+	if !ok || random == "" {
+		return false
+	}
+	for i := 0; i < len(random); i++ {
+		if !isDigit(random[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve the symlinks of a path that may not exist yet (e.g. a file about to be created),
+// by resolving its longest existing prefix and appending the rest as is
+func evalExistingSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	// A file in place of a parent directory means the path doesn't exist either
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+		return "", err
+	}
+
+	// Something exists at the path but cannot be resolved, which means a dangling symlink.
+	// Creating a file through it could land anywhere, so refuse it.
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("%w: dangling symlink %q", ErrPathEscapesRoot, path)
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil // Reached the filesystem root
+	}
+	resolvedParent, err := evalExistingSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// Checks if the path is the directory itself or inside of it. Both must be clean absolute paths
+func isWithin(dir, path string) bool {
+	if path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// AtomicFile is a temporary file that replaces a file of a Root when committed,
+// or disappears without a trace when aborted
+type AtomicFile struct {
+	*os.File        // The temporary file being written
+	path     string // The path of the file to replace
+	done     bool   // Whether the file has been committed or aborted
+}
+
+// Flush the temporary file to disk and rename it over the file it replaces
+func (f *AtomicFile) Commit() error {
+	if f.done {
+		return fs.ErrClosed
+	}
+	f.done = true
+
+	// Make sure the content is on disk before it becomes visible, so a crash can't leave an empty file behind
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Discard the temporary file, leaving the file it would have replaced untouched.
+// Does nothing if the file was already committed, so it can be deferred right after CreateAtomic.
+func (f *AtomicFile) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package http
+
+// Symlinks in the last element of a path can't be refused when opening it, so Root relies on resolving them first
+const oNoFollow = 0
@@ -0,0 +1,341 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Create a Root in a temporary directory with a file, a sub-directory, and symlinks pointing inside and outside of it
+func createTestRoot(t *testing.T) *Root {
+	t.Helper()
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("Hello, World!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlinks := map[string]string{
+		"inside":   filepath.Join(dir, "hello.txt"),
+		"outside":  filepath.Join(outside, "secret.txt"),
+		"escape":   outside,
+		"dangling": filepath.Join(outside, "missing.txt"),
+	}
+	for name, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("Symlinks are not supported: %v", err)
+		}
+	}
+
+	root, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatalf("Failed to open the root: %v", err)
+	}
+	return root
+}
+
+func TestRootOpen(t *testing.T) {
+	root := createTestRoot(t)
+
+	testCases := []struct {
+		name     string
+		expected string
+		err      error
+	}{
+		{name: "hello.txt", expected: "Hello, World!"},
+		{name: "/hello.txt", expected: "Hello, World!"},
+		{name: "docs/../hello.txt", err: ErrPathEscapesRoot},
+		{name: "./hello.txt", expected: "Hello, World!"},
+		{name: "inside", expected: "Hello, World!"},
+		{name: "missing.txt", err: fs.ErrNotExist},
+		{name: "../secret.txt", err: ErrPathEscapesRoot},
+		{name: "docs/../../secret.txt", err: ErrPathEscapesRoot},
+		{name: "..", err: ErrPathEscapesRoot},
+		{name: "outside", err: ErrPathEscapesRoot},
+		{name: "escape/secret.txt", err: ErrPathEscapesRoot},
+		{name: "dangling", err: ErrPathEscapesRoot},
+		{name: "hello.txt\x00.png", err: ErrInvalidPath},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := root.Open(tc.name)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, but got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			defer file.Close()
+
+			content, _ := io.ReadAll(file)
+			if string(content) != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, content)
+			}
+		})
+	}
+}
+
+func TestRootCreate(t *testing.T) {
+	root := createTestRoot(t)
+
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{name: "new.txt"},
+		{name: "docs/new.txt"},
+		{name: "../new.txt", err: ErrPathEscapesRoot},
+		{name: "escape/new.txt", err: ErrPathEscapesRoot},
+		{name: "dangling", err: ErrPathEscapesRoot},
+		{name: "outside", err: ErrPathEscapesRoot},
+		{name: "new\x00.txt", err: ErrInvalidPath},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := root.Create(tc.name)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Expected error %v, but got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			file.Close()
+
+			if _, err := os.Stat(filepath.Join(root.Name(), filepath.FromSlash(tc.name))); err != nil {
+				t.Errorf("Expected the file to be created inside the root, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenRootNotADirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(file, nil, 0644)
+
+	if _, err := OpenRoot(file); err == nil {
+		t.Errorf("Expected an error opening a file as a root")
+	}
+	if _, err := OpenRoot(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist, but got %v", err)
+	}
+}
+
+func TestRootOpenFileAppend(t *testing.T) {
+	root := createTestRoot(t)
+
+	file, err := root.OpenFile("hello.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	io.WriteString(file, " Again!")
+	file.Close()
+
+	content, _ := os.ReadFile(filepath.Join(root.Name(), "hello.txt"))
+	if string(content) != "Hello, World! Again!" {
+		t.Errorf("Expected the content to be appended, but got %q", content)
+	}
+
+	if _, err := root.OpenFile("../hello.txt", os.O_WRONLY|os.O_APPEND, 0); !errors.Is(err, ErrPathEscapesRoot) {
+		t.Errorf("Expected ErrPathEscapesRoot, but got %v", err)
+	}
+}
+
+func TestRootRemove(t *testing.T) {
+	root := createTestRoot(t)
+
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{name: "hello.txt"},
+		{name: "docs"},
+		{name: "hello.txt", err: fs.ErrNotExist},
+		{name: "../secret.txt", err: ErrPathEscapesRoot},
+		{name: "outside", err: ErrPathEscapesRoot},
+		{name: ".", err: fs.ErrPermission},
+		{name: "/", err: fs.ErrPermission},
+	}
+
+	for _, tc := range testCases {
+		err := root.Remove(tc.name)
+		if tc.err == nil && err != nil {
+			t.Errorf("Expected no error removing %s, but got %v", tc.name, err)
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("Expected error %v removing %s, but got %v", tc.err, tc.name, err)
+		}
+	}
+
+	if _, err := os.Stat(root.Name()); err != nil {
+		t.Errorf("Expected the root to still exist, but got %v", err)
+	}
+}
+
+func TestRootRemoveSymlink(t *testing.T) {
+	root := createTestRoot(t)
+
+	// The symlink itself is removed, not the file it points to
+	if err := root.Remove("inside"); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root.Name(), "inside")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the symlink to be removed, but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root.Name(), "hello.txt")); err != nil {
+		t.Errorf("Expected the target of the symlink to remain, but got %v", err)
+	}
+}
+
+func TestRootSymlinkSwapped(t *testing.T) {
+	if oNoFollow == 0 {
+		t.Skip("Symlinks can't be refused when opening a file on this system")
+	}
+	root := createTestRoot(t)
+
+	// The file is checked, then replaced by a symlink leading outside before it is opened
+	_, resolved, err := root.resolve("hello.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	outside, err := os.Readlink(filepath.Join(root.Name(), "outside"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(resolved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if file, err := os.OpenFile(resolved, os.O_RDONLY|oNoFollow, 0); err == nil {
+		file.Close()
+		t.Errorf("Expected the symlink put in place of the checked file not to be followed")
+	}
+}
+
+func TestRootCreateAtomic(t *testing.T) {
+	root := createTestRoot(t)
+	path := filepath.Join(root.Name(), "hello.txt")
+
+	// Nothing changes until the file is committed
+	file, err := root.CreateAtomic("hello.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	io.WriteString(file, "Replaced")
+	if content, _ := os.ReadFile(path); string(content) != "Hello, World!" {
+		t.Errorf("Expected the file to be untouched before the commit, but got %q", content)
+	}
+
+	// The temporary file can't be reached through the root while it is written
+	tempName := filepath.Base(file.Name())
+	if _, err := root.Open(tempName); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Expected the temporary file %s to be unreachable, but got %v", tempName, err)
+	}
+	if _, err := root.Stat("docs/" + tempName); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Expected temporary file names to be reserved in every directory, but got %v", err)
+	}
+
+	if err := file.Commit(); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "Replaced" {
+		t.Errorf("Expected the file to be replaced, but got %q", content)
+	}
+	if err := file.Abort(); err != nil {
+		t.Errorf("Expected Abort after Commit to do nothing, but got %v", err)
+	}
+	if err := file.Commit(); err == nil {
+		t.Errorf("Expected a second Commit to fail")
+	}
+
+	// An aborted file leaves no trace
+	file, err = root.CreateAtomic("new.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	io.WriteString(file, "Discarded")
+	file.Abort()
+	if _, err := os.Stat(filepath.Join(root.Name(), "new.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the file not to exist, but got %v", err)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(root.Name())
+	for _, entry := range entries {
+		if isTempName(entry.Name()) {
+			t.Errorf("Expected no temporary files, but found %s", entry.Name())
+		}
+	}
+
+	// The same rules apply as for any other name
+	if _, err := root.CreateAtomic("../new.txt"); !errors.Is(err, ErrPathEscapesRoot) {
+		t.Errorf("Expected ErrPathEscapesRoot, but got %v", err)
+	}
+	if _, err := root.CreateAtomic("."); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected ErrPermission, but got %v", err)
+	}
+}
+
+func TestRootMkdirAll(t *testing.T) {
+	root := createTestRoot(t)
+
+	if err := root.MkdirAll("project/build", 0755); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if info, err := root.Stat("project/build"); err != nil || !info.IsDir() {
+		t.Errorf("Expected the directories to be created, but got %v", err)
+	}
+
+	if err := root.MkdirAll("escape/project", 0755); !errors.Is(err, ErrPathEscapesRoot) {
+		t.Errorf("Expected ErrPathEscapesRoot, but got %v", err)
+	}
+	if err := root.MkdirAll("hello.txt/project", 0755); err == nil {
+		t.Errorf("Expected an error creating a directory under a file")
+	}
+
+	// A file in place of a parent directory is just a path that doesn't exist
+	if _, err := root.Stat("hello.txt/missing.txt"); err == nil || errors.Is(err, ErrPathEscapesRoot) {
+		t.Errorf("Expected the file not to exist, but got %v", err)
+	}
+}
+
+func TestIsTempName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected bool
+	}{
+		{name: ".~upload-123456.partial", expected: true},
+		{name: ".~upload-.partial", expected: false},
+		{name: ".~upload-12a.partial", expected: false},
+		{name: ".~upload-123.partial.txt", expected: false},
+		{name: ".session.tmp", expected: false},
+		{name: ".b.txt.123.tmp", expected: false},
+		{name: "report.partial", expected: false},
+	}
+
+	for _, tc := range testCases {
+		if actual := isTempName(tc.name); actual != tc.expected {
+			t.Errorf("Expected isTempName(%q) to be %v, but got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build unix
+
+package http
+
+import "syscall"
+
+// Opens a file without following a symlink in the last element of its path
+const oNoFollow = syscall.O_NOFOLLOW
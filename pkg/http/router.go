@@ -0,0 +1,222 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Router dispatches requests to the handler of the first route whose pattern matches.
+//
+// A pattern is made up of an optional method and a path (e.g. `GET /files/{name}`).
+// Each segment of the path is either:
+//   - a literal that must match exactly (e.g. `files`)
+//   - a parameter that captures a single non-empty segment (e.g. `{name}`)
+//   - a wildcard that captures the rest of the path and must come last (e.g. `{str...}`)
+//
+// Patterns without a method match every method, and `GET` patterns also match `HEAD` requests.
+// Segments of the request path are percent-decoded before matching (e.g. `%20` -> ` `), so captured
+// parameters, available to the handler using Request.Param, hold the decoded values.
+type Router struct {
+	routes      []*route     // The registered routes in the order they were registered
+	middlewares []Middleware // The middlewares that wrap every request dispatched by the router
+}
+
+// Instantiate a new Router without any routes
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Register the handler for the given pattern.
+// Panics if the pattern is invalid, as that is a programming error.
+func (r *Router) Handle(pattern string, handler Handler) {
+	route, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: invalid pattern %q: %v", pattern, err))
+	}
+	route.handler = handler
+	r.routes = append(r.routes, route)
+}
+
+// Register the handler function for the given pattern
+func (r *Router) HandleFunc(pattern string, handler func(req *Request, res *Response)) {
+	r.Handle(pattern, HandlerFunc(handler))
+}
+
+// Wrap every request dispatched by the router with the given middlewares,
+// including those that end up as 404 or 405 responses
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Dispatch the request to the handler of the matching route, through the middlewares
+func (r *Router) ServeHTTP(req *Request, res *Response) {
+	Chain(HandlerFunc(r.dispatch), r.middlewares...).ServeHTTP(req, res)
+}
+
+// Dispatch the request to the handler of the matching route.
+// Responds with 405 Method Not Allowed if the path matches but the method doesn't,
+// with 404 Not Found if no route matches the path at all,
+// and with 400 Bad Request if the path contains an invalid percent-encoding.
+func (r *Router) dispatch(req *Request, res *Response) {
+	segments, err := unescapeSegments(splitPath(req.Path))
+	if err != nil {
+		res.WithStatus(http.StatusBadRequest)
+		return
+	}
+
+	allowed := []string{} // Methods of the routes that match the path
+	for _, route := range r.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if !route.allows(req.Method) {
+			allowed = append(allowed, route.methods()...)
+			continue
+		}
+		req.params = params
+		route.handler.ServeHTTP(req, res)
+		return
+	}
+
+	// The path exists, but not for this method
+	if len(allowed) > 0 {
+		slices.Sort(allowed)
+		allowed = slices.Compact(allowed)
+		res.WithStatus(http.StatusMethodNotAllowed).WithHeaders(map[string]string{
+			"Allow": strings.Join(allowed, ", "),
+		})
+		return
+	}
+
+	res.WithStatus(http.StatusNotFound)
+}
+
+// Returns the value of the path parameter captured by the matching route,
+// or an empty string if there is no such parameter
+func (r *Request) Param(name string) string {
+	return r.params[name]
+}
+
+// -----
+// ROUTE
+// -----
+
+// A route registered on the Router
+type route struct {
+	method   string    // The method to match, or an empty string to match every method
+	segments []segment // The segments of the path pattern
+	handler  Handler   // The handler to call when the route matches
+}
+
+// A single segment of a path pattern
+type segment struct {
+	literal  string // The literal to match, if this is not a parameter
+	param    string // The name of the parameter, if this is a parameter
+	wildcard bool   // Whether the parameter captures the rest of the path
+}
+
+// Parse a pattern like `GET /files/{name}` into a route
+func parsePattern(pattern string) (*route, error) {
+	route := &route{}
+
+	// Split the optional method from the path
+	path := pattern
+	if method, rest, found := strings.Cut(pattern, " "); found {
+		route.method = method
+		path = strings.TrimSpace(rest)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with a '/'")
+	}
+
+	names := map[string]bool{} // The parameter names seen so far, to catch duplicates
+	parts := splitPath(path)
+	for i, part := range parts {
+		// Literal segment
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("segment %q is neither a literal nor a parameter", part)
+			}
+			route.segments = append(route.segments, segment{literal: part})
+			continue
+		}
+
+		// Parameter segment
+		name := part[1 : len(part)-1]
+		name, wildcard := strings.CutSuffix(name, "...")
+		if name == "" {
+			return nil, fmt.Errorf("parameter in segment %q has no name", part)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate parameter %q", name)
+		}
+		if wildcard && i != len(parts)-1 {
+			return nil, fmt.Errorf("wildcard %q must be the last segment", name)
+		}
+		names[name] = true
+		route.segments = append(route.segments, segment{param: name, wildcard: wildcard})
+	}
+
+	return route, nil
+}
+
+// Match the segments of a request path against the route,
+// returning the captured parameters if it matches
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, seg := range rt.segments {
+		if i >= len(segments) {
+			return nil, false // The path is shorter than the pattern
+		}
+		switch {
+		case seg.wildcard:
+			params[seg.param] = strings.Join(segments[i:], "/")
+			return params, true
+		case seg.param != "":
+			if segments[i] == "" {
+				return nil, false // Parameters never capture an empty segment
+			}
+			params[seg.param] = segments[i]
+		case seg.literal != segments[i]:
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(rt.segments)
+}
+
+// Check if the route accepts requests with the given method
+func (rt *route) allows(method string) bool {
+	return rt.method == "" || rt.method == method || (rt.method == "GET" && method == "HEAD")
+}
+
+// The methods accepted by the route, as advertised in the `Allow` header
+func (rt *route) methods() []string {
+	if rt.method == "GET" {
+		return []string{"GET", "HEAD"}
+	}
+	return []string{rt.method}
+}
+
+// Split a path into its segments, ignoring the query string (e.g. `/files/a.txt?x=1` -> [files, a.txt])
+func splitPath(path string) []string {
+	path, _, _ = strings.Cut(path, "?")
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// Percent-decode each segment of a path. Decoding after splitting keeps an encoded slash (`%2F`)
+// from creating a new segment
+func unescapeSegments(segments []string) ([]string, error) {
+	decoded := make([]string, len(segments))
+	for i, segment := range segments {
+		s, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = s
+	}
+	return decoded, nil
+}
@@ -0,0 +1,202 @@
+package http
+
+import "testing"
+
+// Create a request for the given method and path
+func createTestRequest(method, path string) *Request {
+	return &Request{
+		HTTPMessage: createHTTPMessage(),
+		Method:      method,
+		Path:        path,
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+
+	// Record which handler was called and with which parameters
+	var called string
+	var params map[string]string
+	handler := func(name string) func(req *Request, res *Response) {
+		return func(req *Request, res *Response) {
+			called = name
+			params = req.params
+			res.WithStatus(200)
+		}
+	}
+
+	router.HandleFunc("GET /", handler("index"))
+	router.HandleFunc("GET /files/{name}", handler("getFile"))
+	router.HandleFunc("POST /files/{name}", handler("postFile"))
+	router.HandleFunc("GET /echo/{str...}", handler("echo"))
+	router.HandleFunc("/users/{id}/posts/{post}", handler("post"))
+
+	testCases := []struct {
+		name    string
+		method  string
+		path    string
+		handler string
+		params  map[string]string
+	}{
+		{
+			name:    "Root",
+			method:  "GET",
+			path:    "/",
+			handler: "index",
+			params:  map[string]string{},
+		},
+		{
+			name:    "Parameter",
+			method:  "GET",
+			path:    "/files/hello.txt",
+			handler: "getFile",
+			params:  map[string]string{"name": "hello.txt"},
+		},
+		{
+			name:    "Method",
+			method:  "POST",
+			path:    "/files/hello.txt",
+			handler: "postFile",
+			params:  map[string]string{"name": "hello.txt"},
+		},
+		{
+			name:    "HEAD matches GET",
+			method:  "HEAD",
+			path:    "/files/hello.txt",
+			handler: "getFile",
+			params:  map[string]string{"name": "hello.txt"},
+		},
+		{
+			name:    "Wildcard",
+			method:  "GET",
+			path:    "/echo/hello/world",
+			handler: "echo",
+			params:  map[string]string{"str": "hello/world"},
+		},
+		{
+			name:    "Empty wildcard",
+			method:  "GET",
+			path:    "/echo/",
+			handler: "echo",
+			params:  map[string]string{"str": ""},
+		},
+		{
+			name:    "Query string is ignored",
+			method:  "GET",
+			path:    "/files/hello.txt?download=true",
+			handler: "getFile",
+			params:  map[string]string{"name": "hello.txt"},
+		},
+		{
+			name:    "Percent-encoded parameter",
+			method:  "GET",
+			path:    "/files/hello%20world.txt",
+			handler: "getFile",
+			params:  map[string]string{"name": "hello world.txt"},
+		},
+		{
+			name:    "Encoded slash stays in the segment",
+			method:  "GET",
+			path:    "/files/..%2F..%2Fetc%2Fpasswd",
+			handler: "getFile",
+			params:  map[string]string{"name": "../../etc/passwd"},
+		},
+		{
+			name:    "Any method",
+			method:  "DELETE",
+			path:    "/users/1/posts/2",
+			handler: "post",
+			params:  map[string]string{"id": "1", "post": "2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			called, params = "", nil
+			router.ServeHTTP(createTestRequest(tc.method, tc.path), CreateResponse())
+
+			if called != tc.handler {
+				t.Fatalf("Expected handler %q to be called, but got %q", tc.handler, called)
+			}
+			if len(params) != len(tc.params) {
+				t.Errorf("Expected params %v, but got %v", tc.params, params)
+			}
+			for key, value := range tc.params {
+				if params[key] != value {
+					t.Errorf("Expected param %s to be %q, but got %q", key, value, params[key])
+				}
+			}
+		})
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /files/{name}", func(req *Request, res *Response) {})
+
+	testCases := []string{
+		"/",
+		"/files",
+		"/files/",
+		"/files/a/b",
+		"/unknown",
+	}
+
+	for _, path := range testCases {
+		res := CreateResponse()
+		router.ServeHTTP(createTestRequest("GET", path), res)
+		if res.statusCode != 404 {
+			t.Errorf("Expected status 404 for %s, but got %d", path, res.statusCode)
+		}
+	}
+}
+
+func TestRouterInvalidPercentEncoding(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /files/{name}", func(req *Request, res *Response) {})
+
+	res := CreateResponse()
+	router.ServeHTTP(createTestRequest("GET", "/files/%zz"), res)
+	if res.statusCode != 400 {
+		t.Errorf("Expected status 400, but got %d", res.statusCode)
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /files/{name}", func(req *Request, res *Response) {})
+	router.HandleFunc("POST /files/{name}", func(req *Request, res *Response) {})
+
+	res := CreateResponse()
+	router.ServeHTTP(createTestRequest("DELETE", "/files/hello.txt"), res)
+
+	if res.statusCode != 405 {
+		t.Errorf("Expected status 405, but got %d", res.statusCode)
+	}
+	allow, _ := res.Headers.Get("Allow")
+	if allow != "GET, HEAD, POST" {
+		t.Errorf("Expected Allow: GET, HEAD, POST, but got %s", allow)
+	}
+}
+
+func TestRouterInvalidPattern(t *testing.T) {
+	testCases := []string{
+		"files",
+		"GET files/{name}",
+		"/files/{}",
+		"/files/{name}/{name}",
+		"/files/{path...}/edit",
+		"/files/{name",
+	}
+
+	for _, pattern := range testCases {
+		t.Run(pattern, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected pattern %q to panic", pattern)
+				}
+			}()
+			NewRouter().HandleFunc(pattern, func(req *Request, res *Response) {})
+		})
+	}
+}
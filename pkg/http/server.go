@@ -0,0 +1,492 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Server accepts connections and serves HTTP/1.1 and HTTP/2 requests on them using the Handler.
+// The zero value of each field uses its default.
+type Server struct {
+	Addr    string  // TCP address to listen on (e.g. `0.0.0.0:4221`). Defaults to `:4221`
+	Handler Handler // The handler to invoke for every request. Defaults to responding with 404 Not Found
+
+	ReadHeaderTimeout time.Duration // Maximum duration for reading the request-line and header section. Defaults to the ReadTimeout
+	ReadTimeout       time.Duration // Maximum duration for reading an entire request, including the body. Zero means no timeout
+	WriteTimeout      time.Duration // Maximum duration for writing a response. Zero means no timeout
+	IdleTimeout       time.Duration // Maximum duration to wait for the next request on a persistent connection. Defaults to the ReadTimeout
+
+	MaxHeaderBytes int // Maximum size of the request-line and header section. Defaults to DefaultMaxHeaderBytes
+
+	TLSConfig    *tls.Config // Configuration of ServeTLS and ListenAndServeTLS (e.g. the certificates to pick from by SNI)
+	DisableHTTP2 bool        // Only speak HTTP/1.1, instead of HTTP/2 when the client asks for it (over TLS or h2c)
+
+	mu         sync.Mutex                // Guards the listeners, connections and shutdown functions
+	listeners  map[net.Listener]struct{} // The listeners the server is accepting connections on
+	conns      map[net.Conn]connState    // The open connections and whether they are serving a request. Hijacked ones are left out
+	http2Conns map[net.Conn]*http2Conn   // The connections speaking HTTP/2, which are told to go away on Shutdown
+	onShutdown []func()                  // The functions to call on Shutdown, registered with RegisterOnShutdown
+	inShutdown atomic.Bool               // Set once Shutdown or Close has been called
+}
+
+// Returned by Serve and ListenAndServe after a call to Shutdown or Close
+var ErrServerClosed = errors.New("http: Server closed")
+
+// The state of a connection, used to decide whether it can be closed during a shutdown
+type connState int
+
+const (
+	stateIdle   connState = iota // Waiting for the next request
+	stateActive                  // Reading a request, running the handler or writing the response
+)
+
+// Listen on the TCP address of the server and serve requests on incoming connections.
+// Blocks until the listener fails.
+func (s *Server) ListenAndServe() error {
+	if s.inShutdown.Load() {
+		return ErrServerClosed
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":4221"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Accept connections on the listener and serve requests on each of them in a new goroutine.
+// Blocks until the listener fails, and always closes the listener before returning.
+// After Shutdown or Close, the returned error is ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	if !s.trackListener(l) {
+		return ErrServerClosed
+	}
+	defer s.untrackListener(l)
+
+	for {
+		conn, err := l.Accept()
+		if s.inShutdown.Load() {
+			if conn != nil {
+				conn.Close()
+			}
+			return ErrServerClosed
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return err // The listener was closed
+		}
+		if err != nil {
+			fmt.Println("Error accepting connection: ", err.Error())
+			continue
+		}
+
+		// Handle the connection in a new goroutine
+		// The loop then returns to accepting, so that
+		// multiple connections may be served concurrently
+		s.setConnState(conn, stateIdle)
+		go s.serveConn(conn)
+	}
+}
+
+// Gracefully shut down the server without interrupting any in-flight requests.
+// Stops accepting new connections, closes idle connections, and waits for
+// active connections to finish their current request before closing them.
+// If the context expires first, the context's error is returned and
+// the remaining connections are left to finish on their own.
+//
+// Hijacked connections (e.g. WebSockets) are not waited for. Use RegisterOnShutdown to tell them to close.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+	s.closeListeners()
+
+	s.mu.Lock()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	// HTTP/2 connections close themselves after sending GOAWAY
+	for _, c := range s.http2Conns {
+		go c.shutdown()
+	}
+	s.mu.Unlock()
+
+	// Poll until all connections are closed
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Immediately close all listeners and connections, interrupting any in-flight requests.
+// Use Shutdown to let in-flight requests finish.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+	s.closeListeners()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return nil
+}
+
+// Register a function to call when Shutdown is called, in a goroutine of its own.
+// It lets handlers that hijacked their connection (e.g. WebSockets) say goodbye to their clients and return.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// How often Shutdown checks whether the active connections have become idle
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Parses the HTTP requests on the connection, passes them to the handler,
+// and writes the responses back to the connection.
+func (s *Server) serveConn(conn net.Conn) {
+	// Close and forget the connection when the function returns
+	defer s.forgetConn(conn)
+
+	// Buffer reads and writes on the connection.
+	// The reader is shared by all requests on the connection, as it may hold the start of the next request
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	// Setup a persistent connection until we get a "Connection: close" header or error
+	// This is a simple implementation of HTTP/1.1 persistent connections
+	for first := true; ; first = false {
+		// Wait for the next request, but not longer than the idle timeout.
+		// The connection is idle while waiting, so Shutdown may close it.
+		s.setConnState(conn, stateIdle)
+		if s.inShutdown.Load() {
+			break
+		}
+		conn.SetReadDeadline(deadline(time.Now(), s.idleTimeout()))
+		if _, err := reader.Peek(1); err != nil {
+			break // The client went away, was idle for too long, or the server is shutting down
+		}
+		s.setConnState(conn, stateActive)
+
+		// Switch to HTTP/2 if the client chose it during the TLS handshake, or starts with its preface (prior knowledge)
+		if first && !s.DisableHTTP2 && (negotiatedHTTP2(conn) || hasHTTP2Preface(reader)) {
+			s.serveHTTP2(conn, reader, writer, nil, nil)
+			return
+		}
+
+		// The header section must be read within the header timeout
+		requestStart := time.Now()
+		conn.SetReadDeadline(deadline(requestStart, s.readHeaderTimeout()))
+
+		// Parse the HTTP Request from the connection
+		request, err := parseRequest(reader, s.maxHeaderBytes())
+		if err != nil {
+			// Tell the client what was wrong with the request (e.g. 400 Bad Request),
+			// unless the connection simply went away
+			if status := statusForRequestError(err); status != 0 {
+				s.writeResponse(conn, writer, CreateResponse().WithStatus(status), true)
+			}
+			break
+		}
+
+		// The whole request, including the body, must be read within the read timeout
+		conn.SetReadDeadline(deadline(requestStart, s.ReadTimeout))
+
+		// Switch to HTTP/2 if the client asks to upgrade to h2c, answering the request on the first stream
+		if _, isTLS := conn.(*tls.Conn); !isTLS && !s.DisableHTTP2 {
+			if settings, ok := h2cUpgradeSettings(request); ok {
+				for _, name := range []string{"Connection", "Upgrade", "HTTP2-Settings"} {
+					request.Headers.Delete(name)
+				}
+				switching := CreateResponse().WithStatus(http.StatusSwitchingProtocols)
+				switching.WithHeaders(map[string]string{"Connection": "Upgrade", "Upgrade": "h2c"})
+				if err := s.writeResponse(conn, writer, switching, false); err != nil {
+					break
+				}
+				s.serveHTTP2(conn, reader, writer, request, settings)
+				return
+			}
+		}
+
+		// Keep track of errors the handler runs into while reading the body
+		body := &bodyErrorRecorder{reader: request.body}
+		request.body = body
+
+		// Whether to close the connection or not.
+		// HTTP/1.1 connections persist unless the client sends `Connection: close`,
+		// while HTTP/1.0 ones only persist if the client asks for it with `Connection: keep-alive`
+		// See https://datatracker.ietf.org/doc/html/rfc9112#section-9.3
+		connection, _ := request.Headers.Get("Connection")
+		http10 := request.protocol == "HTTP/1.0"
+		shouldClose := headerHasToken(connection, "close") || (http10 && !headerHasToken(connection, "keep-alive"))
+
+		// Create the HTTP Response, letting the handler take over the connection to switch protocols
+		response := CreateResponse()
+		// The server stops tracking the connection from then on, so Shutdown doesn't wait for it
+		response.hijack = func() (net.Conn, *bufio.ReadWriter) {
+			conn.SetDeadline(time.Time{})
+			s.untrackConn(conn)
+			return conn, bufio.NewReadWriter(reader, writer)
+		}
+
+		// Let the handler populate the response
+		s.handler().ServeHTTP(request, response)
+
+		// The handler took over the connection and is done with it, so it is closed
+		if response.hijacked {
+			break
+		}
+
+		// If the body could not be read in time or was malformed, the connection is out of sync and must be closed
+		if status := statusForRequestError(body.err); status != 0 {
+			response.reset()
+			response.WithStatus(status)
+			shouldClose = true
+		}
+
+		// Responses to HEAD describe the body a GET would get, without sending it.
+		// See https://datatracker.ietf.org/doc/html/rfc9110#section-9.3.2
+		response.omitBody = request.Method == "HEAD"
+
+		// Don't keep the connection alive if the server started shutting down in the meantime
+		if s.inShutdown.Load() {
+			shouldClose = true
+		}
+
+		// HTTP/1.0 clients don't know the chunked transfer coding, so a streamed body ends by closing the connection instead,
+		// and they are told when the connection persists
+		if http10 {
+			if response.withoutChunking() {
+				shouldClose = true
+			}
+			if !shouldClose {
+				response.Headers.Set("Connection", "keep-alive")
+			}
+		}
+
+		// Respond to the connection, streaming the body if there is one
+		if err := s.writeResponse(conn, writer, response, shouldClose); err != nil {
+			fmt.Println("Error writing response: ", err.Error())
+			// Nothing was written yet, so the client can still be told that something went wrong
+			if errors.Is(err, ErrContentLengthMismatch) {
+				s.writeResponse(conn, writer, CreateResponse().WithStatus(http.StatusInternalServerError), true)
+			}
+			break
+		}
+
+		// Close the connection if the `Connection: close` header was set
+		if shouldClose {
+			break
+		}
+
+		// Discard whatever the handler did not read of the request body,
+		// so that the next request starts at the right place
+		if _, err := io.Copy(io.Discard, request.BodyReader()); err != nil {
+			break
+		}
+	}
+}
+
+// Checks if HTTP/2 was chosen during the TLS handshake of the connection (ALPN)
+func negotiatedHTTP2(conn net.Conn) bool {
+	tlsConn, ok := conn.(*tls.Conn)
+	return ok && tlsConn.ConnectionState().NegotiatedProtocol == "h2"
+}
+
+// Write the response to the connection within the write timeout.
+// Sets the `Connection: close` header if the connection is closed afterwards.
+func (s *Server) writeResponse(conn net.Conn, writer *bufio.Writer, response *Response, shouldClose bool) error {
+	if shouldClose {
+		response.Headers.Set("Connection", "close")
+	}
+
+	conn.SetWriteDeadline(deadline(time.Now(), s.WriteTimeout))
+	if _, err := response.WriteTo(writer); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// --------
+// TIMEOUTS
+// --------
+
+// Returns the time at which the timeout expires, or the zero time (no deadline) if the timeout is not set
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+// Checks if the error was caused by a read or write deadline expiring
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// bodyErrorRecorder wraps the body of a request to remember the first error encountered while reading it
+type bodyErrorRecorder struct {
+	reader io.Reader
+	err    error
+}
+
+// Read from the underlying reader, recording any error other than io.EOF
+func (b *bodyErrorRecorder) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// --------
+// DEFAULTS
+// --------
+
+// The handler to invoke for every request
+func (s *Server) handler() Handler {
+	if s.Handler == nil {
+		return HandlerFunc(func(req *Request, res *Response) {
+			res.WithStatus(http.StatusNotFound)
+		})
+	}
+	return s.Handler
+}
+
+// The maximum duration for reading the request-line and header section
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+	return s.ReadTimeout
+}
+
+// The maximum duration to wait for the next request on a persistent connection
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return s.ReadTimeout
+}
+
+// The maximum size of the request-line and header section
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes > 0 {
+		return s.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
+// -----------
+// CONNECTIONS
+// -----------
+
+// Register the listener so that it is closed on shutdown.
+// Returns false if the server is already shutting down.
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown.Load() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// Forget the listener once Serve returns
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+}
+
+// Close all listeners so that no new connections are accepted
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for l := range s.listeners {
+		l.Close()
+	}
+}
+
+// Record the state of the connection
+func (s *Server) setConnState(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connState)
+	}
+	s.conns[conn] = state
+}
+
+// Close the connection and stop tracking it
+func (s *Server) forgetConn(conn net.Conn) {
+	conn.Close()
+	s.untrackConn(conn)
+}
+
+// Stop tracking the connection, without closing it
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// Register the connection as speaking HTTP/2, so that Shutdown tells it to go away
+func (s *Server) trackHTTP2Conn(conn net.Conn, c *http2Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.http2Conns == nil {
+		s.http2Conns = make(map[net.Conn]*http2Conn)
+	}
+	s.http2Conns[conn] = c
+}
+
+// Forget the HTTP/2 connection once it is closed
+func (s *Server) untrackHTTP2Conn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.http2Conns, conn)
+}
+
+// Close all idle connections, returning true if there are no connections left.
+// Idle HTTP/2 connections are left to close themselves, so their clients are told why with GOAWAY.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if _, isHTTP2 := s.http2Conns[conn]; state == stateIdle && !isHTTP2 {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
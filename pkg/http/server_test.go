@@ -0,0 +1,505 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start the server on a random local port and return the address it listens on.
+// The listener is closed when the test finishes.
+func startTestServer(t *testing.T, server *Server) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go server.Serve(l)
+
+	return l.Addr().String()
+}
+
+// Connect to the server at the given address
+func dialTestServer(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// Never let a test hang on a misbehaving server
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn
+}
+
+// Read a single response with a Content-Length from the reader
+func readTestResponse(t *testing.T, reader *bufio.Reader) (string, *Headers, string) {
+	t.Helper()
+
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read status line: %v", err)
+	}
+
+	headers := NewHeaders()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read header line: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		headers.Set(name, value)
+	}
+
+	body := ""
+	if length, ok := headers.Get("Content-Length"); ok {
+		n, err := strconv.Atoi(length)
+		if err != nil {
+			t.Fatalf("Invalid Content-Length: %v", err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatalf("Failed to read body: %v", err)
+		}
+		body = string(buf)
+	}
+
+	return strings.TrimSpace(statusLine), headers, body
+}
+
+func TestServerPersistentConnection(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /echo/{str}", func(req *Request, res *Response) {
+		res.WithStatus(200).WithHeaders(map[string]string{"Content-Length": "5"}).WithBody(req.Param("str"))
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+
+	// Send multiple requests on the same connection
+	for _, str := range []string{"hello", "world"} {
+		io.WriteString(conn, "GET /echo/"+str+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+		status, _, body := readTestResponse(t, reader)
+		if status != "HTTP/1.1 200 OK" {
+			t.Errorf("Expected status line HTTP/1.1 200 OK, but got %s", status)
+		}
+		if body != str {
+			t.Errorf("Expected body %s, but got %s", str, body)
+		}
+	}
+}
+
+func TestServerHEAD(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /hello", func(req *Request, res *Response) {
+		res.WithStatus(200).WithBody("Hello, World!")
+	})
+	router.HandleFunc("GET /stream", func(req *Request, res *Response) {
+		res.WithStatus(200).WithBodyReader(strings.NewReader("Hello, World!"), 13)
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+
+	for _, path := range []string{"/hello", "/stream"} {
+		io.WriteString(conn, "HEAD "+path+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+		// Read the head of the response, which must not be followed by a body
+		head := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read the response: %v", err)
+			}
+			head += line
+			if line == "\r\n" {
+				break
+			}
+		}
+		if !strings.HasPrefix(head, "HTTP/1.1 200 OK") {
+			t.Errorf("Expected status line HTTP/1.1 200 OK, but got %s", head)
+		}
+		if !strings.Contains(head, "Content-Length: 13\r\n") {
+			t.Errorf("Expected the Content-Length of the body a GET would get, but got %s", head)
+		}
+	}
+
+	// The next response starts right after the head, so no body was sent
+	io.WriteString(conn, "GET /hello HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	status, _, body := readTestResponse(t, reader)
+	if status != "HTTP/1.1 200 OK" {
+		t.Errorf("Expected status line HTTP/1.1 200 OK, but got %s", status)
+	}
+	if body != "Hello, World!" {
+		t.Errorf("Expected body Hello, World!, but got %s", body)
+	}
+}
+
+func TestServerConnectionClose(t *testing.T) {
+	addr := startTestServer(t, &Server{})
+
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+	io.WriteString(conn, "GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+
+	status, headers, _ := readTestResponse(t, reader)
+	if status != "HTTP/1.1 404 Not Found" {
+		t.Errorf("Expected status line HTTP/1.1 404 Not Found, but got %s", status)
+	}
+	if connection, _ := headers.Get("Connection"); connection != "close" {
+		t.Errorf("Expected Connection: close, but got %s", connection)
+	}
+
+	// The server must close the connection after responding
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, but got %v", err)
+	}
+}
+
+func TestServerConnectionPersistence(t *testing.T) {
+	addr := startTestServer(t, &Server{})
+
+	testCases := []struct {
+		name       string
+		request    string
+		connection string // The Connection header of the response
+		persists   bool
+	}{
+		{name: "HTTP/1.1", request: "GET / HTTP/1.1\r\n\r\n", connection: "", persists: true},
+		{name: "HTTP/1.1 close in any case", request: "GET / HTTP/1.1\r\nConnection: Close\r\n\r\n", connection: "close"},
+		{name: "HTTP/1.1 close among other tokens", request: "GET / HTTP/1.1\r\nConnection: keep-alive, close\r\n\r\n", connection: "close"},
+		{name: "HTTP/1.0", request: "GET / HTTP/1.0\r\n\r\n", connection: "close"},
+		{name: "HTTP/1.0 keep-alive", request: "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n", connection: "keep-alive", persists: true},
+		{name: "HTTP/1.0 keep-alive and close", request: "GET / HTTP/1.0\r\nConnection: keep-alive, close\r\n\r\n", connection: "close"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dialTestServer(t, addr)
+			reader := bufio.NewReader(conn)
+			io.WriteString(conn, tc.request)
+
+			status, headers, _ := readTestResponse(t, reader)
+			if status != "HTTP/1.1 404 Not Found" {
+				t.Errorf("Expected status line HTTP/1.1 404 Not Found, but got %s", status)
+			}
+			if connection, _ := headers.Get("Connection"); connection != tc.connection {
+				t.Errorf("Expected Connection: %q, but got %q", tc.connection, connection)
+			}
+
+			// A persistent connection answers the next request, otherwise it is closed
+			io.WriteString(conn, tc.request)
+			if tc.persists {
+				if status, _, _ := readTestResponse(t, reader); status != "HTTP/1.1 404 Not Found" {
+					t.Errorf("Expected a second response, but got %s", status)
+				}
+			} else if _, err := reader.ReadByte(); err != io.EOF {
+				t.Errorf("Expected the connection to be closed, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestServerHTTP10StreamedBody(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /stream", func(req *Request, res *Response) {
+		res.WithStatus(200).WithBodyReader(strings.NewReader("Hello, World!"), -1)
+	})
+	router.HandleFunc("GET /chunked", func(req *Request, res *Response) {
+		res.WithStatus(200).WithChunkedEncoding().WithBody("Hello, World!")
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	// A streamed body of unknown length isn't chunked, but ends by closing the connection
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "GET /stream HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read the response: %v", err)
+	}
+	head, body, _ := strings.Cut(string(response), "\r\n\r\n")
+	if strings.Contains(head, "Transfer-Encoding") || strings.Contains(head, "Content-Length") {
+		t.Errorf("Expected neither Transfer-Encoding nor Content-Length, but got %s", head)
+	}
+	if !strings.Contains(head, "Connection: close\r\n") {
+		t.Errorf("Expected Connection: close, but got %s", head)
+	}
+	if body != "Hello, World!" {
+		t.Errorf("Expected body Hello, World!, but got %q", body)
+	}
+
+	// An in-memory body gets a Content-Length, so the connection persists
+	conn = dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		io.WriteString(conn, "GET /chunked HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+		status, headers, body := readTestResponse(t, reader)
+		if status != "HTTP/1.1 200 OK" || body != "Hello, World!" {
+			t.Errorf("Expected 200 with body Hello, World!, but got %s with %q", status, body)
+		}
+		if headers.Contains("Transfer-Encoding") {
+			t.Errorf("Expected no Transfer-Encoding for HTTP/1.0")
+		}
+	}
+}
+
+func TestServerMaxHeaderBytes(t *testing.T) {
+	addr := startTestServer(t, &Server{MaxHeaderBytes: 64})
+
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "GET / HTTP/1.1\r\nX-Large: "+strings.Repeat("a", 128)+"\r\n\r\n")
+
+	// The server must refuse to read the oversized header section
+	status, _, _ := readTestResponse(t, bufio.NewReader(conn))
+	if status != "HTTP/1.1 431 Request Header Fields Too Large" {
+		t.Errorf("Expected status line HTTP/1.1 431 Request Header Fields Too Large, but got %s", status)
+	}
+}
+
+func TestServerMalformedRequest(t *testing.T) {
+	testCases := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "Malformed request line",
+			request:  "GET /\r\n\r\n",
+			expected: "HTTP/1.1 400 Bad Request",
+		},
+		{
+			name:     "Invalid header",
+			request:  "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			expected: "HTTP/1.1 400 Bad Request",
+		},
+		{
+			name:     "Unsupported version",
+			request:  "GET / HTTP/3.0\r\n\r\n",
+			expected: "HTTP/1.1 505 HTTP Version Not Supported",
+		},
+		{
+			name:     "Malformed chunked body",
+			request:  "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+			expected: "HTTP/1.1 400 Bad Request",
+		},
+	}
+
+	router := NewRouter()
+	router.HandleFunc("POST /upload", func(req *Request, res *Response) {
+		if _, err := io.ReadAll(req.BodyReader()); err != nil {
+			res.WithStatus(500)
+			return
+		}
+		res.WithStatus(201)
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := dialTestServer(t, addr)
+			io.WriteString(conn, tc.request)
+
+			reader := bufio.NewReader(conn)
+			status, headers, _ := readTestResponse(t, reader)
+			if status != tc.expected {
+				t.Errorf("Expected status line %s, but got %s", tc.expected, status)
+			}
+			if connection, _ := headers.Get("Connection"); connection != "close" {
+				t.Errorf("Expected Connection: close, but got %s", connection)
+			}
+			if _, err := reader.ReadByte(); err != io.EOF {
+				t.Errorf("Expected the connection to be closed, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	addr := startTestServer(t, &Server{IdleTimeout: 50 * time.Millisecond})
+
+	// Send nothing and wait for the server to give up on the connection
+	conn := dialTestServer(t, addr)
+	start := time.Now()
+	if _, err := bufio.NewReader(conn).ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the connection to be closed after the idle timeout, but it took %v", elapsed)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	// A handler that blocks until released, to simulate an in-flight request
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := NewRouter()
+	router.HandleFunc("GET /slow", func(req *Request, res *Response) {
+		close(started)
+		<-release
+		res.WithStatus(200).WithHeaders(map[string]string{"Content-Length": "4"}).WithBody("done")
+	})
+
+	server := &Server{Handler: router}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(l) }()
+
+	// An idle persistent connection, and a connection with a request in-flight
+	idle := dialTestServer(t, l.Addr().String())
+	active := dialTestServer(t, l.Addr().String())
+	io.WriteString(active, "GET /slow HTTP/1.1\r\n\r\n")
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- server.Shutdown(context.Background()) }()
+
+	// Serve must return as soon as the listener is closed
+	if err := <-serveErr; err != ErrServerClosed {
+		t.Errorf("Expected Serve to return ErrServerClosed, but got %v", err)
+	}
+
+	// The idle connection is closed right away
+	if _, err := bufio.NewReader(idle).ReadByte(); err != io.EOF {
+		t.Errorf("Expected the idle connection to be closed, but got %v", err)
+	}
+
+	// Shutdown waits for the in-flight request
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Expected Shutdown to wait for the in-flight request, but it returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The in-flight request completes, and the connection is closed afterwards
+	close(release)
+	reader := bufio.NewReader(active)
+	status, headers, body := readTestResponse(t, reader)
+	if status != "HTTP/1.1 200 OK" || body != "done" {
+		t.Errorf("Expected the in-flight request to complete, but got %s %s", status, body)
+	}
+	if connection, _ := headers.Get("Connection"); connection != "close" {
+		t.Errorf("Expected Connection: close, but got %s", connection)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the active connection to be closed, but got %v", err)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Expected Shutdown to succeed, but got %v", err)
+	}
+
+	// New connections are refused
+	if conn, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		conn.Close()
+		t.Errorf("Expected new connections to be refused")
+	}
+}
+
+func TestServerShutdownContextExpired(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	router := NewRouter()
+	router.HandleFunc("GET /slow", func(req *Request, res *Response) {
+		close(started)
+		<-release
+	})
+
+	server := &Server{Handler: router}
+	addr := startTestServer(t, server)
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "GET /slow HTTP/1.1\r\n\r\n")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, but got %v", err)
+	}
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	addr := startTestServer(t, &Server{ReadHeaderTimeout: 50 * time.Millisecond})
+
+	// Start a request, but never finish the header section
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: loc")
+
+	reader := bufio.NewReader(conn)
+	status, headers, _ := readTestResponse(t, reader)
+	if status != "HTTP/1.1 408 Request Timeout" {
+		t.Errorf("Expected status line HTTP/1.1 408 Request Timeout, but got %s", status)
+	}
+	if connection, _ := headers.Get("Connection"); connection != "close" {
+		t.Errorf("Expected Connection: close, but got %s", connection)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, but got %v", err)
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("POST /upload", func(req *Request, res *Response) {
+		if _, err := io.ReadAll(req.BodyReader()); err != nil {
+			res.WithStatus(500)
+			return
+		}
+		res.WithStatus(201)
+	})
+	addr := startTestServer(t, &Server{Handler: router, ReadTimeout: 100 * time.Millisecond})
+
+	// Send the header section, but only part of the body
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "POST /upload HTTP/1.1\r\nContent-Length: 100\r\n\r\npartial")
+
+	reader := bufio.NewReader(conn)
+	status, _, _ := readTestResponse(t, reader)
+	if status != "HTTP/1.1 408 Request Timeout" {
+		t.Errorf("Expected status line HTTP/1.1 408 Request Timeout, but got %s", status)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, but got %v", err)
+	}
+}
+
+func TestServerContentLengthMismatch(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET /", func(req *Request, res *Response) {
+		res.WithStatus(200).WithHeaders(map[string]string{"Content-Length": "100"}).WithBody("short")
+	})
+	addr := startTestServer(t, &Server{Handler: router})
+
+	conn := dialTestServer(t, addr)
+	io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+
+	// The bogus length must never reach the client
+	status, headers, _ := readTestResponse(t, bufio.NewReader(conn))
+	if status != "HTTP/1.1 500 Internal Server Error" {
+		t.Errorf("Expected status line HTTP/1.1 500 Internal Server Error, but got %s", status)
+	}
+	if length, _ := headers.Get("Content-Length"); length != "0" {
+		t.Errorf("Expected Content-Length: 0, but got %s", length)
+	}
+}
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc8446
+// --------------------------------------------------------------------------
+
+// Listen on the TCP address of the server and serve HTTPS requests on incoming connections.
+// The certificate and key files are optional if the TLSConfig already provides the certificates.
+// Blocks until the listener fails.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if s.inShutdown.Load() {
+		return ErrServerClosed
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":4443"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// Accept connections on the listener and serve HTTPS requests on each of them, like Serve.
+// The certificate and key files are optional if the TLSConfig already provides the certificates.
+// Always closes the listener before returning.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		l.Close()
+		return errors.New("http: no certificate to serve TLS with")
+	}
+
+	// Offer HTTP/2, falling back to HTTP/1.1 for clients that don't speak it
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+		if s.DisableHTTP2 {
+			config.NextProtos = []string{"http/1.1"}
+		}
+	}
+
+	// The handshake happens on the first read of each connection, within the idle timeout
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// RedirectToHTTPS returns a Handler that redirects every request to the same URL over HTTPS,
+// on the given port of the same host (e.g. `http://example.com/a?b` -> `https://example.com:4443/a?b`).
+// The port is left out of the URL if it is the default 443.
+func RedirectToHTTPS(port string) Handler {
+	return HandlerFunc(func(req *Request, res *Response) {
+		host, ok := req.Headers.Get("Host")
+		if !ok || host == "" {
+			res.WithStatus(http.StatusBadRequest)
+			return
+		}
+		// Replace the port of the plain HTTP listener, if the Host has one
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // An IPv6 address
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+
+		// 301 is only guaranteed to keep the method for GET and HEAD, while 308 keeps it for all methods
+		status := http.StatusPermanentRedirect
+		if req.Method == "GET" || req.Method == "HEAD" {
+			status = http.StatusMovedPermanently
+		}
+		res.WithStatus(status).WithHeaders(map[string]string{
+			"Location": "https://" + host + req.Path,
+		})
+	})
+}
+
+// ------------
+// CERTIFICATES
+// ------------
+
+// Certificates holds the certificates of a TLS server, and picks the one to present to each client by the
+// name it asks for in the SNI extension. The first certificate is presented to clients that don't send a name,
+// or whose name no certificate covers.
+//
+// The files are reloaded when they change (e.g. once a certificate is renewed), without restarting the server.
+// Use it as the GetCertificate callback of a tls.Config:
+//
+//	certificates := NewCertificates()
+//	certificates.Add("example.com.pem", "example.com.key")
+//	go certificates.Watch(ctx, 10*time.Second)
+//	server.TLSConfig = &tls.Config{GetCertificate: certificates.GetCertificate}
+type Certificates struct {
+	mu    sync.RWMutex       // Guards the pairs
+	pairs []*certificatePair // The certificates in the order they were added
+}
+
+// A certificate loaded from a pair of files
+type certificatePair struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	version  string // Identifies the content of both files when they were loaded
+}
+
+// Instantiate an empty set of certificates
+func NewCertificates() *Certificates {
+	return &Certificates{}
+}
+
+// Load the certificate and private key from a pair of PEM files, and add it to the set
+func (c *Certificates) Add(certFile, keyFile string) error {
+	pair := &certificatePair{certFile: certFile, keyFile: keyFile}
+	if err := pair.load(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pairs = append(c.pairs, pair)
+	return nil
+}
+
+// Returns the certificate to present to the client, for use as tls.Config.GetCertificate
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.pairs) == 0 {
+		return nil, errors.New("http: no certificates")
+	}
+	if hello.ServerName != "" {
+		for _, pair := range c.pairs {
+			if hello.SupportsCertificate(pair.cert) == nil {
+				return pair.cert, nil
+			}
+		}
+	}
+	return c.pairs[0].cert, nil
+}
+
+// Reload the certificates whose files changed since they were loaded.
+// A certificate that fails to load (e.g. because its key has not been replaced yet) keeps being presented
+// as it was, and is tried again on the next reload. Returns the errors of the certificates that failed.
+func (c *Certificates) Reload() error {
+	c.mu.RLock()
+	pairs := append([]*certificatePair(nil), c.pairs...)
+	c.mu.RUnlock()
+
+	var errs []error
+	for _, pair := range pairs {
+		version, err := fileVersion(pair.certFile, pair.keyFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		c.mu.RLock()
+		changed := version != pair.version
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		reloaded := &certificatePair{certFile: pair.certFile, keyFile: pair.keyFile}
+		if err := reloaded.load(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.mu.Lock()
+		*pair = *reloaded
+		c.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Check the files for changes at the given interval, and reload the ones that changed.
+// Blocks until the context is done.
+func (c *Certificates) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reload(); err != nil {
+				fmt.Println("Failed to reload certificates: ", err.Error())
+			}
+		}
+	}
+}
+
+// Load the certificate from its files, remembering their version
+func (p *certificatePair) load() error {
+	version, err := fileVersion(p.certFile, p.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", p.certFile, err)
+	}
+	// Parse the leaf once, instead of on every handshake that checks whether it covers the server name
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parsing %s: %w", p.certFile, err)
+		}
+	}
+
+	p.cert = &cert
+	p.version = version
+	return nil
+}
+
+// Identifies the current content of the files by their size and modification time
+func fileVersion(names ...string) (string, error) {
+	var version strings.Builder
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&version, "%d-%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return version.String(), nil
+}
@@ -0,0 +1,274 @@
+package http
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Generate a self-signed certificate for the hosts, and write it and its key to PEM files in the directory.
+// Returns the paths of the files and the certificate, so that clients can trust it.
+func createTestCertificate(t *testing.T, dir, name string, hosts ...string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Failed to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+// Start the server with TLS on a random local port and return the address it listens on
+func startTestTLSServer(t *testing.T, server *Server, certFile, keyFile string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go server.ServeTLS(l, certFile, keyFile)
+
+	return l.Addr().String()
+}
+
+// Complete a TLS handshake with the server, asking for the server name, and return the certificate it presented
+func handshakeTestServer(t *testing.T, addr, serverName string) *x509.Certificate {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestServerServeTLS(t *testing.T) {
+	certFile, keyFile, cert := createTestCertificate(t, t.TempDir(), "localhost", "localhost", "127.0.0.1")
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		res.WithStatus(200).WithBody("secure")
+	})}
+	addr := startTestTLSServer(t, server, certFile, keyFile)
+
+	// Trust the self-signed certificate
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "" && protocol != "http/1.1" {
+		t.Errorf("Expected http/1.1 to be negotiated, but got %q", protocol)
+	}
+
+	// Persistent connections work the same as over plain TCP
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		status, _, body := readTestResponse(t, reader)
+		if status != "HTTP/1.1 200 OK" || body != "secure" {
+			t.Errorf("Expected 200 with body %q, but got %q with body %q", "secure", status, body)
+		}
+	}
+}
+
+func TestServerServeTLSWithoutCertificate(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	if err := (&Server{}).ServeTLS(l, "", ""); err == nil {
+		t.Errorf("Expected an error without a certificate")
+	}
+	// The listener must be closed
+	if _, err := l.Accept(); err == nil {
+		t.Errorf("Expected the listener to be closed")
+	}
+}
+
+func TestCertificatesSNI(t *testing.T) {
+	dir := t.TempDir()
+	certificates := NewCertificates()
+	for _, hosts := range [][]string{{"default.test"}, {"example.test", "www.example.test"}, {"*.wildcard.test"}} {
+		certFile, keyFile, _ := createTestCertificate(t, dir, hosts[0], hosts...)
+		if err := certificates.Add(certFile, keyFile); err != nil {
+			t.Fatalf("Failed to add certificate: %v", err)
+		}
+	}
+
+	server := &Server{TLSConfig: &tls.Config{GetCertificate: certificates.GetCertificate}}
+	addr := startTestTLSServer(t, server, "", "")
+
+	tests := []struct {
+		serverName string
+		expected   string // The common name of the certificate the server should present
+	}{
+		{"example.test", "example.test"},
+		{"www.example.test", "example.test"},
+		{"api.wildcard.test", "*.wildcard.test"},
+		{"default.test", "default.test"},
+		{"unknown.test", "default.test"}, // Falls back to the first certificate
+		{"", "default.test"},             // No SNI
+	}
+
+	for _, test := range tests {
+		cert := handshakeTestServer(t, addr, test.serverName)
+		if cert.Subject.CommonName != test.expected {
+			t.Errorf("Expected %q to get the certificate of %q, but got %q", test.serverName, test.expected, cert.Subject.CommonName)
+		}
+	}
+}
+
+func TestCertificatesReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := createTestCertificate(t, dir, "site", "old.test")
+
+	certificates := NewCertificates()
+	if err := certificates.Add(certFile, keyFile); err != nil {
+		t.Fatalf("Failed to add certificate: %v", err)
+	}
+	server := &Server{TLSConfig: &tls.Config{GetCertificate: certificates.GetCertificate}}
+	addr := startTestTLSServer(t, server, "", "")
+
+	// Nothing changed
+	if err := certificates.Reload(); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	if cert := handshakeTestServer(t, addr, ""); cert.Subject.CommonName != "old.test" {
+		t.Errorf("Expected the certificate of %q, but got %q", "old.test", cert.Subject.CommonName)
+	}
+
+	// A broken certificate is reported, and the previous one is kept
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := certificates.Reload(); err == nil {
+		t.Errorf("Expected an error reloading a broken certificate")
+	}
+	if cert := handshakeTestServer(t, addr, ""); cert.Subject.CommonName != "old.test" {
+		t.Errorf("Expected the certificate of %q to be kept, but got %q", "old.test", cert.Subject.CommonName)
+	}
+
+	// A renewed certificate replaces the previous one without a restart.
+	// Make sure the modification time changes, even on filesystems with a coarse resolution
+	createTestCertificate(t, dir, "site", "new.test")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if err := certificates.Reload(); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	if cert := handshakeTestServer(t, addr, ""); cert.Subject.CommonName != "new.test" {
+		t.Errorf("Expected the certificate of %q, but got %q", "new.test", cert.Subject.CommonName)
+	}
+}
+
+func TestCertificatesAddInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _, _ := createTestCertificate(t, dir, "a", "a.test")
+	_, otherKeyFile, _ := createTestCertificate(t, dir, "b", "b.test")
+
+	certificates := NewCertificates()
+	if err := certificates.Add(certFile, otherKeyFile); err == nil {
+		t.Errorf("Expected an error for a key that doesn't match the certificate")
+	}
+	if err := certificates.Add(filepath.Join(dir, "missing.pem"), otherKeyFile); err == nil {
+		t.Errorf("Expected an error for a missing certificate")
+	}
+	if _, err := certificates.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Errorf("Expected an error without certificates")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		method   string
+		host     string
+		path     string
+		port     string
+		status   int
+		location string
+	}{
+		{"GET", "example.com:4221", "/files/a.txt?x=1", "4443", 301, "https://example.com:4443/files/a.txt?x=1"},
+		{"HEAD", "example.com", "/", "443", 301, "https://example.com/"},
+		{"POST", "example.com", "/files/a.txt", "4443", 308, "https://example.com:4443/files/a.txt"},
+		{"GET", "[::1]:4221", "/", "4443", 301, "https://[::1]:4443/"},
+		{"GET", "", "/", "4443", 400, ""},
+	}
+
+	for _, test := range tests {
+		req := createTestRequest(test.method, test.path)
+		if test.host != "" {
+			req.Headers.Set("Host", test.host)
+		}
+		res := CreateResponse()
+		RedirectToHTTPS(test.port).ServeHTTP(req, res)
+
+		if res.statusCode != test.status {
+			t.Errorf("Expected status %d for %s %s, but got %d", test.status, test.method, test.host, res.statusCode)
+		}
+		if location, _ := res.Headers.Get("Location"); location != test.location {
+			t.Errorf("Expected Location %q, but got %q", test.location, location)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package http
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// --------------------------------------------------------------------------
+// REFERENCE: https://datatracker.ietf.org/doc/html/rfc6455
+// --------------------------------------------------------------------------
+
+// Appended to the key of the client to compute Sec-WebSocket-Accept. See https://datatracker.ietf.org/doc/html/rfc6455#section-1.3
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The types of data messages
+const (
+	TextMessage   = 1 // UTF-8 text
+	BinaryMessage = 2 // Arbitrary bytes
+)
+
+// The opcodes of frames. See https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+const (
+	webSocketOpContinuation = 0x0
+	webSocketOpText         = 0x1
+	webSocketOpBinary       = 0x2
+	webSocketOpClose        = 0x8
+	webSocketOpPing         = 0x9
+	webSocketOpPong         = 0xa
+)
+
+// The status codes of close frames. See https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.1
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001 // The server is shutting down, or the browser navigated away
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003 // e.g. binary messages to an endpoint that only understands text
+	CloseNoStatus        = 1005 // Never sent: the close frame had no status code
+	CloseInvalidPayload  = 1007 // e.g. a text message that isn't UTF-8
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// The default limit on the size of a message received, once its fragments are put together
+const DefaultMaxMessageSize = 16 << 20 // 16 MB
+
+// How long Close waits for the peer to answer with its own close frame
+const webSocketCloseTimeout = 5 * time.Second
+
+// Returned by Upgrade when the request is not a valid WebSocket opening handshake
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Returned when writing after the close frame was sent
+var ErrWebSocketClosed = errors.New("websocket: close frame already sent")
+
+// CloseError is returned by ReadMessage once the connection is closed, with the status code of the close frame.
+// This is either the status the client closed the connection with, or the one the server failed it with (e.g. CloseProtocolError).
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with status %d %s", e.Code, e.Reason)
+}
+
+// Upgrade the connection of the request to the WebSocket protocol, completing the opening handshake.
+// See https://datatracker.ietf.org/doc/html/rfc6455#section-4.2
+//
+// If the request is not a WebSocket handshake, the response is set to the matching error
+// (e.g. 426 Upgrade Required for a plain GET) and the error is returned; the handler should then return.
+// Requests over HTTP/2 are answered with 400 Bad Request, as only HTTP/1.1 connections can be upgraded.
+// Otherwise the connection is hijacked and the response must not be used anymore.
+// The WebSocket may be used until the handler returns, after which the connection is closed.
+func Upgrade(req *Request, res *Response) (*WebSocket, error) {
+	if req.Method != "GET" {
+		res.WithStatus(http.StatusMethodNotAllowed).WithHeaders(map[string]string{"Allow": "GET"})
+		return nil, fmt.Errorf("%w: method %s", ErrBadHandshake, req.Method)
+	}
+
+	// Plain requests are told which protocol the endpoint speaks
+	connection, _ := req.Headers.Get("Connection")
+	upgrade, _ := req.Headers.Get("Upgrade")
+	if !headerHasToken(connection, "upgrade") || !headerHasToken(upgrade, "websocket") {
+		res.WithStatus(http.StatusUpgradeRequired).WithHeaders(map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"})
+		return nil, fmt.Errorf("%w: not a WebSocket upgrade", ErrBadHandshake)
+	}
+
+	// Version 13 is the only one there is. See https://datatracker.ietf.org/doc/html/rfc6455#section-4.4
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); version != "13" {
+		res.WithStatus(http.StatusUpgradeRequired).WithHeaders(map[string]string{"Sec-WebSocket-Version": "13"})
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrBadHandshake, version)
+	}
+
+	// The key is 16 random bytes, base64-encoded
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		res.WithStatus(http.StatusBadRequest).WithBody("Bad Request: Invalid Sec-WebSocket-Key")
+		return nil, fmt.Errorf("%w: invalid key %q", ErrBadHandshake, key)
+	}
+
+	// Take over the connection. Over HTTP/2 the connection is shared by many requests,
+	// and WebSockets over HTTP/2 (RFC 8441) are not supported, so the client must use HTTP/1.1
+	conn, rw, err := res.Hijack()
+	if errors.Is(err, ErrNotHijackable) {
+		res.WithStatus(http.StatusBadRequest).WithBody("Bad Request: WebSockets require HTTP/1.1")
+		return nil, fmt.Errorf("%w: %w", ErrBadHandshake, err)
+	}
+	if err != nil {
+		res.WithStatus(http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// Switch protocols, proving to the client that the server understood the handshake
+	res.WithStatus(http.StatusSwitchingProtocols).WithHeaders(map[string]string{
+		"Connection":           "Upgrade",
+		"Upgrade":              "websocket",
+		"Sec-WebSocket-Accept": webSocketAccept(key),
+	})
+	if _, err := res.WriteTo(rw.Writer); err != nil {
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &WebSocket{conn: conn, reader: rw.Reader, writer: rw.Writer}, nil
+}
+
+// Compute the Sec-WebSocket-Accept of the key of the client
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ---------
+// WEBSOCKET
+// ---------
+
+// A WebSocket connection, on which the server and the client exchange messages in both directions.
+// One goroutine may read messages while others write them.
+type WebSocket struct {
+	MaxMessageSize int64             // Maximum size of a message received. Defaults to DefaultMaxMessageSize
+	OnPong         func(data []byte) // Called by ReadMessage with the data of each pong received, if set
+
+	conn    net.Conn
+	reader  *bufio.Reader
+	readErr error // The error that ended reading, returned by every later ReadMessage
+
+	messageMu sync.Mutex // Held while writing a data message, so that the fragments of messages don't interleave
+	writeMu   sync.Mutex // Held while writing a frame, as control frames may be sent in between fragments
+	writer    *bufio.Writer
+	closeSent bool // Whether the close frame was sent, after which no other frame may be
+}
+
+// A frame of a WebSocket connection. See https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+type webSocketFrame struct {
+	fin     bool   // Whether this is the last frame of the message
+	opcode  byte   // The type of the frame (e.g. webSocketOpText)
+	payload []byte // The unmasked payload
+}
+
+// Read the next data message, returning its type (TextMessage or BinaryMessage) and its content.
+// Fragmented messages are put together, pings are answered with pongs and pongs are passed to OnPong.
+//
+// Once the client closes the connection, or it is failed because the client broke the protocol,
+// a *CloseError is returned. The close frame of the client is answered, completing the closing handshake.
+func (ws *WebSocket) ReadMessage() (int, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+	typ, message, err := ws.readMessage()
+	if err != nil {
+		ws.readErr = err
+	}
+	return typ, message, err
+}
+
+// Read frames until a data message is complete
+func (ws *WebSocket) readMessage() (int, []byte, error) {
+	var typ int
+	var message []byte
+	for {
+		frame, err := ws.readFrame(ws.maxMessageSize() - int64(len(message)))
+		if err != nil {
+			return 0, nil, ws.fail(err)
+		}
+
+		switch frame.opcode {
+		case webSocketOpPing:
+			// Pongs can't be sent anymore once closing, which is fine
+			if err := ws.writeFrame(true, webSocketOpPong, frame.payload); err != nil && err != ErrWebSocketClosed {
+				return 0, nil, err
+			}
+			continue
+		case webSocketOpPong:
+			if ws.OnPong != nil {
+				ws.OnPong(frame.payload)
+			}
+			continue
+		case webSocketOpClose:
+			return 0, nil, ws.handleClose(frame.payload)
+		case webSocketOpText, webSocketOpBinary:
+			if typ != 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "new message before the previous one ended"})
+			}
+			typ = int(frame.opcode)
+		case webSocketOpContinuation:
+			if typ == 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "continuation frame without a message"})
+			}
+		}
+
+		message = append(message, frame.payload...)
+		if !frame.fin {
+			continue
+		}
+
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, ws.fail(&CloseError{CloseInvalidPayload, "text message is not UTF-8"})
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return typ, message, nil
+	}
+}
+
+// Read the next frame, rejecting data frames larger than the limit.
+// Protocol violations are returned as a *CloseError.
+func (ws *WebSocket) readFrame(limit int64) (webSocketFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return webSocketFrame{}, err
+	}
+	frame := webSocketFrame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f}
+
+	// No extension was negotiated, so the reserved bits must not be set
+	if header[0]&0x70 != 0 {
+		return frame, &CloseError{CloseProtocolError, "reserved bits set"}
+	}
+	switch frame.opcode {
+	case webSocketOpContinuation, webSocketOpText, webSocketOpBinary, webSocketOpClose, webSocketOpPing, webSocketOpPong:
+	default:
+		return frame, &CloseError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", frame.opcode)}
+	}
+
+	// Every frame from the client is masked. See https://datatracker.ietf.org/doc/html/rfc6455#section-5.1
+	if header[1]&0x80 == 0 {
+		return frame, &CloseError{CloseProtocolError, "unmasked frame"}
+	}
+
+	// The length takes 7 bits, or the next 2 or 8 bytes
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return frame, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.reader, extended[:]); err != nil {
+			return frame, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+		if length > 1<<63-1 {
+			return frame, &CloseError{CloseProtocolError, "frame length over 63 bits"}
+		}
+	}
+
+	// Control frames are short and never fragmented. See https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+	if frame.opcode >= webSocketOpClose {
+		if !frame.fin || length > 125 {
+			return frame, &CloseError{CloseProtocolError, "fragmented or long control frame"}
+		}
+	} else if length > uint64(limit) {
+		return frame, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+
+	// Unmask the payload with the key that precedes it
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return frame, err
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, frame.payload); err != nil {
+		return frame, err
+	}
+	for i := range frame.payload {
+		frame.payload[i] ^= mask[i%4]
+	}
+	return frame, nil
+}
+
+// Answer the close frame of the client, returning its status as a *CloseError.
+// See https://datatracker.ietf.org/doc/html/rfc6455#section-5.5.1
+func (ws *WebSocket) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	if len(payload) == 1 {
+		return ws.fail(&CloseError{CloseProtocolError, "close frame with a 1-byte payload"})
+	}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !isValidCloseCode(closeErr.Code) {
+			return ws.fail(&CloseError{CloseProtocolError, fmt.Sprintf("invalid close status %d", closeErr.Code)})
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return ws.fail(&CloseError{CloseInvalidPayload, "close reason is not UTF-8"})
+		}
+	}
+
+	// Echo the status, unless the server already started closing
+	if err := ws.writeClose(closeErr.Code, ""); err != nil && err != ErrWebSocketClosed {
+		return err
+	}
+	return closeErr
+}
+
+// Checks if the status code may be sent in a close frame. See https://datatracker.ietf.org/doc/html/rfc6455#section-7.4
+func isValidCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999 // Registered by libraries and applications, or private
+	}
+}
+
+// Fail the connection on a protocol violation by sending a close frame with its status.
+// Errors of the connection itself (e.g. io.EOF) are returned as is.
+func (ws *WebSocket) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		ws.writeClose(closeErr.Code, closeErr.Reason)
+	}
+	return err
+}
+
+// The maximum size of a message received
+func (ws *WebSocket) maxMessageSize() int64 {
+	if ws.MaxMessageSize > 0 {
+		return ws.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// -------
+// WRITING
+// -------
+
+// Send a message of the type (TextMessage or BinaryMessage) in a single frame
+func (ws *WebSocket) WriteMessage(typ int, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	ws.messageMu.Lock()
+	defer ws.messageMu.Unlock()
+	return ws.writeFrame(true, byte(typ), data)
+}
+
+// Start a message of the type (TextMessage or BinaryMessage) whose content is not known upfront.
+// Every Write sends a fragment, and Close ends the message.
+// Other messages wait until it has ended, while pings and pongs may be sent in between.
+func (ws *WebSocket) NextWriter(typ int) (io.WriteCloser, error) {
+	if typ != TextMessage && typ != BinaryMessage {
+		return nil, fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	ws.messageMu.Lock()
+	return &webSocketMessageWriter{ws: ws, opcode: byte(typ)}, nil
+}
+
+// Send a ping, which the client answers with a pong carrying the same data (at most 125 bytes)
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("websocket: ping payload over 125 bytes")
+	}
+	return ws.writeFrame(true, webSocketOpPing, data)
+}
+
+// Start the closing handshake with the status code (e.g. CloseNormal or CloseGoingAway) and reason.
+// The client answers with its own close frame, which ReadMessage returns as a *CloseError.
+// Reading gives up if the client doesn't answer in time.
+// See https://datatracker.ietf.org/doc/html/rfc6455#section-7.1.2
+func (ws *WebSocket) Close(code int, reason string) error {
+	if !isValidCloseCode(code) {
+		return fmt.Errorf("websocket: invalid close status %d", code)
+	}
+	if len(reason) > 123 {
+		return errors.New("websocket: close reason over 123 bytes")
+	}
+	err := ws.writeClose(code, reason)
+	ws.conn.SetReadDeadline(time.Now().Add(webSocketCloseTimeout))
+	return err
+}
+
+// Set the deadline for reading the next frames. A zero value means no deadline
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// Set the deadline for writing the next frames. A zero value means no deadline
+func (ws *WebSocket) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// Send the close frame, after which no other frame may be sent
+func (ws *WebSocket) writeClose(code int, reason string) error {
+	var payload []byte
+	if code != CloseNoStatus {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if err := ws.writeFrameLocked(true, webSocketOpClose, payload); err != nil {
+		return err
+	}
+	ws.closeSent = true
+	return nil
+}
+
+// Send a frame
+func (ws *WebSocket) writeFrame(fin bool, opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	return ws.writeFrameLocked(fin, opcode, payload)
+}
+
+// Send a frame while holding writeMu. Frames from the server are never masked.
+func (ws *WebSocket) writeFrameLocked(fin bool, opcode byte, payload []byte) error {
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	header := []byte{opcode, 0}
+	if fin {
+		header[0] |= 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if _, err := ws.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.writer.Write(payload); err != nil {
+		return err
+	}
+	return ws.writer.Flush()
+}
+
+// webSocketMessageWriter sends a message as fragments
+type webSocketMessageWriter struct {
+	ws     *WebSocket
+	opcode byte // The opcode of the next fragment, which is only the type of the message for the first one
+	closed bool
+}
+
+// Send the data as the next fragment of the message
+func (w *webSocketMessageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWebSocketClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.ws.writeFrame(false, w.opcode, p); err != nil {
+		return 0, err
+	}
+	w.opcode = webSocketOpContinuation
+	return len(p), nil
+}
+
+// End the message with an empty final fragment
+func (w *webSocketMessageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.ws.messageMu.Unlock()
+	return w.ws.writeFrame(true, w.opcode, nil)
+}
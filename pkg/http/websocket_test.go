@@ -0,0 +1,408 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The handshake of the example in https://datatracker.ietf.org/doc/html/rfc6455#section-1.3
+const (
+	testWebSocketKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	testWebSocketAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// Start a server that echoes every message it receives over a WebSocket.
+// The error that ended each connection is sent on the channel.
+func startTestWebSocketServer(t *testing.T, maxMessageSize int64) (string, chan error) {
+	t.Helper()
+	errs := make(chan error, 1)
+	handler := HandlerFunc(func(req *Request, res *Response) {
+		ws, err := Upgrade(req, res)
+		if err != nil {
+			return
+		}
+		ws.MaxMessageSize = maxMessageSize
+		for {
+			typ, message, err := ws.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			ws.WriteMessage(typ, message)
+		}
+	})
+	return startTestServer(t, &Server{Handler: handler}), errs
+}
+
+// Open a WebSocket to the server, checking that the handshake succeeds
+func dialTestWebSocket(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + testWebSocketKey + "\r\n\r\n"))
+	status, headers, _ := readTestResponse(t, reader)
+	if status != "HTTP/1.1 101 Switching Protocols" {
+		t.Fatalf("Expected 101 Switching Protocols, but got %q", status)
+	}
+	if accept, _ := headers.Get("Sec-WebSocket-Accept"); accept != testWebSocketAccept {
+		t.Fatalf("Expected Sec-WebSocket-Accept %q, but got %q", testWebSocketAccept, accept)
+	}
+	return conn, reader
+}
+
+// Write a masked frame, as clients do
+func writeTestWebSocketFrame(t *testing.T, conn net.Conn, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+	header := []byte{opcode, 0x80}
+	if fin {
+		header[0] |= 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		header[1] |= byte(len(payload))
+	case len(payload) <= 0xffff:
+		header[1] |= 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] |= 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+	if _, err := conn.Write(append(append(header, mask...), masked...)); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// Read an unmasked frame, as servers send them
+func readTestWebSocketFrame(t *testing.T, reader *bufio.Reader) (bool, byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatalf("Expected an unmasked frame from the server")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(reader, extended[:])
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	return header[0]&0x80 != 0, header[0] & 0x0f, payload
+}
+
+// A close frame payload with the status code and reason
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+		header   string
+	}{
+		{"plain GET", "GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n", "HTTP/1.1 426 Upgrade Required", "Upgrade"},
+		{"wrong version", "GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+			"Sec-WebSocket-Version: 8\r\nSec-WebSocket-Key: " + testWebSocketKey + "\r\n\r\n", "HTTP/1.1 426 Upgrade Required", "Sec-WebSocket-Version"},
+		{"invalid key", "GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: c2hvcnQ=\r\n\r\n", "HTTP/1.1 400 Bad Request", ""},
+		{"POST", "POST /ws HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n", "HTTP/1.1 405 Method Not Allowed", "Allow"},
+	}
+
+	addr, _ := startTestWebSocketServer(t, 0)
+	conn := dialTestServer(t, addr)
+	reader := bufio.NewReader(conn)
+	for _, test := range tests {
+		// The connection stays usable, as it wasn't hijacked
+		conn.Write([]byte(test.request))
+		status, headers, _ := readTestResponse(t, reader)
+		if status != test.expected {
+			t.Errorf("Expected %q for %s, but got %q", test.expected, test.name, status)
+		}
+		if test.header != "" && !headers.Contains(test.header) {
+			t.Errorf("Expected a %s header for %s", test.header, test.name)
+		}
+	}
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	addr, errs := startTestWebSocketServer(t, 0)
+	conn, reader := dialTestWebSocket(t, addr)
+
+	large := bytes.Repeat([]byte("0123456789"), 7000) // Needs a 64-bit length
+	tests := []struct {
+		opcode  byte
+		payload []byte
+	}{
+		{webSocketOpText, []byte("Hello, WebSocket")},
+		{webSocketOpText, []byte{}},
+		{webSocketOpBinary, []byte{0x00, 0xff, 0x80}},
+		{webSocketOpBinary, large[:300]}, // Needs a 16-bit length
+		{webSocketOpBinary, large},
+	}
+	for _, test := range tests {
+		writeTestWebSocketFrame(t, conn, true, test.opcode, test.payload)
+		fin, opcode, payload := readTestWebSocketFrame(t, reader)
+		if !fin || opcode != test.opcode || !bytes.Equal(payload, test.payload) {
+			t.Errorf("Expected an echo of %d bytes with opcode %d, but got %d bytes with opcode %d", len(test.payload), test.opcode, len(payload), opcode)
+		}
+	}
+
+	// The client closes the connection, and the server answers with the same status
+	writeTestWebSocketFrame(t, conn, true, webSocketOpClose, closePayload(CloseNormal, "bye"))
+	_, opcode, payload := readTestWebSocketFrame(t, reader)
+	if opcode != webSocketOpClose || binary.BigEndian.Uint16(payload) != CloseNormal {
+		t.Errorf("Expected a close frame with status %d, but got opcode %d with %x", CloseNormal, opcode, payload)
+	}
+	var closeErr *CloseError
+	if err := <-errs; !errors.As(err, &closeErr) || closeErr.Code != CloseNormal || closeErr.Reason != "bye" {
+		t.Errorf("Expected the handler to get a CloseError with status %d, but got %v", CloseNormal, err)
+	}
+
+	// The server closes the connection once the handler returns
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, but got %v", err)
+	}
+}
+
+func TestWebSocketFragmentsAndPings(t *testing.T) {
+	addr, _ := startTestWebSocketServer(t, 0)
+	conn, reader := dialTestWebSocket(t, addr)
+
+	// A ping in the middle of a fragmented message is answered right away
+	writeTestWebSocketFrame(t, conn, false, webSocketOpText, []byte("Hello, "))
+	writeTestWebSocketFrame(t, conn, false, webSocketOpContinuation, []byte("fragmented "))
+	writeTestWebSocketFrame(t, conn, true, webSocketOpPing, []byte("ping"))
+	writeTestWebSocketFrame(t, conn, true, webSocketOpPong, []byte("unsolicited"))
+	writeTestWebSocketFrame(t, conn, true, webSocketOpContinuation, []byte("world"))
+
+	if _, opcode, payload := readTestWebSocketFrame(t, reader); opcode != webSocketOpPong || string(payload) != "ping" {
+		t.Errorf("Expected a pong with %q, but got opcode %d with %q", "ping", opcode, payload)
+	}
+	if _, opcode, payload := readTestWebSocketFrame(t, reader); opcode != webSocketOpText || string(payload) != "Hello, fragmented world" {
+		t.Errorf("Expected the message to be put together, but got opcode %d with %q", opcode, payload)
+	}
+}
+
+func TestWebSocketOnPong(t *testing.T) {
+	pongs := make(chan string, 1)
+	addr := startTestServer(t, &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		ws, err := Upgrade(req, res)
+		if err != nil {
+			return
+		}
+		ws.OnPong = func(data []byte) { pongs <- string(data) }
+		ws.Ping([]byte("are you there?"))
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})})
+	conn, reader := dialTestWebSocket(t, addr)
+
+	_, opcode, payload := readTestWebSocketFrame(t, reader)
+	if opcode != webSocketOpPing {
+		t.Fatalf("Expected a ping, but got opcode %d", opcode)
+	}
+	writeTestWebSocketFrame(t, conn, true, webSocketOpPong, payload)
+
+	select {
+	case pong := <-pongs:
+		if pong != "are you there?" {
+			t.Errorf("Expected the pong to carry the data of the ping, but got %q", pong)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected OnPong to be called")
+	}
+}
+
+func TestWebSocketNotHijackable(t *testing.T) {
+	// Like a request over HTTP/2, whose connection is shared by other requests
+	req := createTestRequest("GET", "/ws")
+	req.Headers.Set("Connection", "Upgrade")
+	req.Headers.Set("Upgrade", "websocket")
+	req.Headers.Set("Sec-WebSocket-Version", "13")
+	req.Headers.Set("Sec-WebSocket-Key", testWebSocketKey)
+	res := CreateResponse()
+
+	if _, err := Upgrade(req, res); !errors.Is(err, ErrBadHandshake) || !errors.Is(err, ErrNotHijackable) {
+		t.Errorf("Expected ErrBadHandshake and ErrNotHijackable, but got %v", err)
+	}
+	if res.statusCode != 400 {
+		t.Errorf("Expected status 400, but got %d", res.statusCode)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(t *testing.T, conn net.Conn)
+		code int
+	}{
+		{"unmasked frame", func(t *testing.T, conn net.Conn) {
+			conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+		}, CloseProtocolError},
+		{"reserved bits", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, 0x40|webSocketOpText, []byte("hi"))
+		}, CloseProtocolError},
+		{"unknown opcode", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, 0x3, nil)
+		}, CloseProtocolError},
+		{"fragmented control frame", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, false, webSocketOpPing, nil)
+		}, CloseProtocolError},
+		{"long control frame", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, webSocketOpPing, make([]byte, 126))
+		}, CloseProtocolError},
+		{"continuation without a message", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, webSocketOpContinuation, []byte("hi"))
+		}, CloseProtocolError},
+		{"new message during a fragmented one", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, false, webSocketOpText, []byte("one"))
+			writeTestWebSocketFrame(t, conn, true, webSocketOpText, []byte("two"))
+		}, CloseProtocolError},
+		{"invalid close status", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, webSocketOpClose, closePayload(1005, ""))
+		}, CloseProtocolError},
+		{"text that isn't UTF-8", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, true, webSocketOpText, []byte{0xc3, 0x28})
+		}, CloseInvalidPayload},
+		{"message too big", func(t *testing.T, conn net.Conn) {
+			writeTestWebSocketFrame(t, conn, false, webSocketOpBinary, make([]byte, 60))
+			writeTestWebSocketFrame(t, conn, true, webSocketOpContinuation, make([]byte, 60))
+		}, CloseMessageTooBig},
+	}
+
+	addr, errs := startTestWebSocketServer(t, 100)
+	for _, test := range tests {
+		conn, reader := dialTestWebSocket(t, addr)
+		test.send(t, conn)
+
+		_, opcode, payload := readTestWebSocketFrame(t, reader)
+		if opcode != webSocketOpClose || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != test.code {
+			t.Errorf("Expected a close frame with status %d for %s, but got opcode %d with %x", test.code, test.name, opcode, payload)
+		}
+		var closeErr *CloseError
+		if err := <-errs; !errors.As(err, &closeErr) || closeErr.Code != test.code {
+			t.Errorf("Expected the handler to get a CloseError with status %d for %s, but got %v", test.code, test.name, err)
+		}
+	}
+}
+
+func TestWebSocketServerClose(t *testing.T) {
+	// The server streams a fragmented message, then closes the connection on shutdown
+	shuttingDown := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		ws, err := Upgrade(req, res)
+		if err != nil {
+			return
+		}
+		w, _ := ws.NextWriter(TextMessage)
+		io.WriteString(w, "first ")
+		io.WriteString(w, "second")
+		w.Close()
+
+		<-shuttingDown
+		ws.Close(CloseGoingAway, "shutting down")
+		if err := ws.WriteMessage(TextMessage, []byte("too late")); err != ErrWebSocketClosed {
+			t.Errorf("Expected ErrWebSocketClosed after closing, but got %v", err)
+		}
+		_, _, err = ws.ReadMessage()
+		handlerErr <- err
+	})}
+	server.RegisterOnShutdown(func() { close(shuttingDown) })
+	addr := startTestServer(t, server)
+	conn, reader := dialTestWebSocket(t, addr)
+
+	expected := []struct {
+		fin     bool
+		opcode  byte
+		payload string
+	}{
+		{false, webSocketOpText, "first "},
+		{false, webSocketOpContinuation, "second"},
+		{true, webSocketOpContinuation, ""},
+	}
+	for _, e := range expected {
+		if fin, opcode, payload := readTestWebSocketFrame(t, reader); fin != e.fin || opcode != e.opcode || string(payload) != e.payload {
+			t.Errorf("Expected a fragment %q with opcode %d, but got %q with opcode %d", e.payload, e.opcode, payload, opcode)
+		}
+	}
+
+	// Shutdown doesn't wait for the hijacked connection, but tells the handler to close it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Expected Shutdown to return without waiting for the WebSocket, but got %v", err)
+	}
+
+	_, opcode, payload := readTestWebSocketFrame(t, reader)
+	if opcode != webSocketOpClose || binary.BigEndian.Uint16(payload) != CloseGoingAway || string(payload[2:]) != "shutting down" {
+		t.Fatalf("Expected a close frame with status %d, but got opcode %d with %x", CloseGoingAway, opcode, payload)
+	}
+
+	// The handler ends once the client answers the close frame
+	writeTestWebSocketFrame(t, conn, true, webSocketOpClose, payload)
+	var closeErr *CloseError
+	if err := <-handlerErr; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+		t.Errorf("Expected a CloseError with status %d, but got %v", CloseGoingAway, err)
+	}
+}
+
+func TestResponseHijack(t *testing.T) {
+	// Responses that aren't written to a connection of their own (e.g. HTTP/2) can't be hijacked
+	if _, _, err := CreateResponse().Hijack(); err != ErrNotHijackable {
+		t.Errorf("Expected ErrNotHijackable, but got %v", err)
+	}
+
+	// Data the client sent right after the request is still available to the handler
+	server := &Server{Handler: HandlerFunc(func(req *Request, res *Response) {
+		conn, rw, err := res.Hijack()
+		if err != nil {
+			t.Errorf("Expected the connection to be hijacked, but got %v", err)
+			return
+		}
+		if _, _, err := res.Hijack(); err != ErrHijacked {
+			t.Errorf("Expected ErrHijacked, but got %v", err)
+		}
+		line, _ := rw.ReadString('\n')
+		conn.Write([]byte(strings.ToUpper(line)))
+	})}
+	conn := dialTestServer(t, startTestServer(t, server))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\nraw protocol\n"))
+
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "RAW PROTOCOL\n" {
+		t.Errorf("Expected %q and the connection to be closed, but got %q (%v)", "RAW PROTOCOL\n", data, err)
+	}
+}